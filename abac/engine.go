@@ -0,0 +1,217 @@
+// Package abac evaluates attribute based access rules.
+//
+// A policy file (*.policy) holds one rule per line, a line starting with whitespace continues the rule above:
+//
+//	# support staff may read users of their own region
+//	allow users:read if "SUPPORT" in subject.roles and subject.region == resource.region
+//	deny users:write if env.hour < 9 or env.hour >= 17
+//
+// A rule without "if" always applies. The action can be "*" or "users:*".
+// Deny overrides allow, and when no rule allows the action it is denied. A deny rule whose condition can't be
+// evaluated denies.
+package abac
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Rule is one line of a policy file
+type Rule struct {
+	Source    string `json:"source"` // file:line
+	Effect    string `json:"effect"`
+	Action    string `json:"action"`
+	Condition string `json:"condition,omitempty"`
+	expr      Expr
+}
+
+func (r *Rule) appliesTo(action string) bool {
+	if r.Action == "*" || r.Action == action {
+		return true
+	}
+	return strings.HasSuffix(r.Action, ":*") && strings.HasPrefix(action, strings.TrimSuffix(r.Action, "*"))
+}
+
+// ParsePolicy reads the rules of one policy file, name is only used in Rule.Source and errors
+func ParsePolicy(name string, src string) ([]*Rule, error) {
+	var rules []*Rule
+
+	// join continuation lines first, keeping the line number where each rule starts
+	type line struct {
+		number int
+		text   string
+	}
+	var lines []line
+	for i, text := range strings.Split(src, "\n") {
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if text[0] == ' ' || text[0] == '\t' {
+			if len(lines) == 0 {
+				return nil, fmt.Errorf("%s:%d: continuation line without a rule", name, i+1)
+			}
+			lines[len(lines)-1].text += " " + trimmed
+			continue
+		}
+		lines = append(lines, line{i + 1, trimmed})
+	}
+
+	for _, l := range lines {
+		source := fmt.Sprintf("%s:%d", name, l.number)
+
+		fields := strings.Fields(l.text)
+		if len(fields) < 2 || (fields[0] != EffectAllow && fields[0] != EffectDeny) {
+			return nil, fmt.Errorf("%s: a rule looks like: allow|deny <action> [if <condition>]", source)
+		}
+		rule := &Rule{Source: source, Effect: fields[0], Action: fields[1]}
+
+		if len(fields) > 2 {
+			if fields[2] != "if" {
+				return nil, fmt.Errorf("%s: expected if after the action", source)
+			}
+			// cut effect, action and "if" off the text itself, so strings in the condition keep their spaces
+			condition := strings.TrimSpace(strings.TrimPrefix(l.text, fields[0]))
+			condition = strings.TrimSpace(strings.TrimPrefix(condition, fields[1]))
+			rule.Condition = strings.TrimSpace(strings.TrimPrefix(condition, "if"))
+
+			expr, err := ParseExpr(rule.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", source, err)
+			}
+			rule.expr = expr
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// RuleResult tells what one rule did during an evaluation
+type RuleResult struct {
+	Rule    *Rule  `json:"rule"`
+	Matched bool   `json:"matched"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Decision is the outcome of an evaluation, Trace lists every rule about the action for explaining it
+type Decision struct {
+	Allowed bool         `json:"allowed"`
+	Denied  bool         `json:"denied"` // a deny rule matched, not just no allow rule
+	Reason  string       `json:"reason"`
+	Trace   []RuleResult `json:"trace"`
+}
+
+// Evaluate applies the rules to a request. A condition that fails to evaluate (type mismatch, bad cidr...) fails
+// closed: an allow rule does not match and a deny rule does, so a broken rule never grants more than intended.
+// The error ends up in the trace.
+func Evaluate(rules []*Rule, r Request) Decision {
+	decision := Decision{Trace: []RuleResult{}}
+
+	var allowedBy, deniedBy *Rule
+	var deniedError string
+	for _, rule := range rules {
+		if !rule.appliesTo(r.Action) {
+			continue
+		}
+
+		result := RuleResult{Rule: rule, Matched: true}
+		if rule.expr != nil {
+			matched, err := evalBool(rule.expr, r)
+			result.Matched = matched
+			if err != nil {
+				result.Matched = rule.Effect == EffectDeny
+				result.Error = err.Error()
+			}
+		}
+		decision.Trace = append(decision.Trace, result)
+
+		if result.Matched && rule.Effect == EffectDeny && deniedBy == nil {
+			deniedBy = rule
+			deniedError = result.Error
+		}
+		if result.Matched && rule.Effect == EffectAllow && allowedBy == nil {
+			allowedBy = rule
+		}
+	}
+
+	switch {
+	case deniedBy != nil:
+		decision.Denied = true
+		decision.Reason = "denied by " + deniedBy.Source
+		if deniedError != "" {
+			decision.Reason += " (condition failed: " + deniedError + ")"
+		}
+	case allowedBy != nil:
+		decision.Allowed = true
+		decision.Reason = "allowed by " + allowedBy.Source
+	default:
+		decision.Reason = "no rule allows " + r.Action
+	}
+	return decision
+}
+
+// Engine holds the rules loaded from a directory, Reload swaps them while requests are being evaluated
+type Engine struct {
+	Dir string
+
+	mu       sync.RWMutex
+	rules    []*Rule
+	loadedAt time.Time
+}
+
+func NewEngine(dir string) *Engine {
+	return &Engine{Dir: dir}
+}
+
+// Reload parses every *.policy file of the directory. If any file is broken the old rules are kept.
+// A missing directory means no rules, so everything is denied.
+func (e *Engine) Reload() error {
+	files, err := filepath.Glob(filepath.Join(e.Dir, "*.policy"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	rules := []*Rule{}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		parsed, err := ParsePolicy(file, string(src))
+		if err != nil {
+			return err
+		}
+		rules = append(rules, parsed...)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules = rules
+	e.loadedAt = time.Now()
+	return nil
+}
+
+// Rules returns the rules currently in use and when they were loaded
+func (e *Engine) Rules() ([]*Rule, time.Time) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.rules, e.loadedAt
+}
+
+func (e *Engine) Evaluate(r Request) Decision {
+	rules, _ := e.Rules()
+	return Evaluate(rules, r)
+}
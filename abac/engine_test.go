@@ -0,0 +1,267 @@
+package abac
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `# comment lines and blank lines are skipped
+
+allow users:read if "SUPPORT" in subject.roles
+	and subject.region == resource.region
+allow users:*
+	if "ADMIN" in subject.roles
+deny users:write if resource.locked == true
+deny users:delete if subject.level < "high"
+allow groups:read if subject.level > 1
+allow reports:read
+deny * if env.maintenance
+`
+
+func TestParsePolicy(t *testing.T) {
+	rules, err := ParsePolicy("test.policy", testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ source, effect, action, condition string }{
+		{"test.policy:3", "allow", "users:read", `"SUPPORT" in subject.roles and subject.region == resource.region`},
+		{"test.policy:5", "allow", "users:*", `"ADMIN" in subject.roles`},
+		{"test.policy:7", "deny", "users:write", "resource.locked == true"},
+		{"test.policy:8", "deny", "users:delete", `subject.level < "high"`},
+		{"test.policy:9", "allow", "groups:read", "subject.level > 1"},
+		{"test.policy:10", "allow", "reports:read", ""},
+		{"test.policy:11", "deny", "*", "env.maintenance"},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i, w := range want {
+		r := rules[i]
+		if r.Source != w.source || r.Effect != w.effect || r.Action != w.action || r.Condition != w.condition {
+			t.Errorf("rule %d = %+v, want %+v", i, *r, w)
+		}
+		if (r.expr == nil) != (w.condition == "") {
+			t.Errorf("rule %d: condition parsed as %v", i, r.expr)
+		}
+	}
+
+	// spaces inside strings are kept
+	rules, err = ParsePolicy("p", `allow users:read if resource.name == "a  b"`)
+	if err != nil || rules[0].Condition != `resource.name == "a  b"` {
+		t.Fatalf("got %+v, %v", rules, err)
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	cases := map[string]string{
+		"  allow users:read":            "p:1: continuation line without a rule",
+		"# comment\n\tallow users:read": "p:2: continuation line without a rule",
+		"allow":                         "p:1: a rule looks like",
+		"permit users:read":             "p:1: a rule looks like",
+		"allow users:read\nallow users:read when x": "p:2: expected if",
+		"allow users:read if":                       "p:1: unexpected end",
+		"allow users:read if\n  subject.a ==":       "p:1: unexpected end",
+		"deny users:read if user.region == 1":       "p:1: unknown attribute",
+	}
+	for src, want := range cases {
+		_, err := ParsePolicy("p", src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParsePolicy(%q) = %v, want an error containing %q", src, err, want)
+		}
+	}
+}
+
+func TestRuleAppliesTo(t *testing.T) {
+	cases := []struct {
+		rule, action string
+		want         bool
+	}{
+		{"users:read", "users:read", true},
+		{"users:read", "users:write", false},
+		{"*", "anything:at all", true},
+		{"users:*", "users:read", true},
+		{"users:*", "users:", true},
+		{"users:*", "usersx:read", false},
+		{"users:*", "groups:read", false},
+		{"users*", "users:read", false},
+	}
+	for _, c := range cases {
+		if got := (&Rule{Action: c.rule}).appliesTo(c.action); got != c.want {
+			t.Errorf("%q applies to %q = %v, want %v", c.rule, c.action, got, c.want)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rules, err := ParsePolicy("test.policy", testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	support := Attributes{"roles": []string{"SUPPORT"}, "region": "eu", "level": 1}
+	admin := Attributes{"roles": []string{"ADMIN"}, "region": "us", "level": 5}
+
+	cases := []struct {
+		name            string
+		request         Request
+		allowed, denied bool
+		reason          string
+		trace           int
+	}{
+		{
+			name:    "allowed by the first matching rule",
+			request: Request{Action: "users:read", Subject: support, Resource: Attributes{"region": "eu"}},
+			allowed: true, reason: "allowed by test.policy:3", trace: 3,
+		},
+		{
+			name:    "condition not met",
+			request: Request{Action: "users:read", Subject: support, Resource: Attributes{"region": "us"}},
+			reason:  "no rule allows users:read", trace: 3,
+		},
+		{
+			name:    "wildcard action",
+			request: Request{Action: "users:write", Subject: admin, Resource: Attributes{}},
+			allowed: true, reason: "allowed by test.policy:5", trace: 3,
+		},
+		{
+			name:    "deny overrides allow",
+			request: Request{Action: "users:write", Subject: admin, Resource: Attributes{"locked": true}},
+			denied:  true, reason: "denied by test.policy:7", trace: 3,
+		},
+		{
+			name:    "deny on every action",
+			request: Request{Action: "reports:read", Subject: support, Env: Attributes{"maintenance": true}},
+			denied:  true, reason: "denied by test.policy:11", trace: 2,
+		},
+		{
+			name:    "rule without a condition",
+			request: Request{Action: "reports:read", Subject: support, Env: Attributes{"maintenance": false}},
+			allowed: true, reason: "allowed by test.policy:10", trace: 2,
+		},
+		{
+			name:    "no rule about the action",
+			request: Request{Action: "billing:read", Subject: admin},
+			reason:  "no rule allows billing:read", trace: 1,
+		},
+		{
+			name:    "a failing deny condition denies",
+			request: Request{Action: "users:delete", Subject: admin},
+			denied:  true, reason: "denied by test.policy:8 (condition failed: ", trace: 3,
+		},
+		{
+			name:    "a failing allow condition does not allow",
+			request: Request{Action: "groups:read", Subject: Attributes{"level": "high"}},
+			reason:  "no rule allows groups:read", trace: 2,
+		},
+		{
+			name:    "a failing deny on every action denies",
+			request: Request{Action: "reports:read", Subject: support, Env: Attributes{"maintenance": "yes"}},
+			denied:  true, reason: "denied by test.policy:11 (condition failed: ", trace: 2,
+		},
+	}
+	for _, c := range cases {
+		d := Evaluate(rules, c.request)
+		if d.Allowed != c.allowed || d.Denied != c.denied || !strings.HasPrefix(d.Reason, c.reason) || len(d.Trace) != c.trace {
+			t.Errorf("%s: got %+v", c.name, d)
+		}
+		if d.Allowed && d.Denied {
+			t.Errorf("%s: both allowed and denied", c.name)
+		}
+	}
+}
+
+func TestEvaluateTrace(t *testing.T) {
+	rules, err := ParsePolicy("p", "allow a if subject.x == 1\ndeny a if subject.x < \"s\"\nallow b\nallow a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := Evaluate(rules, Request{Action: "a", Subject: Attributes{"x": 2}})
+	if !d.Denied || len(d.Trace) != 3 {
+		t.Fatalf("got %+v", d)
+	}
+	want := []struct {
+		source  string
+		matched bool
+		failed  bool
+	}{{"p:1", false, false}, {"p:2", true, true}, {"p:4", true, false}}
+	for i, w := range want {
+		r := d.Trace[i]
+		if r.Rule.Source != w.source || r.Matched != w.matched || (r.Error != "") != w.failed {
+			t.Errorf("trace %d = %+v, want %+v", i, r, w)
+		}
+	}
+
+	if d := Evaluate(nil, Request{Action: "a"}); d.Allowed || d.Denied || d.Trace == nil {
+		t.Fatalf("no rules: got %+v", d)
+	}
+}
+
+func writePolicy(t *testing.T, dir, name, src string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEngineReload(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, "b.policy", "deny users:write if resource.locked")
+	writePolicy(t, dir, "a.policy", "allow users:*")
+	writePolicy(t, dir, "notes.txt", "this is not a policy")
+
+	engine := NewEngine(dir)
+	if err := engine.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	rules, loadedAt := engine.Rules()
+	if len(rules) != 2 || loadedAt.IsZero() {
+		t.Fatalf("got %d rules loaded at %v", len(rules), loadedAt)
+	}
+	// files are read in name order
+	if rules[0].Source != filepath.Join(dir, "a.policy")+":1" || rules[1].Source != filepath.Join(dir, "b.policy")+":1" {
+		t.Fatalf("got %s, %s", rules[0].Source, rules[1].Source)
+	}
+	if d := engine.Evaluate(Request{Action: "users:write", Resource: Attributes{"locked": true}}); !d.Denied {
+		t.Fatalf("got %+v", d)
+	}
+
+	// a broken file keeps the rules that were loaded before
+	writePolicy(t, dir, "c.policy", "allow users:read if subject.region ==")
+	err := engine.Reload()
+	if err == nil || !strings.Contains(err.Error(), "c.policy:1") {
+		t.Fatalf("got %v", err)
+	}
+	if again, at := engine.Rules(); len(again) != 2 || again[0] != rules[0] || !at.Equal(loadedAt) {
+		t.Fatalf("rules changed to %v", again)
+	}
+
+	// a policy that can't be read keeps them too
+	if err := os.Remove(filepath.Join(dir, "c.policy")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "d.policy"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Reload(); err == nil {
+		t.Fatal("reading a directory as a policy did not fail")
+	}
+	if again, _ := engine.Rules(); len(again) != 2 {
+		t.Fatalf("rules changed to %v", again)
+	}
+
+	// a missing directory means no rules, and nothing is allowed
+	engine.Dir = filepath.Join(dir, "missing")
+	if err := engine.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := engine.Rules(); len(again) != 0 {
+		t.Fatalf("got %v", again)
+	}
+	if d := engine.Evaluate(Request{Action: "users:read"}); d.Allowed {
+		t.Fatalf("got %+v", d)
+	}
+}
@@ -0,0 +1,266 @@
+package abac
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Attributes of the subject (the logged in user), the resource (the user being accessed) or the environment
+type Attributes map[string]interface{}
+
+// Request is what a policy is evaluated against
+type Request struct {
+	Action   string     `json:"action"`
+	Subject  Attributes `json:"subject"`
+	Resource Attributes `json:"resource"`
+	Env      Attributes `json:"env"`
+}
+
+func (r Request) attribute(root, name string) interface{} {
+	var attributes Attributes
+	switch root {
+	case "subject":
+		attributes = r.Subject
+	case "resource":
+		attributes = r.Resource
+	case "env":
+		attributes = r.Env
+	}
+	// a missing attribute is null, so rules about other resources simply don't match
+	return normalize(attributes[name])
+}
+
+// Expr is a compiled condition
+type Expr interface {
+	Eval(r Request) (interface{}, error)
+}
+
+type literalExpr struct{ value interface{} }
+type listExpr struct{ items []Expr }
+type attributeExpr struct{ root, name string }
+type notExpr struct{ expr Expr }
+type logicalExpr struct {
+	op          string
+	left, right Expr
+}
+type compareExpr struct {
+	op          string
+	left, right Expr
+}
+type callExpr struct {
+	name string
+	fn   func(args []interface{}) (interface{}, error)
+	args []Expr
+}
+
+func (e literalExpr) Eval(r Request) (interface{}, error) { return e.value, nil }
+
+func (e attributeExpr) Eval(r Request) (interface{}, error) { return r.attribute(e.root, e.name), nil }
+
+func (e listExpr) Eval(r Request) (interface{}, error) {
+	values := make([]interface{}, len(e.items))
+	for i, item := range e.items {
+		value, err := item.Eval(r)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func (e notExpr) Eval(r Request) (interface{}, error) {
+	value, err := evalBool(e.expr, r)
+	return !value, err
+}
+
+func (e logicalExpr) Eval(r Request) (interface{}, error) {
+	left, err := evalBool(e.left, r)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "and" && !left {
+		return false, nil
+	}
+	if e.op == "or" && left {
+		return true, nil
+	}
+	return evalBool(e.right, r)
+}
+
+func (e compareExpr) Eval(r Request) (interface{}, error) {
+	left, err := e.left.Eval(r)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.Eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		switch container := right.(type) {
+		case []interface{}:
+			for _, item := range container {
+				if equal(left, item) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case string:
+			s, ok := left.(string)
+			return ok && strings.Contains(container, s), nil
+		case nil:
+			return false, nil
+		}
+		return nil, fmt.Errorf("in needs a list or a string, got %T", right)
+	}
+
+	// ordering, only numbers with numbers and strings with strings, null never matches
+	if left == nil || right == nil {
+		return false, nil
+	}
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("can not compare number with %T", right)
+		}
+		cmp = compareFloat(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("can not compare string with %T", right)
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return nil, fmt.Errorf("can not order %T", left)
+	}
+
+	switch e.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func (e callExpr) Eval(r Request) (interface{}, error) {
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		value, err := arg.Eval(r)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return e.fn(args)
+}
+
+func evalBool(e Expr, r Request) (bool, error) {
+	value, err := e.Eval(r)
+	if err != nil {
+		return false, err
+	}
+	switch b := value.(type) {
+	case bool:
+		return b, nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("expected true or false, got %v", value)
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if _, ok := b.([]interface{}); ok {
+		return false
+	}
+	return a == b
+}
+
+// normalize turns attribute values into the few types the language knows
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string, float64, []interface{}:
+		return v
+	case *string:
+		if v == nil {
+			return nil
+		}
+		return *v
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case []string:
+		values := make([]interface{}, len(v))
+		for i, s := range v {
+			values[i] = s
+		}
+		return values
+	}
+	return fmt.Sprint(value)
+}
+
+// functions callable from conditions
+var functions = map[string]func(args []interface{}) (interface{}, error){
+	// in_cidr(env.ip, "10.0.0.0/8")
+	"in_cidr": func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("in_cidr takes an ip and a cidr")
+		}
+		ip, _ := args[0].(string)
+		cidr, _ := args[1].(string)
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		parsed := net.ParseIP(ip)
+		return parsed != nil && network.Contains(parsed), nil
+	},
+	// starts_with(resource.email, "admin@")
+	"starts_with": func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("starts_with takes two strings")
+		}
+		s, _ := args[0].(string)
+		prefix, _ := args[1].(string)
+		return strings.HasPrefix(s, prefix), nil
+	},
+}
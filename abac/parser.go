@@ -0,0 +1,302 @@
+package abac
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// the condition language:
+//
+//	subject.region == resource.region and "SUPPORT" in subject.roles
+//	not (env.hour >= 9 and env.hour < 17)
+//	in_cidr(env.ip, "10.0.0.0/8")
+//
+// values are strings, numbers, true, false, null and lists ([1, 2]), attributes are <subject|resource|env>.<name>.
+// operators, loosest first: or, and, not, comparisons (== != < <= > >= in, not in)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		ch := rune(src[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '"':
+			// find the closing quote, skipping escaped ones
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			text, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("bad string at %d: %v", i, err)
+			}
+			tokens = append(tokens, token{tokString, text, i})
+			i = j + 1
+		case unicode.IsDigit(ch) || (ch == '-' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			j := i + 1
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, src[i:j], i})
+			i = j
+		case unicode.IsLetter(ch) || ch == '_':
+			j := i + 1
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_' || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, src[i:j], i})
+			i = j
+		default:
+			if i+1 < len(src) {
+				if two := src[i : i+2]; two == "==" || two == "!=" || two == "<=" || two == ">=" {
+					tokens = append(tokens, token{tokOp, two, i})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("<>()[],", ch) {
+				return nil, fmt.Errorf("unexpected %q at %d", ch, i)
+			}
+			tokens = append(tokens, token{tokOp, string(ch), i})
+			i++
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
+
+var comparisonOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && t.text == word
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *parser) expect(op string) error {
+	if !p.isOp(op) {
+		t := p.peek()
+		return fmt.Errorf("expected %q at %d", op, t.pos)
+	}
+	p.next()
+	return nil
+}
+
+// ParseExpr compiles a condition
+func ParseExpr(src string) (Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return expr, nil
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalExpr{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalExpr{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.isKeyword("not") {
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && comparisonOps[t.text]:
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return compareExpr{op: t.text, left: left, right: right}, nil
+	case p.isKeyword("in"):
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return compareExpr{op: "in", left: left, right: right}, nil
+	case p.isKeyword("not") && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == tokIdent && p.tokens[p.pos+1].text == "in":
+		p.next()
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{compareExpr{op: "in", left: left, right: right}}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokString:
+		return literalExpr{t.text}, nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q at %d", t.text, t.pos)
+		}
+		return literalExpr{n}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			expr, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return expr, p.expect(")")
+		case "[":
+			items := []Expr{}
+			for !p.isOp("]") {
+				item, err := p.parsePrimary()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+				if !p.isOp(",") {
+					break
+				}
+				p.next()
+			}
+			return listExpr{items}, p.expect("]")
+		}
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literalExpr{true}, nil
+		case "false":
+			return literalExpr{false}, nil
+		case "null":
+			return literalExpr{nil}, nil
+		}
+
+		if p.isOp("(") {
+			fn, ok := functions[t.text]
+			if !ok {
+				return nil, fmt.Errorf("unknown function %q at %d", t.text, t.pos)
+			}
+			p.next()
+			args := []Expr{}
+			for !p.isOp(")") {
+				arg, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+				if !p.isOp(",") {
+					break
+				}
+				p.next()
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return callExpr{name: t.text, fn: fn, args: args}, nil
+		}
+
+		root, name, found := strings.Cut(t.text, ".")
+		if !found || name == "" || (root != "subject" && root != "resource" && root != "env") {
+			return nil, fmt.Errorf("unknown attribute %q at %d, use subject.<name>, resource.<name> or env.<name>", t.text, t.pos)
+		}
+		return attributeExpr{root: root, name: name}, nil
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of condition")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
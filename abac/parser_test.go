@@ -0,0 +1,204 @@
+package abac
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tokens, err := lex(`subject.roles != ["A", "b\"c"] and env.hour>=-9.5 or(x_1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, tok.text)
+	}
+	want := []string{"subject.roles", "!=", "[", "A", ",", `b"c`, "]", "and", "env.hour", ">=", "-9.5", "or", "(", "x_1", ")", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if tokens[3].kind != tokString || tokens[10].kind != tokNumber || tokens[len(tokens)-1].kind != tokEOF {
+		t.Fatalf("wrong kinds %+v", tokens)
+	}
+}
+
+func TestParseExprPrecedence(t *testing.T) {
+	a := attributeExpr{"subject", "a"}
+	b := attributeExpr{"subject", "b"}
+	c := attributeExpr{"subject", "c"}
+
+	cases := map[string]Expr{
+		"subject.a or subject.b and subject.c":   logicalExpr{"or", a, logicalExpr{"and", b, c}},
+		"subject.a and subject.b or subject.c":   logicalExpr{"or", logicalExpr{"and", a, b}, c},
+		"(subject.a or subject.b) and subject.c": logicalExpr{"and", logicalExpr{"or", a, b}, c},
+		"subject.a or subject.b or subject.c":    logicalExpr{"or", logicalExpr{"or", a, b}, c},
+		"not subject.a and subject.b":            logicalExpr{"and", notExpr{a}, b},
+		"not not subject.a":                      notExpr{notExpr{a}},
+		"not subject.a == subject.b":             notExpr{compareExpr{"==", a, b}},
+		"subject.a == subject.b and subject.c":   logicalExpr{"and", compareExpr{"==", a, b}, c},
+		"subject.a in subject.b":                 compareExpr{"in", a, b},
+		"subject.a not in subject.b":             notExpr{compareExpr{"in", a, b}},
+		"not subject.a not in subject.b":         notExpr{notExpr{compareExpr{"in", a, b}}},
+		`subject.a in ["x", 1, true, null, []]`: compareExpr{"in", a, listExpr{[]Expr{
+			literalExpr{"x"}, literalExpr{1.0}, literalExpr{true}, literalExpr{nil}, listExpr{[]Expr{}},
+		}}},
+		`resource.name == "tab\tquote\" back\\"`: compareExpr{"==", attributeExpr{"resource", "name"}, literalExpr{"tab\tquote\" back\\"}},
+		"env.hour < -1.5":                        compareExpr{"<", attributeExpr{"env", "hour"}, literalExpr{-1.5}},
+	}
+	for src, want := range cases {
+		got, err := ParseExpr(src)
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q parsed as %#v, want %#v", src, got, want)
+		}
+	}
+}
+
+func TestParseExprFunctionCalls(t *testing.T) {
+	expr, err := ParseExpr(`in_cidr(env.ip, "10.0.0.0/8") and starts_with(resource.email, "admin@")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	and := expr.(logicalExpr)
+	left, right := and.left.(callExpr), and.right.(callExpr)
+	if left.name != "in_cidr" || len(left.args) != 2 || right.name != "starts_with" || len(right.args) != 2 {
+		t.Fatalf("parsed as %#v", expr)
+	}
+
+	// arguments are full expressions
+	if _, err := ParseExpr(`starts_with(resource.email, subject.a or subject.b)`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	cases := map[string]string{
+		"":                             "unexpected end",
+		"subject.a ==":                 "unexpected end",
+		"subject.a and":                "unexpected end",
+		"not":                          "unexpected end",
+		"(subject.a":                   `expected ")"`,
+		"subject.a)":                   "unexpected",
+		"[1, 2":                        `expected "]"`,
+		"[1 2]":                        `expected "]"`,
+		"subject.a == 1 == 2":          "unexpected",
+		"subject.a subject.b":          "unexpected",
+		"subject.a = 1":                "unexpected '='",
+		"subject.a && subject.b":       "unexpected '&'",
+		"subject":                      "unknown attribute",
+		"subject.":                     "unknown attribute",
+		"user.region == 1":             "unknown attribute",
+		"exec(1)":                      "unknown function",
+		`in_cidr(env.ip, "10.0.0.0/8"`: `expected ")"`,
+		`"unterminated`:                "unterminated string",
+		`"bad \q escape"`:              "bad string",
+		"1.2.3 == 1":                   "bad number",
+		"subject.a in":                 "unexpected end",
+		"subject.a not subject.b":      "unexpected",
+	}
+	for src, want := range cases {
+		_, err := ParseExpr(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseExpr(%q) = %v, want an error containing %q", src, err, want)
+		}
+	}
+}
+
+func TestEvalExpr(t *testing.T) {
+	r := Request{
+		Subject:  Attributes{"roles": []string{"ADMIN", "SUPPORT"}, "region": "eu", "level": 3, "name": `a"b`},
+		Resource: Attributes{"region": "eu", "email": "admin@example.com", "tags": []interface{}{"x", []interface{}{"y"}}},
+		Env:      Attributes{"ip": "10.1.2.3", "hour": int64(14)},
+	}
+
+	cases := map[string]bool{
+		// comparisons
+		`subject.region == resource.region`: true,
+		`subject.region != resource.region`: false,
+		`subject.level == 3`:                true,
+		`subject.level < 3`:                 false,
+		`subject.level <= 3`:                true,
+		`subject.level > 2.5`:               true,
+		`subject.level >= 4`:                false,
+		`"abc" < "abd"`:                     true,
+		`subject.name == "a\"b"`:            true,
+		`env.hour >= 9 and env.hour < 17`:   true,
+		// in / not in, on lists and strings
+		`"SUPPORT" in subject.roles`:       true,
+		`"USER" in subject.roles`:          false,
+		`"USER" not in subject.roles`:      true,
+		`"SUPPORT" not in subject.roles`:   false,
+		`["y"] in resource.tags`:           true,
+		`"example" in resource.email`:      true,
+		`subject.level in ["3", 4]`:        false,
+		`subject.level in [1, 2, 3]`:       true,
+		`subject.missing in subject.roles`: false,
+		`"a" in subject.missing`:           false,
+		// missing attributes are null, they don't match but don't fail either
+		`subject.missing == null`: true,
+		`subject.missing == "eu"`: false,
+		`subject.missing < 3`:     false,
+		`subject.missing`:         false,
+		`not subject.missing`:     true,
+		`[1, "a"] == [1, "a"]`:    true,
+		`[1, "a"] == [1]`:         false,
+		`[1] == 1`:                false,
+		// logic
+		`true or false and false`:       true,
+		`(true or false) and false`:     false,
+		`not true or true`:              true,
+		`not (true or true)`:            false,
+		`false and subject.level < "x"`: false, // not evaluated, and would fail
+		`true or subject.level < "x"`:   true,
+		// functions
+		`in_cidr(env.ip, "10.0.0.0/8")`:          true,
+		`in_cidr(env.ip, "192.168.0.0/16")`:      false,
+		`in_cidr(subject.missing, "10.0.0.0/8")`: false,
+		`starts_with(resource.email, "admin@")`:  true,
+		`starts_with(resource.email, "root@")`:   false,
+	}
+	for src, want := range cases {
+		expr, err := ParseExpr(src)
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		if got, err := evalBool(expr, r); err != nil || got != want {
+			t.Errorf("%q = %v, %v, want %v", src, got, err, want)
+		}
+	}
+}
+
+func TestEvalExprErrors(t *testing.T) {
+	r := Request{Subject: Attributes{"region": "eu", "level": 3}, Env: Attributes{"ip": "10.1.2.3"}}
+
+	for _, src := range []string{
+		`subject.level < "3"`,
+		`subject.region > 1`,
+		`true < false`,
+		`subject.region in 3`,
+		`subject.region`,
+		`subject.level and true`,
+		`not subject.level`,
+		`in_cidr(env.ip, "not a cidr")`,
+		`in_cidr(env.ip)`,
+		`starts_with("a")`,
+		`[in_cidr(env.ip, "bad")] == []`,
+		`in_cidr(subject.level < "x", "10.0.0.0/8")`,
+	} {
+		expr, err := ParseExpr(src)
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		if _, err := evalBool(expr, r); err == nil {
+			t.Errorf("%q evaluated without an error", src)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Package audit makes the audit log tamper evident.
+//
+// Every entry carries the hash of the entry before it, and its own hash covers its content and that link:
+//
+//	hash(n) = sha256(canonical json of entry n, including prev_hash = hash(n-1))
+//
+// Changing, removing or reordering an entry breaks the link of the entry after it, which Verifier reports.
+// Removing entries at the end of the chain can only be detected against a head recorded elsewhere,
+// that is why the verifier prints the head it reached.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GenesisHash is the Prev_hash of the first entry of the chain
+const GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// canonicalEntry fixes the fields and their order that are hashed, json sorts the keys of the maps
+type canonicalEntry struct {
+	Seq        int64       `json:"seq"`
+	Prev_hash  string      `json:"prev_hash"`
+	Action     string      `json:"action"`
+	Actor_id   string      `json:"actor_id"`
+	Target_id  string      `json:"target_id"`
+	Tenant_id  string      `json:"tenant_id"`
+	Ip         string      `json:"ip"`
+	Request_id string      `json:"request_id"`
+	Details    interface{} `json:"details"`
+	Changes    interface{} `json:"changes"`
+	Created_at string      `json:"created_at"`
+}
+
+// Hash computes the hash of an entry from everything but its ID and its own Hash.
+// Mongo keeps times to the millisecond, so entries have to be created with a truncated Created_at.
+func Hash(entry models.AuditEntry) (string, error) {
+	changes := map[string]interface{}{}
+	for field, change := range entry.Changes {
+		changes[field] = map[string]interface{}{"before": Normalize(change.Before), "after": Normalize(change.After)}
+	}
+
+	raw, err := json.Marshal(canonicalEntry{
+		Seq:        entry.Seq,
+		Prev_hash:  entry.Prev_hash,
+		Action:     entry.Action,
+		Actor_id:   entry.Actor_id,
+		Target_id:  entry.Target_id,
+		Tenant_id:  entry.Tenant_id,
+		Ip:         entry.Ip,
+		Request_id: entry.Request_id,
+		Details:    Normalize(entry.Details),
+		Changes:    changes,
+		Created_at: entry.Created_at.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Normalize brings a value to the same shape whether it was just built or read back from mongo:
+// documents become maps, arrays become []interface{}, numbers float64 and times UTC strings.
+func Normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		if v == nil {
+			return nil
+		}
+		normalized := map[string]interface{}{}
+		for key, item := range v {
+			normalized[key] = Normalize(item)
+		}
+		return normalized
+	case bson.M:
+		return Normalize(map[string]interface{}(v))
+	case bson.D:
+		normalized := map[string]interface{}{}
+		for _, item := range v {
+			normalized[item.Key] = Normalize(item.Value)
+		}
+		return normalized
+	case bson.A:
+		return Normalize([]interface{}(v))
+	case []interface{}:
+		normalized := make([]interface{}, len(v))
+		for i, item := range v {
+			normalized[i] = Normalize(item)
+		}
+		return normalized
+	case []string:
+		normalized := make([]interface{}, len(v))
+		for i, item := range v {
+			normalized[i] = item
+		}
+		return normalized
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case time.Time:
+		return v.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano)
+	case primitive.DateTime:
+		return Normalize(v.Time())
+	case primitive.ObjectID:
+		return v.Hex()
+	case *string:
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+
+	// anything else (structs ...) is turned into its json form
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return string(raw)
+	}
+	return generic
+}
+
+// Diff returns the fields whose value differs between before and after, nil maps count as empty
+func Diff(before map[string]interface{}, after map[string]interface{}) map[string]models.AuditChange {
+	fields := map[string]bool{}
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+
+	changes := map[string]models.AuditChange{}
+	for field := range fields {
+		oldValue, newValue := Normalize(before[field]), Normalize(after[field])
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes[field] = models.AuditChange{Before: oldValue, After: newValue}
+		}
+	}
+	return changes
+}
+
+// Problem is a break of the chain found by Verifier
+type Problem struct {
+	Seq    int64  `json:"seq"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("seq %d (%s): %s", p.Seq, p.ID, p.Reason)
+}
+
+// Verifier checks entries handed to it in Seq order, starting from the first entry of the chain
+type Verifier struct {
+	Checked  int
+	Problems []Problem
+	lastSeq  int64
+	lastHash string
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{lastHash: GenesisHash}
+}
+
+func (v *Verifier) Add(entry models.AuditEntry) {
+	v.Checked++
+	problem := func(reason string) {
+		v.Problems = append(v.Problems, Problem{Seq: entry.Seq, ID: entry.ID.Hex(), Reason: reason})
+	}
+
+	if entry.Seq != v.lastSeq+1 {
+		problem(fmt.Sprintf("expected seq %d, entries are missing or were reordered", v.lastSeq+1))
+	}
+	if entry.Prev_hash != v.lastHash {
+		problem("prev_hash does not match the hash of the entry before")
+	}
+	if hash, err := Hash(entry); err != nil {
+		problem("entry can't be hashed: " + err.Error())
+	} else if hash != entry.Hash {
+		problem("hash does not match the content, the entry was modified")
+	}
+
+	v.lastSeq = entry.Seq
+	v.lastHash = entry.Hash
+}
+
+// Head is the last entry checked, to be compared with a head recorded elsewhere
+func (v *Verifier) Head() (int64, string) {
+	return v.lastSeq, v.lastHash
+}
+
+// Valid tells whether no problem was found
+func (v *Verifier) Valid() bool {
+	return len(v.Problems) == 0
+}
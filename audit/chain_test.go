@@ -0,0 +1,284 @@
+package audit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testChain builds n linked entries the way helpers.recordAuditEntry does
+func testChain(t *testing.T, n int) []models.AuditEntry {
+	t.Helper()
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	entries := []models.AuditEntry{}
+	prev := GenesisHash
+	for i := 1; i <= n; i++ {
+		entry := models.AuditEntry{
+			ID:         primitive.NewObjectID(),
+			Seq:        int64(i),
+			Action:     "user.disable",
+			Actor_id:   "admin",
+			Target_id:  "user-" + string(rune('a'+i)),
+			Tenant_id:  "acme",
+			Details:    map[string]interface{}{"reason": "left the company", "attempt": i},
+			Changes:    map[string]models.AuditChange{"disabled": {Before: false, After: true}},
+			Created_at: start.Add(time.Duration(i) * time.Minute),
+			Prev_hash:  prev,
+		}
+		hash, err := Hash(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Hash = hash
+		prev = hash
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func verify(entries []models.AuditEntry) *Verifier {
+	verifier := NewVerifier()
+	for _, entry := range entries {
+		verifier.Add(entry)
+	}
+	return verifier
+}
+
+func TestVerifierIntactChain(t *testing.T) {
+	entries := testChain(t, 5)
+	verifier := verify(entries)
+	if !verifier.Valid() || verifier.Checked != 5 {
+		t.Fatalf("problems %v", verifier.Problems)
+	}
+	if seq, hash := verifier.Head(); seq != 5 || hash != entries[4].Hash {
+		t.Fatalf("head %d:%s", seq, hash)
+	}
+
+	if seq, hash := NewVerifier().Head(); seq != 0 || hash != GenesisHash {
+		t.Fatalf("empty head %d:%s", seq, hash)
+	}
+}
+
+func TestVerifierDetectsTampering(t *testing.T) {
+	cases := []struct {
+		name   string
+		tamper func([]models.AuditEntry) []models.AuditEntry
+		// seq of each problem and a part of its reason
+		want []Problem
+	}{
+		{
+			name: "detail modified",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[1].Details["reason"] = "nothing to see"
+				return entries
+			},
+			want: []Problem{{Seq: 2, Reason: "modified"}},
+		},
+		{
+			name: "change modified",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[2].Changes["disabled"] = models.AuditChange{Before: false, After: false}
+				return entries
+			},
+			want: []Problem{{Seq: 3, Reason: "modified"}},
+		},
+		{
+			name: "date modified",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[0].Created_at = entries[0].Created_at.Add(time.Hour)
+				return entries
+			},
+			want: []Problem{{Seq: 1, Reason: "modified"}},
+		},
+		{
+			name: "modified and hashed again",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[1].Actor_id = "someone else"
+				entries[1].Hash, _ = Hash(entries[1])
+				return entries
+			},
+			want: []Problem{{Seq: 3, Reason: "prev_hash"}},
+		},
+		{
+			name: "entry removed",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				return append(entries[:1], entries[2:]...)
+			},
+			want: []Problem{{Seq: 3, Reason: "expected seq 2"}, {Seq: 3, Reason: "prev_hash"}},
+		},
+		{
+			name: "first entry removed",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				return entries[1:]
+			},
+			want: []Problem{{Seq: 2, Reason: "expected seq 1"}, {Seq: 2, Reason: "prev_hash"}},
+		},
+		{
+			name: "entries reordered",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[1], entries[2] = entries[2], entries[1]
+				return entries
+			},
+			want: []Problem{
+				{Seq: 3, Reason: "expected seq 2"}, {Seq: 3, Reason: "prev_hash"},
+				{Seq: 2, Reason: "expected seq 4"}, {Seq: 2, Reason: "prev_hash"},
+				{Seq: 4, Reason: "expected seq 3"}, {Seq: 4, Reason: "prev_hash"},
+			},
+		},
+		{
+			name: "seq renumbered",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[3].Seq = 10
+				return entries
+			},
+			want: []Problem{{Seq: 10, Reason: "expected seq 4"}, {Seq: 10, Reason: "modified"}, {Seq: 5, Reason: "expected seq 11"}},
+		},
+	}
+
+	for _, c := range cases {
+		verifier := verify(c.tamper(testChain(t, 5)))
+		if verifier.Valid() || len(verifier.Problems) != len(c.want) {
+			t.Errorf("%s: got problems %v", c.name, verifier.Problems)
+			continue
+		}
+		for i, want := range c.want {
+			got := verifier.Problems[i]
+			if got.Seq != want.Seq || !strings.Contains(got.Reason, want.Reason) {
+				t.Errorf("%s: problem %d is %v, want seq %d about %q", c.name, i, got, want.Seq, want.Reason)
+			}
+		}
+	}
+}
+
+func TestVerifierMissesEntriesRemovedAtTheEnd(t *testing.T) {
+	// only a head recorded elsewhere (auditverify -anchor) tells
+	entries := testChain(t, 5)
+	verifier := verify(entries[:3])
+	if !verifier.Valid() {
+		t.Fatalf("problems %v", verifier.Problems)
+	}
+	if seq, hash := verifier.Head(); seq != 3 || hash == entries[4].Hash {
+		t.Fatalf("head %d:%s", seq, hash)
+	}
+}
+
+// a hash computed when the entry is written must be found again once mongo has read it back
+func TestHashSurvivesBSONRoundTrip(t *testing.T) {
+	name := "Ada"
+	type profile struct {
+		Region string `json:"region"`
+		Level  int    `json:"level"`
+	}
+
+	entry := models.AuditEntry{
+		ID:        primitive.NewObjectID(),
+		Seq:       7,
+		Action:    "role.save",
+		Actor_id:  "admin",
+		Target_id: "SUPPORT",
+		Tenant_id: "acme",
+		Ip:        "10.0.0.1",
+		Details: map[string]interface{}{
+			"count":    3,
+			"count32":  int32(4),
+			"count64":  int64(5),
+			"ratio":    0.5,
+			"roles":    []string{"ADMIN", "USER"},
+			"mixed":    []interface{}{1, "two", []string{"three"}},
+			"nested":   map[string]interface{}{"at": time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.FixedZone("CEST", 2*3600)), "on": true},
+			"object":   primitive.NewObjectID(),
+			"name":     &name,
+			"nobody":   (*string)(nil),
+			"nothing":  nil,
+			"profile":  profile{Region: "eu", Level: 2},
+			"document": bson.D{{Key: "b", Value: 1}, {Key: "a", Value: bson.A{"x"}}},
+		},
+		Changes: map[string]models.AuditChange{
+			"permissions": {Before: []string{"users:read"}, After: []string{"users:read", "users:write"}},
+			"description": {Before: nil, After: "support staff"},
+		},
+		Created_at: time.Now().Truncate(time.Millisecond),
+		Prev_hash:  GenesisHash,
+	}
+	hash, err := Hash(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Hash = hash
+
+	raw, err := bson.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored models.AuditEntry
+	if err := bson.Unmarshal(raw, &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := Hash(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != hash {
+		t.Fatalf("hash changed from %s to %s after a round trip", hash, again)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	id := primitive.NewObjectID()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 987654321, time.FixedZone("CEST", 2*3600))
+
+	cases := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{nil, nil},
+		{map[string]interface{}(nil), nil},
+		{(*string)(nil), nil},
+		{3, 3.0},
+		{int32(3), 3.0},
+		{int64(3), 3.0},
+		{float32(0.5), 0.5},
+		{"text", "text"},
+		{true, true},
+		{at, "2024-05-01T10:00:00.987Z"},
+		{primitive.NewDateTimeFromTime(at), "2024-05-01T10:00:00.987Z"},
+		{id, id.Hex()},
+		{[]string{"a", "b"}, []interface{}{"a", "b"}},
+		{bson.A{int32(1), "a"}, []interface{}{1.0, "a"}},
+		{bson.M{"a": int64(1)}, map[string]interface{}{"a": 1.0}},
+		{bson.D{{Key: "a", Value: bson.D{{Key: "b", Value: int32(2)}}}}, map[string]interface{}{"a": map[string]interface{}{"b": 2.0}}},
+		{struct {
+			A string `json:"a"`
+			B int    `json:"b"`
+		}{"x", 1}, map[string]interface{}{"a": "x", "b": 1.0}},
+	}
+	for _, c := range cases {
+		if got := Normalize(c.value); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Normalize(%#v) = %#v, want %#v", c.value, got, c.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := map[string]interface{}{"roles": []string{"USER"}, "disabled": false, "count": 1, "gone": "x"}
+	after := map[string]interface{}{"roles": bson.A{"USER"}, "disabled": true, "count": int64(1), "new": "y"}
+
+	want := map[string]models.AuditChange{
+		"disabled": {Before: false, After: true},
+		"gone":     {Before: "x", After: nil},
+		"new":      {Before: nil, After: "y"},
+	}
+	if got := Diff(before, after); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got := Diff(nil, nil); len(got) != 0 {
+		t.Fatalf("got %v", got)
+	}
+}
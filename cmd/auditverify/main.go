@@ -0,0 +1,121 @@
+// Command auditverify checks the hash chain of the audit log and prints its head.
+//
+// It reads MONGODB_URL from .env like the server, so run it from the same directory:
+//
+//	go run ./cmd/auditverify
+//	go run ./cmd/auditverify -anchor 1234:5f2a...   # head recorded earlier, detects entries removed at the end
+//
+// Entries without seq are only accepted from before the chain started: one written after the first chained entry was
+// added outside of the chain. The exit status is 1 when the chain is broken or such an entry is found.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/audit"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	anchor := flag.String("anchor", "", "seq:hash of an entry recorded earlier, it must still be in the chain")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	collection := database.OpenCollection(database.Client, "audit_log")
+
+	legacy, err := collection.CountDocuments(ctx, bson.M{"seq": bson.M{"$exists": false}})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"seq": bson.M{"$exists": true}}, options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cursor.Close(ctx)
+
+	var anchorSeq int64
+	var anchorHash string
+	if *anchor != "" {
+		parts := strings.SplitN(*anchor, ":", 2)
+		anchorSeq, err = strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || len(parts) != 2 {
+			log.Fatal("anchor must be seq:hash")
+		}
+		anchorHash = parts[1]
+	}
+	anchorFound := false
+
+	var chainStart time.Time
+	verifier := audit.NewVerifier()
+	for cursor.Next(ctx) {
+		var entry models.AuditEntry
+		if err := cursor.Decode(&entry); err != nil {
+			log.Fatal(err)
+		}
+		if verifier.Checked == 0 {
+			chainStart = entry.Created_at
+		}
+		verifier.Add(entry)
+
+		if entry.Seq == anchorSeq && anchorSeq > 0 {
+			anchorFound = entry.Hash == anchorHash
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, problem := range verifier.Problems {
+		fmt.Println("BROKEN", problem)
+	}
+
+	// entries without seq that are newer than the chain were slipped in (or had their seq removed)
+	var unchained int64
+	if verifier.Checked > 0 {
+		cursor, err := collection.Find(ctx, bson.M{"seq": bson.M{"$exists": false}, "created_at": bson.M{"$gt": chainStart}},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for cursor.Next(ctx) {
+			var entry models.AuditEntry
+			if err := cursor.Decode(&entry); err != nil {
+				log.Fatal(err)
+			}
+			unchained++
+			fmt.Printf("BROKEN entry %s (%s at %s) has no seq but was written after the chain started at %s\n",
+				entry.ID.Hex(), entry.Action, entry.Created_at.UTC().Format(time.RFC3339), chainStart.UTC().Format(time.RFC3339))
+		}
+		if err := cursor.Err(); err != nil {
+			log.Fatal(err)
+		}
+		cursor.Close(ctx)
+	}
+	if *anchor != "" && !anchorFound {
+		fmt.Printf("BROKEN anchor %d:%s is not in the chain, entries were removed or modified\n", anchorSeq, anchorHash)
+	}
+
+	seq, hash := verifier.Head()
+	fmt.Printf("checked %d entries, head %d:%s\n", verifier.Checked, seq, hash)
+	if legacy > unchained {
+		fmt.Printf("%d entries written before the chain existed are not covered\n", legacy-unchained)
+	}
+
+	if !verifier.Valid() || (*anchor != "" && !anchorFound) || unchained > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("audit log is intact")
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/abac"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// explainPolicyRequest is a dry run, nothing is accessed. Without subject_user_id the caller is the subject.
+type explainPolicyRequest struct {
+	Action           string     `json:"action" validate:"required"`
+	Resource_user_id string     `json:"resource_user_id"`
+	Subject_user_id  string     `json:"subject_user_id"`
+	Ip               string     `json:"ip" validate:"omitempty,ip"`
+	Time             *time.Time `json:"time"` // pretend the request happens at this time
+}
+
+func ListPolicies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		rules, loadedAt := helper.PolicyEngine().Rules()
+		c.JSON(http.StatusOK, gin.H{"dir": helper.PolicyEngine().Dir, "loaded_at": loadedAt, "rules": rules})
+	}
+}
+
+// ReloadPolicies reads the policy files again, a broken file is reported and the old rules stay in use
+func ReloadPolicies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if err := helper.PolicyEngine().Reload(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_policy"})
+			return
+		}
+
+		rules, loadedAt := helper.PolicyEngine().Rules()
+		helper.RecordAudit(c, helper.AuditPolicyReload, "", c.GetString("tenant_id"), map[string]interface{}{"rules": len(rules)})
+		c.JSON(http.StatusOK, gin.H{"loaded_at": loadedAt, "rules": len(rules)})
+	}
+}
+
+// ExplainPolicy evaluates the rules without doing anything and tells which rules matched and why
+func ExplainPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req explainPolicyRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		subject := helper.SubjectAttributes(c)
+		if req.Subject_user_id != "" {
+			var user models.User
+			if err := userCollection.FindOne(ctx, helper.ScopedUserFilter(c, bson.M{"user_id": req.Subject_user_id})).Decode(&user); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "subject user not found"})
+				return
+			}
+			subject = helper.SubjectFromUser(user)
+		}
+
+		resource := abac.Attributes{}
+		if req.Resource_user_id != "" {
+			var err error
+			resource, err = helper.LoadResourceAttributes(ctx, helper.ScopedUserFilter(c, bson.M{"user_id": req.Resource_user_id}))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the resource"})
+				return
+			}
+		}
+
+		now := time.Now()
+		if req.Time != nil {
+			now = *req.Time
+		}
+		env := helper.EnvironmentAttributes(c, now)
+		if req.Ip != "" {
+			env["ip"] = req.Ip
+		}
+
+		request := abac.Request{Action: req.Action, Subject: subject, Resource: resource, Env: env}
+		c.JSON(http.StatusOK, gin.H{"request": request, "decision": helper.PolicyEngine().Evaluate(request)})
+	}
+}
@@ -0,0 +1,406 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/mailer"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var auditCollection *mongo.Collection = database.OpenCollection(database.Client, "audit_log")
+
+type adminCreateUserRequest struct {
+	First_name string   `json:"first_name" validate:"required,min=2,max=100"`
+	Last_name  string   `json:"last_name" validate:"required,min=2,max=100"`
+	Email      string   `json:"email" validate:"required,email"`
+	Phone      string   `json:"phone" validate:"required"`
+	Password   string   `json:"password" validate:"required"`
+	Roles      []string `json:"roles" validate:"omitempty,dive,required"` // USER when empty
+	Tenant_id  string   `json:"tenant_id"`                                // only a SUPER_ADMIN can create users in another organization
+}
+
+type disableUserRequest struct {
+	Reason string `json:"reason" validate:"max=200"`
+}
+
+// findManagedUser loads the user of :user_id for an admin action, answering the request itself when it can't be done.
+// Users of other organizations are not found, a SUPER_ADMIN can only be managed by another SUPER_ADMIN, and nobody can
+// manage a user holding permissions they do not have (an ORG_ADMIN can't disable or demote an ADMIN).
+func findManagedUser(c *gin.Context, ctx context.Context) (models.User, bool) {
+	var user models.User
+	err := userCollection.FindOne(ctx, helper.ScopedUserFilter(c, bson.M{"user_id": c.Param("user_id")})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return user, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the user"})
+		return user, false
+	}
+
+	for _, role := range helper.UserRoles(user) {
+		if role == helper.RoleSuperAdmin && !helper.CrossTenant(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only a SUPER_ADMIN can manage a SUPER_ADMIN"})
+			return user, false
+		}
+	}
+
+	permissions, err := helper.EffectivePermissions(ctx, *user.User_id, helper.TenantOf(user), helper.UserRoles(user))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while resolving permissions"})
+		return user, false
+	}
+	notHeld, err := notHeldPermissions(c, ctx, permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking permissions"})
+		return user, false
+	}
+	if len(notHeld) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can not manage a user with permissions you do not have", "permissions": notHeld})
+		return user, false
+	}
+	return user, true
+}
+
+// AdminCreateUser creates an account directly, with any role the admin is allowed to give
+func AdminCreateUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req adminCreateUserRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		phone, err := helper.NormalizePhone(req.Phone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tenantId := helper.NormalizeTenant(c.GetString("tenant_id"))
+		if req.Tenant_id != "" && req.Tenant_id != tenantId {
+			if !helper.CrossTenant(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "you can only create users in your own organization"})
+				return
+			}
+			tenantId = req.Tenant_id
+		}
+		if exists, err := helper.TenantExists(ctx, tenantId); err != nil || !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "organization does not exist", "code": "unknown_tenant"})
+			return
+		}
+
+		if len(req.Roles) == 0 {
+			req.Roles = []string{"USER"}
+		}
+		if !checkAssignableRoles(c, ctx, tenantId, req.Roles) {
+			return
+		}
+
+		userType := req.Roles[0]
+		user := models.User{
+			First_name: &req.First_name,
+			Last_name:  &req.Last_name,
+			Email:      &req.Email,
+			Phone:      &phone,
+			User_type:  &userType,
+			Roles:      req.Roles,
+			Tenant_id:  &tenantId,
+		}
+		if violations := helper.DefaultPasswordPolicy().CheckPassword(req.Password, passwordOwner(user)); len(violations) > 0 {
+			abortPasswordPolicy(c, violations)
+			return
+		}
+
+		if taken, err := emailOrPhoneTaken(ctx, tenantId, req.Email, phone); err != nil || taken {
+			abortEmailOrPhoneTaken(c, err)
+			return
+		}
+
+		password := HashPassword(req.Password)
+		user.Password = &password
+		user.ID = primitive.NewObjectID()
+		userId := user.ID.Hex()
+		user.User_id = &userId
+		user.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		user.Updated_at = user.Created_at
+
+		if _, err := userCollection.InsertOne(ctx, user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User item was not created"})
+			return
+		}
+
+		// the user still has to prove the email, like after a signup
+		go sendEmailVerification(user, mailer.LocaleFromHeader(c.GetHeader("Accept-Language")))
+
+		helper.RecordAudit(c, helper.AuditUserCreate, userId, tenantId, map[string]interface{}{"email": req.Email, "roles": req.Roles})
+		emitUserEvent(helper.WebhookUserCreated, user, map[string]interface{}{"source": "admin", "roles": req.Roles})
+		c.JSON(http.StatusCreated, gin.H{"user_id": userId})
+	}
+}
+
+// DisableUser refuses any further login of the user and revokes the tokens already issued
+func DisableUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		// the body with the reason is optional
+		var req disableUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if c.Param("user_id") == c.GetString("uid") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "you can not disable your own account"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := findManagedUser(c, ctx)
+		if !ok {
+			return
+		}
+
+		Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if _, err := userCollection.UpdateOne(ctx, bson.M{"user_id": *user.User_id}, bson.M{"$set": bson.M{
+			"disabled":        true,
+			"disabled_reason": req.Reason,
+			"updated_at":      Updated_at,
+		}}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while disabling the account"})
+			return
+		}
+		if err := helper.RevokeUserTokens(ctx, *user.User_id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while revoking the tokens"})
+			return
+		}
+
+		helper.RecordAuditChange(c, helper.AuditUserDisable, *user.User_id, helper.TenantOf(user),
+			map[string]interface{}{"disabled": user.Disabled, "disabled_reason": user.Disabled_reason},
+			map[string]interface{}{"disabled": true, "disabled_reason": req.Reason})
+		emitUserEvent(helper.WebhookUserDisabled, user, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "account disabled"})
+	}
+}
+
+func EnableUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := findManagedUser(c, ctx)
+		if !ok {
+			return
+		}
+
+		Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if _, err := userCollection.UpdateOne(ctx, bson.M{"user_id": *user.User_id}, bson.M{
+			"$set":   bson.M{"disabled": false, "updated_at": Updated_at},
+			"$unset": bson.M{"disabled_reason": ""},
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while enabling the account"})
+			return
+		}
+		helper.InvalidateAccountState(*user.User_id)
+
+		helper.RecordAuditChange(c, helper.AuditUserEnable, *user.User_id, helper.TenantOf(user),
+			map[string]interface{}{"disabled": user.Disabled, "disabled_reason": user.Disabled_reason},
+			map[string]interface{}{"disabled": false, "disabled_reason": nil})
+		emitUserEvent(helper.WebhookUserEnabled, user, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "account enabled"})
+	}
+}
+
+// DeleteUser removes an account for good, with its passkeys, sessions and group memberships.
+// The audit entry keeps what the account looked like.
+func DeleteUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if c.Param("user_id") == c.GetString("uid") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "you can not delete your own account"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := findManagedUser(c, ctx)
+		if !ok {
+			return
+		}
+
+		if _, err := userCollection.DeleteOne(ctx, bson.M{"user_id": *user.User_id}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while deleting the account"})
+			return
+		}
+
+		// the account is gone already, what is left behind is only logged
+		if _, err := helper.RevokeSessions(ctx, bson.M{"user_id": *user.User_id}); err != nil {
+			log.Println("could not revoke the sessions of a deleted user:", err)
+		}
+		if _, err := webauthnCollection.DeleteMany(ctx, bson.M{"user_id": *user.User_id}); err != nil {
+			log.Println("could not remove the passkeys of a deleted user:", err)
+		}
+		if _, err := groupCollection.UpdateMany(ctx, bson.M{"members": *user.User_id}, bson.M{"$pull": bson.M{"members": *user.User_id}}); err != nil {
+			log.Println("could not remove a deleted user from its groups:", err)
+		}
+		helper.InvalidateAccountState(*user.User_id)
+		helper.InvalidateUserPermissions(*user.User_id)
+
+		helper.RecordAuditChange(c, helper.AuditUserDelete, *user.User_id, helper.TenantOf(user),
+			map[string]interface{}{"user": models.NewUserAdminView(user)}, nil)
+		emitUserEvent(helper.WebhookUserDeleted, user, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "account deleted"})
+	}
+}
+
+// ResetUserMfa removes every second factor (TOTP, recovery codes and passkeys), for users who lost their device.
+// The user is logged out so the next login only asks for the password.
+func ResetUserMfa() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := findManagedUser(c, ctx)
+		if !ok {
+			return
+		}
+
+		Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if _, err := userCollection.UpdateOne(ctx, bson.M{"user_id": *user.User_id}, bson.M{
+			"$set":   bson.M{"mfa_enabled": false, "updated_at": Updated_at},
+			"$unset": bson.M{"mfa_secret": "", "mfa_pending_secret": "", "mfa_recovery_codes": "", "mfa_last_step": ""},
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while resetting mfa"})
+			return
+		}
+
+		removed, err := webauthnCollection.DeleteMany(ctx, bson.M{"user_id": *user.User_id})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while removing passkeys"})
+			return
+		}
+		if err := helper.RevokeUserTokens(ctx, *user.User_id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while revoking the tokens"})
+			return
+		}
+
+		helper.RecordSecurityEvent(c, *user.User_id, helper.TenantOf(user), helper.SecurityMfaReset, helper.OutcomeSuccess, map[string]interface{}{"by": c.GetString("uid")})
+		helper.RecordAudit(c, helper.AuditUserMfaReset, *user.User_id, helper.TenantOf(user), map[string]interface{}{
+			"totp_was_enabled": user.Mfa_enabled,
+			"passkeys_removed": removed.DeletedCount,
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "mfa reset", "passkeys_removed": removed.DeletedCount})
+	}
+}
+
+// ForceLogout revokes every token of the user, on every device
+func ForceLogout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := findManagedUser(c, ctx)
+		if !ok {
+			return
+		}
+
+		if err := helper.RevokeUserTokens(ctx, *user.User_id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while revoking the tokens"})
+			return
+		}
+
+		helper.RecordAudit(c, helper.AuditUserLogout, *user.User_id, helper.TenantOf(user), nil)
+		c.JSON(http.StatusOK, gin.H{"message": "user logged out everywhere"})
+	}
+}
+
+// UnlockUser clears the failed login counters of an account, the route needs users:write
+func UnlockUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := findManagedUser(c, ctx)
+		if !ok {
+			return
+		}
+
+		if err := helper.UnlockAccount(helper.LoginAccount(helper.TenantOf(user), *user.Email)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while unlocking the account"})
+			return
+		}
+
+		helper.RecordAudit(c, helper.AuditUserUnlock, *user.User_id, helper.TenantOf(user), nil)
+		c.JSON(http.StatusOK, gin.H{"message": "account unlocked"})
+	}
+}
+
+// ListAuditLog returns the admin actions of the organization, newest first. ?target_id= and ?action= filter it.
+func ListAuditLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit < 1 || limit > 500 {
+			limit = 100
+		}
+
+		filter := bson.M{}
+		if !helper.CrossTenant(c) {
+			filter["tenant_id"] = helper.NormalizeTenant(c.GetString("tenant_id"))
+		}
+		if targetId := c.Query("target_id"); targetId != "" {
+			filter["target_id"] = targetId
+		}
+		if action := c.Query("action"); action != "" {
+			filter["action"] = action
+		}
+
+		cursor, err := auditCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the audit log"})
+			return
+		}
+
+		entries := []models.AuditEntry{}
+		if err := cursor.All(ctx, &entries); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the audit log"})
+			return
+		}
+		c.JSON(http.StatusOK, entries)
+	}
+}
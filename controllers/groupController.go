@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var groupCollection *mongo.Collection = database.OpenCollection(database.Client, "groups")
+
+type updateGroupRequest struct {
+	Name        *string  `json:"name" validate:"omitempty,min=2,max=100"`
+	Description *string  `json:"description" validate:"omitempty,max=200"`
+	Permissions []string `json:"permissions" validate:"omitempty,dive,required"`
+}
+
+type groupMembersRequest struct {
+	User_ids []string `json:"user_ids" validate:"required,min=1,dive,required"`
+}
+
+// checkGroupPermissions answers the request itself when the permissions can't be put on a group:
+// they must exist, and nobody can hand out through a group more than what they hold
+func checkGroupPermissions(c *gin.Context, ctx context.Context, permissions []string) bool {
+	unknown, err := unknownNames(ctx, permissionCollection, bson.M{}, "_id", permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking permissions"})
+		return false
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown permissions", "permissions": unknown})
+		return false
+	}
+
+	notHeld, err := notHeldPermissions(c, ctx, permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking permissions"})
+		return false
+	}
+	if len(notHeld) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can not grant permissions you do not have", "permissions": notHeld})
+		return false
+	}
+	return true
+}
+
+// checkGroupHeld answers the request itself when the group grants permissions the caller does not have.
+// Such a group can't be managed by the caller, joining it would otherwise be a way to get them.
+func checkGroupHeld(c *gin.Context, ctx context.Context, group models.Group) bool {
+	notHeld, err := notHeldPermissions(c, ctx, group.Permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking permissions"})
+		return false
+	}
+	if len(notHeld) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can not manage a group with permissions you do not have", "permissions": notHeld})
+		return false
+	}
+	return true
+}
+
+// findGroup loads a group of the caller's organization, answering 404 itself
+func findGroup(c *gin.Context, ctx context.Context) (models.Group, bool) {
+	var group models.Group
+	err := groupCollection.FindOne(ctx, helper.ScopedUserFilter(c, bson.M{"group_id": c.Param("group_id")})).Decode(&group)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return group, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the group"})
+		return group, false
+	}
+	return group, true
+}
+
+func ListGroups() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := groupCollection.Find(ctx, helper.ScopedUserFilter(c, bson.M{}), options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing groups"})
+			return
+		}
+
+		groups := []models.Group{}
+		if err := cursor.All(ctx, &groups); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing groups"})
+			return
+		}
+		c.JSON(http.StatusOK, groups)
+	}
+}
+
+func GetGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if group, ok := findGroup(c, ctx); ok {
+			c.JSON(http.StatusOK, group)
+		}
+	}
+}
+
+// CreateGroup adds a group to the organization of the caller, members are added afterwards
+func CreateGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var group models.Group
+		if err := c.BindJSON(&group); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(group); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if group.Permissions == nil {
+			group.Permissions = []string{}
+		}
+		if !checkGroupPermissions(c, ctx, group.Permissions) {
+			return
+		}
+
+		group.ID = primitive.NewObjectID()
+		groupId := group.ID.Hex()
+		group.Group_id = &groupId
+		tenantId := helper.NormalizeTenant(c.GetString("tenant_id"))
+		group.Tenant_id = &tenantId
+		group.Members = []string{}
+		group.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		group.Updated_at = group.Created_at
+
+		if _, err := groupCollection.InsertOne(ctx, group); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "a group with this name already exists"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the group"})
+			return
+		}
+
+		helper.RecordAuditChange(c, helper.AuditGroupCreate, groupId, tenantId, nil, groupAuditFields(group))
+		c.JSON(http.StatusCreated, group)
+	}
+}
+
+// UpdateGroup changes the name, description or permissions, the members get the new permissions right away
+func UpdateGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req updateGroupRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		group, ok := findGroup(c, ctx)
+		if !ok || !checkGroupHeld(c, ctx, group) {
+			return
+		}
+
+		Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		update := bson.M{"updated_at": Updated_at}
+		if req.Name != nil {
+			update["name"] = *req.Name
+		}
+		if req.Description != nil {
+			update["description"] = *req.Description
+		}
+		if req.Permissions != nil {
+			if !checkGroupPermissions(c, ctx, req.Permissions) {
+				return
+			}
+			update["permissions"] = req.Permissions
+		}
+
+		before := groupAuditFields(group)
+		after := options.After
+		err := groupCollection.FindOneAndUpdate(ctx, bson.M{"group_id": *group.Group_id}, bson.M{"$set": update},
+			&options.FindOneAndUpdateOptions{ReturnDocument: &after}).Decode(&group)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "a group with this name already exists"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while updating the group"})
+			return
+		}
+
+		helper.InvalidateUserPermissions(group.Members...)
+		helper.RecordAuditChange(c, helper.AuditGroupUpdate, *group.Group_id, *group.Tenant_id, before, groupAuditFields(group))
+		c.JSON(http.StatusOK, group)
+	}
+}
+
+func DeleteGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		group, ok := findGroup(c, ctx)
+		if !ok || !checkGroupHeld(c, ctx, group) {
+			return
+		}
+
+		if _, err := groupCollection.DeleteOne(ctx, bson.M{"group_id": *group.Group_id}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while deleting the group"})
+			return
+		}
+
+		helper.InvalidateUserPermissions(group.Members...)
+		before := groupAuditFields(group)
+		before["members"] = group.Members
+		helper.RecordAuditChange(c, helper.AuditGroupDelete, *group.Group_id, *group.Tenant_id, before, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "group deleted"})
+	}
+}
+
+// AddGroupMembers adds users of the same organization to a group
+func AddGroupMembers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req groupMembersRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		group, ok := findGroup(c, ctx)
+		if !ok || !checkGroupHeld(c, ctx, group) {
+			return
+		}
+		before := map[string]interface{}{"members": group.Members}
+
+		// the members must belong to the organization of the group, not just to the one of the caller
+		count, err := userCollection.CountDocuments(ctx, helper.ScopeToTenant(*group.Tenant_id, bson.M{"user_id": bson.M{"$in": req.User_ids}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the users"})
+			return
+		}
+		if int(count) != len(helper.UniqueStrings(req.User_ids)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "some users do not exist in this organization"})
+			return
+		}
+
+		after := options.After
+		err = groupCollection.FindOneAndUpdate(ctx, bson.M{"group_id": *group.Group_id}, bson.M{
+			"$addToSet": bson.M{"members": bson.M{"$each": req.User_ids}},
+			"$set":      bson.M{"updated_at": time.Now().UTC()},
+		}, &options.FindOneAndUpdateOptions{ReturnDocument: &after}).Decode(&group)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while adding members"})
+			return
+		}
+
+		helper.InvalidateUserPermissions(req.User_ids...)
+		helper.RecordAuditChange(c, helper.AuditGroupMembers, *group.Group_id, *group.Tenant_id, before, map[string]interface{}{"members": group.Members})
+		c.JSON(http.StatusOK, group)
+	}
+}
+
+func RemoveGroupMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		group, ok := findGroup(c, ctx)
+		if !ok || !checkGroupHeld(c, ctx, group) {
+			return
+		}
+
+		userId := c.Param("user_id")
+		before := map[string]interface{}{"members": group.Members}
+		after := options.After
+		err := groupCollection.FindOneAndUpdate(ctx, bson.M{"group_id": *group.Group_id}, bson.M{
+			"$pull": bson.M{"members": userId},
+			"$set":  bson.M{"updated_at": time.Now().UTC()},
+		}, &options.FindOneAndUpdateOptions{ReturnDocument: &after}).Decode(&group)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while removing the member"})
+			return
+		}
+
+		helper.InvalidateUserPermissions(userId)
+		helper.RecordAuditChange(c, helper.AuditGroupMembers, *group.Group_id, *group.Tenant_id, before, map[string]interface{}{"members": group.Members})
+		c.JSON(http.StatusOK, group)
+	}
+}
+
+// GetUserPermissions shows what a user may do and where it comes from
+func GetUserPermissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, helper.ScopedUserFilter(c, bson.M{"user_id": c.Param("user_id")})).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		roles := helper.UserRoles(user)
+		effective, err := helper.EffectivePermissions(ctx, *user.User_id, helper.TenantOf(user), roles)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while resolving permissions"})
+			return
+		}
+
+		cursor, err := groupCollection.Find(ctx, bson.M{"members": *user.User_id},
+			options.Find().SetProjection(bson.M{"group_id": 1, "name": 1, "permissions": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing groups"})
+			return
+		}
+		groups := []bson.M{}
+		if err := cursor.All(ctx, &groups); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing groups"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"user_id": *user.User_id, "roles": roles, "groups": groups, "permissions": effective})
+	}
+}
+
+// groupAuditFields are the fields of a group compared in the audit log, members are logged by their own actions
+func groupAuditFields(group models.Group) map[string]interface{} {
+	return map[string]interface{}{"name": group.Name, "description": group.Description, "permissions": group.Permissions}
+}
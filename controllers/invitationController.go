@@ -0,0 +1,312 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/mailer"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var invitationCollection *mongo.Collection = database.OpenCollection(database.Client, "invitations")
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+)
+
+type createInvitationRequest struct {
+	Email     string   `json:"email" validate:"required,email"`
+	Roles     []string `json:"roles" validate:"omitempty,dive,required"` // USER when empty
+	Tenant_id string   `json:"tenant_id"`                                // only a SUPER_ADMIN can invite into another organization
+}
+
+type acceptInvitationRequest struct {
+	Token      string `json:"token" validate:"required"`
+	First_name string `json:"first_name" validate:"required,min=2,max=100"`
+	Last_name  string `json:"last_name" validate:"required,min=2,max=100"`
+	Password   string `json:"password" validate:"required"`
+	Phone      string `json:"phone" validate:"required"`
+}
+
+func invitationTTL() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("INVITATION_TTL_HOURS"))
+	if err != nil || hours < 1 {
+		hours = 72
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// CreateInvitation mails a signed invitation, the roles and organization are fixed by the admin
+func CreateInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req createInvitationRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tenantId := helper.NormalizeTenant(c.GetString("tenant_id"))
+		if req.Tenant_id != "" && req.Tenant_id != tenantId {
+			if !helper.CrossTenant(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "you can only invite into your own organization"})
+				return
+			}
+			tenantId = req.Tenant_id
+		}
+		if exists, err := helper.TenantExists(ctx, tenantId); err != nil || !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "organization does not exist", "code": "unknown_tenant"})
+			return
+		}
+
+		if len(req.Roles) == 0 {
+			req.Roles = []string{"USER"}
+		}
+		if !checkAssignableRoles(c, ctx, tenantId, req.Roles) {
+			return
+		}
+
+		count, err := userCollection.CountDocuments(ctx, helper.ScopeToTenant(tenantId, bson.M{"email": req.Email}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking for the email"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "this email already has an account in the organization"})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		invitation := models.Invitation{
+			ID:         primitive.NewObjectID(),
+			Tenant_id:  &tenantId,
+			Email:      &req.Email,
+			Roles:      req.Roles,
+			Status:     InvitationPending,
+			Expires_at: now.Add(invitationTTL()),
+			Created_at: now,
+			Updated_at: now,
+		}
+		invitationId := invitation.ID.Hex()
+		invitation.Invitation_id = &invitationId
+		inviter := c.GetString("uid")
+		invitation.Invited_by = &inviter
+
+		if _, err := invitationCollection.InsertOne(ctx, invitation); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the invitation"})
+			return
+		}
+
+		jti, err := helper.IssueOneTimeToken(helper.PurposeInvitation, invitationId, invitationTTL())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the invitation"})
+			return
+		}
+		token, err := helper.GenerateInvitationToken(invitation, jti, invitationTTL())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the invitation"})
+			return
+		}
+
+		inviterName := c.GetString("first_name") + " " + c.GetString("last_name")
+		go sendInvitation(invitation, inviterName, token, mailer.LocaleFromHeader(c.GetHeader("Accept-Language")))
+
+		helper.RecordAudit(c, helper.AuditInviteCreate, *invitation.Invitation_id, *invitation.Tenant_id,
+			map[string]interface{}{"email": *invitation.Email, "roles": invitation.Roles})
+		c.JSON(http.StatusCreated, invitation)
+	}
+}
+
+func sendInvitation(invitation models.Invitation, inviterName string, token string, locale string) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	organization := *invitation.Tenant_id
+	var org models.Organization
+	if err := organizationCollection.FindOne(ctx, bson.M{"tenant_id": organization}).Decode(&org); err == nil && org.Name != nil {
+		organization = *org.Name
+	}
+
+	msg, err := mailer.Render("invitation", locale, *invitation.Email, gin.H{
+		"Inviter":      inviterName,
+		"Organization": organization,
+		"Link":         appBaseURL() + "/accept-invite?token=" + token,
+		"TTL":          invitationTTL().String(),
+	})
+	if err != nil {
+		log.Println("could not render invitation email:", err)
+		return
+	}
+
+	if err := mailer.Send(ctx, msg); err != nil {
+		log.Println("could not send invitation email:", err)
+	}
+}
+
+// ListInvitations shows the invitations of the organization, the newest first
+func ListInvitations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := helper.ScopedUserFilter(c, bson.M{})
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		cursor, err := invitationCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing invitations"})
+			return
+		}
+
+		invitations := []models.Invitation{}
+		if err := cursor.All(ctx, &invitations); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing invitations"})
+			return
+		}
+		c.JSON(http.StatusOK, invitations)
+	}
+}
+
+// RevokeInvitation makes a pending invitation unusable
+func RevokeInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		invitationId := c.Param("invitation_id")
+		result, err := invitationCollection.UpdateOne(ctx,
+			helper.ScopedUserFilter(c, bson.M{"invitation_id": invitationId, "status": InvitationPending}),
+			bson.M{"$set": bson.M{"status": InvitationRevoked, "updated_at": time.Now().UTC()}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while revoking the invitation"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no pending invitation found"})
+			return
+		}
+
+		if err := helper.RevokeOneTimeTokens(helper.PurposeInvitation, invitationId); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while revoking the invitation"})
+			return
+		}
+		helper.RecordAuditChange(c, helper.AuditInviteRevoke, invitationId, c.GetString("tenant_id"),
+			map[string]interface{}{"status": InvitationPending}, map[string]interface{}{"status": InvitationRevoked})
+		c.JSON(http.StatusOK, gin.H{"message": "invitation revoked"})
+	}
+}
+
+// AcceptInvitation creates the account of the invitee, who only chooses the password and profile.
+// Email, organization and roles come from the signed invitation.
+func AcceptInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req acceptInvitationRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		claims, msg := helper.ValidateToken(req.Token)
+		if msg != "" || claims.Scope != helper.ScopeInvitation || claims.Id == "" || len(claims.Roles) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invitation is invalid or has expired", "code": "invalid_invitation"})
+			return
+		}
+
+		// the token is only looked at first, so a rejected password or phone does not burn the invitation
+		invitationId, err := helper.PeekOneTimeToken(helper.PurposeInvitation, claims.Id)
+		if err != nil || invitationId != claims.Uid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invitation is invalid or has already been used", "code": "invalid_invitation"})
+			return
+		}
+
+		phone, err := helper.NormalizePhone(req.Phone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userType := claims.Roles[0]
+		user := models.User{
+			First_name: &req.First_name,
+			Last_name:  &req.Last_name,
+			Email:      &claims.Email,
+			Phone:      &phone,
+			User_type:  &userType,
+			Roles:      claims.Roles,
+			Tenant_id:  &claims.Tenant_id,
+		}
+		if violations := helper.DefaultPasswordPolicy().CheckPassword(req.Password, passwordOwner(user)); len(violations) > 0 {
+			abortPasswordPolicy(c, violations)
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if taken, err := emailOrPhoneTaken(ctx, claims.Tenant_id, claims.Email, phone); err != nil || taken {
+			abortEmailOrPhoneTaken(c, err)
+			return
+		}
+
+		if _, err := helper.ConsumeOneTimeToken(helper.PurposeInvitation, claims.Id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invitation is invalid or has already been used", "code": "invalid_invitation"})
+			return
+		}
+
+		password := HashPassword(req.Password)
+		user.Password = &password
+		user.ID = primitive.NewObjectID()
+		userId := user.ID.Hex()
+		user.User_id = &userId
+		user.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		user.Updated_at = user.Created_at
+		user.Email_verified = true // the invitation was opened from the mailbox
+
+		if _, err := userCollection.InsertOne(ctx, user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User item was not created"})
+			return
+		}
+
+		if _, err := invitationCollection.UpdateOne(ctx, bson.M{"invitation_id": invitationId}, bson.M{"$set": bson.M{
+			"status":     InvitationAccepted,
+			"user_id":    userId,
+			"updated_at": time.Now().UTC(),
+		}}); err != nil {
+			log.Println("could not mark invitation as accepted:", err)
+		}
+		emitUserEvent(helper.WebhookUserCreated, user, map[string]interface{}{"source": "invitation", "roles": user.Roles, "invitation_id": invitationId})
+
+		issueLoginTokens(c, ctx, user, "invitation")
+	}
+}
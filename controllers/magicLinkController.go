@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/mailer"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// the nonce cookie ties the link to the browser that asked for it, a link forwarded or intercepted is useless elsewhere
+const magicLinkCookie = "magic_link_nonce"
+
+const magicLinkResponse = "if an account exists for this email, a login link has been sent, open it in this browser"
+
+type magicLinkRequest struct {
+	Email     string `json:"email" validate:"required,email"`
+	Tenant_id string `json:"tenant_id"`
+}
+
+func magicLinkTTL() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("MAGIC_LINK_TTL_MINUTES"))
+	if err != nil || minutes < 1 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// RequestMagicLink mails a one time login link, the response is the same whether the account exists or not
+func RequestMagicLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req magicLinkRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		nonce, err := helper.RandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the login link"})
+			return
+		}
+
+		secure := requestIsHTTPS(c)
+		c.SetSameSite(http.SameSiteLaxMode) // Lax, so the cookie is sent when the link is opened from the mail client
+		c.SetCookie(magicLinkCookie, nonce, int(magicLinkTTL().Seconds()), "/users/login/magic", "", secure, true)
+
+		go sendMagicLink(req.Tenant_id, req.Email, helper.HashToken(nonce), mailer.LocaleFromHeader(c.GetHeader("Accept-Language")))
+
+		c.JSON(http.StatusOK, gin.H{"message": magicLinkResponse})
+	}
+}
+
+func sendMagicLink(tenantId string, email string, nonceHash string, locale string) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, helper.ScopeToTenant(tenantId, bson.M{"email": email})).Decode(&user); err != nil {
+		return
+	}
+
+	jti, err := helper.IssueBoundOneTimeToken(helper.PurposeMagicLink, *user.User_id, nonceHash, magicLinkTTL())
+	if err != nil {
+		log.Println("could not issue magic link token:", err)
+		return
+	}
+
+	token, err := helper.GenerateMagicLinkToken(*user.User_id, jti, magicLinkTTL())
+	if err != nil {
+		log.Println("could not sign magic link:", err)
+		return
+	}
+
+	msg, err := mailer.Render("magic_link", locale, email, gin.H{
+		"Name": *user.First_name,
+		"Link": apiBaseURL() + "/users/login/magic/callback?token=" + token,
+		"TTL":  magicLinkTTL().String(),
+	})
+	if err != nil {
+		log.Println("could not render magic link email:", err)
+		return
+	}
+
+	if err := mailer.Send(ctx, msg); err != nil {
+		log.Println("could not send magic link email:", err)
+	}
+}
+
+// MagicLinkCallback exchanges the link for the usual token pair, in the browser that requested it
+func MagicLinkCallback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		claims, msg := helper.ValidateToken(c.Query("token"))
+		if msg != "" || claims.Scope != helper.ScopeMagicLink || claims.Id == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "login link is invalid or has expired"})
+			return
+		}
+
+		nonce, err := c.Cookie(magicLinkCookie)
+		if err != nil || nonce == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "kindly open the login link in the browser you requested it from", "code": "browser_mismatch"})
+			return
+		}
+
+		// consuming first means a link tried from the wrong browser is burnt too, so a stolen link can't be retried
+		token, err := helper.ConsumeBoundOneTimeToken(helper.PurposeMagicLink, claims.Id)
+		if err != nil || token.User_id != claims.Uid {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "login link is invalid or has already been used"})
+			return
+		}
+		if token.Binding != helper.HashToken(nonce) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "kindly open the login link in the browser you requested it from", "code": "browser_mismatch"})
+			return
+		}
+
+		c.SetCookie(magicLinkCookie, "", -1, "/users/login/magic", "", requestIsHTTPS(c), true)
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": claims.Uid}).Decode(&user); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+
+		// opening the link proves the user owns the email
+		if !user.Email_verified {
+			if _, err := userCollection.UpdateOne(ctx, bson.M{"user_id": claims.Uid}, bson.M{"$set": bson.M{"email_verified": true}}); err == nil {
+				user.Email_verified = true
+				emitUserEvent(helper.WebhookUserEmailVerified, user, nil)
+			}
+		}
+
+		// the link replaces the password only, a second factor is still asked for
+		if challengeSecondFactor(c, ctx, user) {
+			return
+		}
+
+		issueLoginTokens(c, ctx, user, "magic_link")
+	}
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const recoveryCodeCount = 10
+
+type confirmMfaRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type loginMfaRequest struct {
+	Mfa_token     string `json:"mfa_token" validate:"required"`
+	Code          string `json:"code" validate:"required_without=Recovery_code"`
+	Recovery_code string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+func mfaIssuer() string {
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "golang-jwt-project"
+}
+
+// EnrollMfa creates a new TOTP secret for the logged in user. It is only used once confirmed with ConfirmMfa.
+func EnrollMfa() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		uid := c.GetString("uid")
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": uid}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		if user.Mfa_enabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is already enabled"})
+			return
+		}
+
+		secret, err := helper.GenerateTOTPSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the secret"})
+			return
+		}
+
+		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": uid}, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "mfa_pending_secret", Value: secret},
+		}}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while saving the secret"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":      secret,
+			"otpauth_uri": helper.TOTPURI(mfaIssuer(), *user.Email, secret),
+		})
+	}
+}
+
+// ConfirmMfa turns MFA on once the user proves the authenticator app works, and returns the recovery codes.
+// This is the only time the recovery codes are shown.
+func ConfirmMfa() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req confirmMfaRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": uid}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		if user.Mfa_enabled || user.Mfa_pending_secret == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no two-factor enrollment in progress"})
+			return
+		}
+
+		step := helper.ValidateTOTP(*user.Mfa_pending_secret, req.Code, time.Now())
+		if step == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "code is incorrect"})
+			return
+		}
+
+		codes, err := helper.GenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating recovery codes"})
+			return
+		}
+		hashes := make([]string, len(codes))
+		for i, code := range codes {
+			hashes[i] = helper.HashToken(code)
+		}
+
+		Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": uid}, bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "mfa_enabled", Value: true},
+				{Key: "mfa_secret", Value: *user.Mfa_pending_secret},
+				{Key: "mfa_recovery_codes", Value: hashes},
+				{Key: "mfa_last_step", Value: step},
+				{Key: "updated_at", Value: Updated_at},
+			}},
+			{Key: "$unset", Value: bson.D{{Key: "mfa_pending_secret", Value: ""}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while enabling two-factor authentication"})
+			return
+		}
+
+		helper.RecordSecurityEvent(c, uid, helper.TenantOf(user), helper.SecurityMfaEnable, helper.OutcomeSuccess, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication enabled, keep the recovery codes somewhere safe", "recovery_codes": codes})
+	}
+}
+
+// LoginMfa is the second step of the login, it exchanges the challenge from Login plus a TOTP or recovery code for the real tokens
+func LoginMfa() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req loginMfaRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		claims, msg := helper.ValidateToken(req.Mfa_token)
+		if msg != "" || claims.Scope != helper.ScopeMfa {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "mfa token is invalid or has expired, kindly login again"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": claims.Uid}).Decode(&user); err != nil || !user.Mfa_enabled || user.Mfa_secret == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "mfa token is invalid or has expired, kindly login again"})
+			return
+		}
+
+		// wrong codes count as failed logins, so the lockout also protects the second factor
+		clientIP := c.ClientIP()
+		account := helper.LoginAccount(helper.TenantOf(user), *user.Email)
+		block, err := helper.CheckLoginAllowed(account, clientIP)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking login attempts"})
+			return
+		}
+		method := "totp"
+		if req.Code == "" {
+			method = "recovery_code"
+		}
+
+		if block.Code != "" {
+			abortLoginBlocked(c, block)
+			helper.RecordSecurityEvent(c, *user.User_id, helper.TenantOf(user), helper.SecurityLogin, helper.OutcomeBlocked, map[string]interface{}{"method": method, "reason": block.Code})
+			return
+		}
+
+		var accepted bool
+		if req.Code != "" {
+			accepted, err = acceptTOTP(ctx, user, req.Code)
+		} else {
+			accepted, err = consumeRecoveryCode(ctx, user, req.Recovery_code)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the code"})
+			return
+		}
+		if !accepted {
+			recordLoginFailure(c, user, account, clientIP, method)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "code is incorrect"})
+			return
+		}
+
+		helper.ResetLoginFailures(account)
+		issueLoginTokens(c, ctx, user, method)
+	}
+}
+
+// acceptTOTP records the step of the accepted code, a code that was already used (even if still valid) is refused
+func acceptTOTP(ctx context.Context, user models.User, code string) (bool, error) {
+	step := helper.ValidateTOTP(*user.Mfa_secret, code, time.Now())
+	if step == 0 {
+		return false, nil
+	}
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{
+		"user_id": *user.User_id,
+		"$or":     bson.A{bson.M{"mfa_last_step": bson.M{"$lt": step}}, bson.M{"mfa_last_step": bson.M{"$exists": false}}},
+	}, bson.D{{Key: "$set", Value: bson.D{{Key: "mfa_last_step", Value: step}}}})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// consumeRecoveryCode removes the code in the same update that checks it, so it can only ever be used once
+func consumeRecoveryCode(ctx context.Context, user models.User, code string) (bool, error) {
+	hash := helper.HashToken(helper.NormalizeRecoveryCode(code))
+
+	result, err := userCollection.UpdateOne(ctx,
+		bson.M{"user_id": *user.User_id, "mfa_recovery_codes": hash},
+		bson.M{"$pull": bson.M{"mfa_recovery_codes": hash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var organizationCollection *mongo.Collection = database.OpenCollection(database.Client, "organizations")
+
+// CreateOrganization adds a tenant. Users join it through invitations, or by giving its tenant_id at signup when
+// it is created with open_signup.
+func CreateOrganization() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var organization models.Organization
+		if err := c.BindJSON(&organization); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(organization); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		organization.ID = primitive.NewObjectID()
+		organization.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		organization.Updated_at = organization.Created_at
+
+		if _, err := organizationCollection.InsertOne(ctx, organization); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "tenant_id is already used", "code": "tenant_exists"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the organization"})
+			return
+		}
+
+		helper.RecordAudit(c, helper.AuditOrgCreate, *organization.Tenant_id, *organization.Tenant_id,
+			map[string]interface{}{"name": *organization.Name, "open_signup": organization.Open_signup})
+		c.JSON(http.StatusCreated, organization)
+	}
+}
+
+func ListOrganizations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := organizationCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "tenant_id", Value: 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing organizations"})
+			return
+		}
+
+		organizations := []models.Organization{}
+		if err := cursor.All(ctx, &organizations); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing organizations"})
+			return
+		}
+		c.JSON(http.StatusOK, organizations)
+	}
+}
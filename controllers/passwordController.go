@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/mailer"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// the same response is sent whether the email exists or not, so that nobody can find out which emails are registered
+const forgotPasswordResponse = "if an account exists for this email, a password reset link has been sent"
+
+type forgotPasswordRequest struct {
+	Email     string `json:"email" validate:"required,email"`
+	Tenant_id string `json:"tenant_id"` // organization of the account, default tenant when missing
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type changePasswordRequest struct {
+	Current_password string `json:"current_password" validate:"required"`
+	New_password     string `json:"new_password" validate:"required"`
+}
+
+func passwordOwner(user models.User) helper.PasswordOwner {
+	owner := helper.PasswordOwner{}
+	if user.Email != nil {
+		owner.Email = *user.Email
+	}
+	if user.First_name != nil {
+		owner.First_name = *user.First_name
+	}
+	if user.Last_name != nil {
+		owner.Last_name = *user.Last_name
+	}
+	return owner
+}
+
+// abortPasswordPolicy lists every broken rule, so the client can show them all at once
+func abortPasswordPolicy(c *gin.Context, violations []helper.PolicyViolation) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "password does not meet the password policy", "code": "weak_password", "reasons": violations})
+}
+
+// link sent in emails points to the frontend, which posts the token back to us
+func appBaseURL() string {
+	if url := os.Getenv("APP_BASE_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:" + os.Getenv("PORT")
+}
+
+// links sent in emails that are opened on this API directly (magic link callback, email verification),
+// APP_BASE_URL is usually another origin than the API, which would lose the cookies set by the API
+func apiBaseURL() string {
+	if url := os.Getenv("API_BASE_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8000"
+	}
+	return "http://localhost:" + port
+}
+
+// requestIsHTTPS tells whether the client reached us over https, directly or through a proxy terminating TLS
+func requestIsHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
+
+func passwordResetTTL() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("PASSWORD_RESET_TTL_MINUTES"))
+	if err != nil || minutes < 1 {
+		minutes = 30
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// updatePassword stores a new password hash, invalidates every reset link issued before the change and logs the user out
+// everywhere, so whoever held a stolen session or token loses it with the old password
+func updatePassword(ctx context.Context, userId string, password string) error {
+	hashed := HashPassword(password)
+	Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	_, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "password", Value: hashed},
+		{Key: "updated_at", Value: Updated_at},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	if err := helper.RevokeOneTimeTokens(helper.PurposePasswordReset, userId); err != nil {
+		return err
+	}
+	return helper.RevokeUserTokens(ctx, userId)
+}
+
+func ForgotPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req forgotPasswordRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		// lookup and mail are done in background, so the response time does not reveal if the user exists
+		go sendPasswordReset(req.Tenant_id, req.Email, mailer.LocaleFromHeader(c.GetHeader("Accept-Language")))
+
+		c.JSON(http.StatusOK, gin.H{"message": forgotPasswordResponse})
+	}
+}
+
+func sendPasswordReset(tenantId string, email string, locale string) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, helper.ScopeToTenant(tenantId, bson.M{"email": email})).Decode(&user); err != nil {
+		return
+	}
+
+	rawToken, err := helper.IssueOneTimeToken(helper.PurposePasswordReset, *user.User_id, passwordResetTTL())
+	if err != nil {
+		log.Println("could not issue password reset token:", err)
+		return
+	}
+
+	msg, err := mailer.Render("password_reset", locale, email, gin.H{
+		"Name": *user.First_name,
+		"Link": appBaseURL() + "/reset-password?token=" + rawToken,
+		"TTL":  passwordResetTTL().String(),
+	})
+	if err != nil {
+		log.Println("could not render password reset email:", err)
+		return
+	}
+
+	if err := mailer.Send(ctx, msg); err != nil {
+		log.Println("could not send password reset email:", err)
+	}
+}
+
+func ResetPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req resetPasswordRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// the token is only looked at first, so a rejected password does not burn the link
+		userId, err := helper.PeekOneTimeToken(helper.PurposePasswordReset, req.Token)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": helper.ErrInvalidOneTimeToken.Error()})
+			return
+		}
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": helper.ErrInvalidOneTimeToken.Error()})
+			return
+		}
+
+		if violations := helper.DefaultPasswordPolicy().CheckPassword(req.Password, passwordOwner(user)); len(violations) > 0 {
+			abortPasswordPolicy(c, violations)
+			return
+		}
+
+		// token is deleted while being read, so a second attempt with the same link fails
+		if _, err := helper.ConsumeOneTimeToken(helper.PurposePasswordReset, req.Token); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": helper.ErrInvalidOneTimeToken.Error()})
+			return
+		}
+
+		if err := updatePassword(ctx, userId, req.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while updating the password"})
+			return
+		}
+
+		helper.RecordSecurityEvent(c, userId, helper.TenantOf(user), helper.SecurityPasswordReset, helper.OutcomeSuccess, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "password has been reset, kindly login with the new password"})
+	}
+}
+
+// ChangePassword lets a logged in user replace the password, the current one is asked again in case the token was stolen
+func ChangePassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req changePasswordRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": c.GetString("uid")}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		if valid, _ := VerifyPassword(req.Current_password, *user.Password); !valid {
+			helper.RecordSecurityEvent(c, *user.User_id, helper.TenantOf(user), helper.SecurityPasswordChange, helper.OutcomeFailure,
+				map[string]interface{}{"reason": "wrong_password"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "current password is incorrect"})
+			return
+		}
+
+		if violations := helper.DefaultPasswordPolicy().CheckPassword(req.New_password, passwordOwner(user)); len(violations) > 0 {
+			abortPasswordPolicy(c, violations)
+			return
+		}
+
+		if err := updatePassword(ctx, *user.User_id, req.New_password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while updating the password"})
+			return
+		}
+
+		helper.RecordSecurityEvent(c, *user.User_id, helper.TenantOf(user), helper.SecurityPasswordChange, helper.OutcomeSuccess, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "password changed, kindly login again"})
+	}
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"github.com/someshnayak29/golang-jwt-project/sms"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type verifyPhoneRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// SendPhoneOtp texts a verification code to the phone of the logged in user
+func SendPhoneOtp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		uid := c.GetString("uid") // set by middleware.Authenticate
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": uid}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		if user.Phone_verified {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "phone number is already verified"})
+			return
+		}
+
+		code, err := helper.IssuePhoneOtp(uid, *user.Phone)
+		if err == helper.ErrOtpTooSoon {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the code"})
+			return
+		}
+
+		body := "Your verification code is " + code + ". It expires in " + helper.PhoneOtpTTL.String() + "."
+		if err := sms.Send(ctx, *user.Phone, body); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while sending the code"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "verification code sent"})
+	}
+}
+
+func VerifyPhone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req verifyPhoneRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+
+		phone, err := helper.VerifyPhoneOtp(uid, req.Code)
+		switch err {
+		case nil:
+		case helper.ErrOtpInvalid, helper.ErrOtpExpired:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case helper.ErrOtpTooManyAttempts:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while verifying the code"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// the phone must still be the one the code was sent to
+		Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := userCollection.UpdateOne(ctx, bson.M{"user_id": uid, "phone": phone}, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "phone_verified", Value: true},
+			{Key: "updated_at", Value: Updated_at},
+		}}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while verifying the phone"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "phone number has changed, kindly request a new code"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "phone number verified"})
+	}
+}
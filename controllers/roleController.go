@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var roleCollection *mongo.Collection = database.OpenCollection(database.Client, "roles")
+var permissionCollection *mongo.Collection = database.OpenCollection(database.Client, "permissions")
+
+type setUserRolesRequest struct {
+	Roles []string `json:"roles" validate:"required,min=1,dive,required"`
+}
+
+// unknownNames returns the names that have no document matching filter in the collection, under the given field
+func unknownNames(ctx context.Context, collection *mongo.Collection, filter bson.M, field string, names []string) ([]string, error) {
+	query := bson.M{field: bson.M{"$in": names}}
+	for key, value := range filter {
+		query[key] = value
+	}
+	cursor, err := collection.Find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	var found []bson.M
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, doc := range found {
+		if name, ok := doc[field].(string); ok {
+			known[name] = true
+		}
+	}
+
+	unknown := []string{}
+	for _, name := range names {
+		// wildcards are not in the catalog
+		if !known[name] && name != "*" && !(len(name) > 2 && name[len(name)-2:] == ":*") {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown, nil
+}
+
+// notHeldPermissions returns the permissions the caller does not have, nobody can hand out more than what they hold
+func notHeldPermissions(c *gin.Context, ctx context.Context, permissions []string) ([]string, error) {
+	held, err := helper.EffectivePermissions(ctx, c.GetString("uid"), c.GetString("tenant_id"), c.GetStringSlice("roles"))
+	if err != nil {
+		return nil, err
+	}
+
+	notHeld := []string{}
+	for _, permission := range permissions {
+		if !helper.PermissionGranted(held, permission) {
+			notHeld = append(notHeld, permission)
+		}
+	}
+	return notHeld, nil
+}
+
+// checkAssignableRoles answers the request itself when the caller can't give these roles to someone of the organization
+// tenantId (assignment or invitation), only the built-in roles and those of that organization exist there
+func checkAssignableRoles(c *gin.Context, ctx context.Context, tenantId string, roles []string) bool {
+	unknown, err := unknownNames(ctx, roleCollection, helper.RoleTenantFilter(tenantId, bson.M{}), "name", roles)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking roles"})
+		return false
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown roles", "roles": unknown})
+		return false
+	}
+
+	// only a SUPER_ADMIN can make another one, otherwise an org admin could escape its organization
+	for _, role := range roles {
+		if role == helper.RoleSuperAdmin && !helper.CrossTenant(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only a SUPER_ADMIN can assign the SUPER_ADMIN role"})
+			return false
+		}
+	}
+
+	permissions, err := helper.RolePermissions(ctx, tenantId, roles)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking roles"})
+		return false
+	}
+	notHeld, err := notHeldPermissions(c, ctx, permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking permissions"})
+		return false
+	}
+	if len(notHeld) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can not assign roles with permissions you do not have", "permissions": notHeld})
+		return false
+	}
+	return true
+}
+
+func ListPermissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := permissionCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing permissions"})
+			return
+		}
+
+		permissions := []models.Permission{}
+		if err := cursor.All(ctx, &permissions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing permissions"})
+			return
+		}
+		c.JSON(http.StatusOK, permissions)
+	}
+}
+
+func ListRoles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := roleCollection.Find(ctx, helper.ScopedRoleFilter(c, bson.M{}), options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing roles"})
+			return
+		}
+
+		roles := []models.Role{}
+		if err := cursor.All(ctx, &roles); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing roles"})
+			return
+		}
+		c.JSON(http.StatusOK, roles)
+	}
+}
+
+// SaveRole creates a role or replaces the permissions of an existing one, identified by name in the organization of
+// the caller (a SUPER_ADMIN may give another tenant_id). The built-in roles are shared by every organization and can
+// only be changed by a SUPER_ADMIN, and nobody can put on a role, or edit a role holding, permissions they do not have.
+func SaveRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var role models.Role
+		if err := c.BindJSON(&role); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(role); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		unknown, err := unknownNames(ctx, permissionCollection, bson.M{}, "_id", role.Permissions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking permissions"})
+			return
+		}
+		if len(unknown) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown permissions", "permissions": unknown})
+			return
+		}
+
+		if role.Permissions == nil {
+			role.Permissions = []string{}
+		}
+
+		tenantId := helper.NormalizeTenant(c.GetString("tenant_id"))
+		var filter bson.M
+		if helper.BuiltinRole(role.Name) {
+			if !helper.CrossTenant(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "only a SUPER_ADMIN can change the built-in roles", "code": "builtin_role"})
+				return
+			}
+			role.Tenant_id = nil
+			filter = bson.M{"name": role.Name, "tenant_id": bson.M{"$exists": false}}
+		} else {
+			if role.Tenant_id != nil && helper.NormalizeTenant(*role.Tenant_id) != tenantId {
+				if !helper.CrossTenant(c) {
+					c.JSON(http.StatusForbidden, gin.H{"error": "you can only manage the roles of your own organization"})
+					return
+				}
+				tenantId = helper.NormalizeTenant(*role.Tenant_id)
+				if exists, err := helper.TenantExists(ctx, tenantId); err != nil || !exists {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "organization does not exist", "code": "unknown_tenant"})
+					return
+				}
+			}
+			// the upsert copies tenant_id from the filter into a new role
+			filter = bson.M{"name": role.Name, "tenant_id": tenantId}
+		}
+
+		// the role as it was, for the audit log, nothing when it is created
+		var before map[string]interface{}
+		var previous models.Role
+		err = roleCollection.FindOne(ctx, filter).Decode(&previous)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the role"})
+			return
+		}
+		if err == nil {
+			before = map[string]interface{}{"description": previous.Description, "permissions": previous.Permissions}
+		}
+
+		// the permissions given and those of the role as it is, so a stronger role can't be weakened either
+		notHeld, err := notHeldPermissions(c, ctx, append(append([]string{}, role.Permissions...), previous.Permissions...))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking permissions"})
+			return
+		}
+		if len(notHeld) > 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you can not manage roles with permissions you do not have", "permissions": notHeld})
+			return
+		}
+
+		now := time.Now().UTC()
+		upsert := true
+		after := options.After
+		err = roleCollection.FindOneAndUpdate(ctx, filter, bson.M{
+			"$set":         bson.M{"description": role.Description, "permissions": role.Permissions, "updated_at": now},
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "created_at": now},
+		}, &options.FindOneAndUpdateOptions{Upsert: &upsert, ReturnDocument: &after}).Decode(&role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while saving the role"})
+			return
+		}
+
+		helper.InvalidateRoleCache()
+		helper.RecordAuditChange(c, helper.AuditRoleSave, role.Name, tenantId, before,
+			map[string]interface{}{"description": role.Description, "permissions": role.Permissions})
+		c.JSON(http.StatusOK, role)
+	}
+}
+
+// SetUserRoles replaces the roles of a user, the first role is also stored as user_type for older clients.
+// The user is logged out everywhere, as old tokens carry the old roles.
+func SetUserRoles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req setUserRolesRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := findManagedUser(c, ctx)
+		if !ok {
+			return
+		}
+
+		if !checkAssignableRoles(c, ctx, helper.TenantOf(user), req.Roles) {
+			return
+		}
+
+		Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		_, err := userCollection.UpdateOne(ctx, bson.M{"user_id": *user.User_id}, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "roles", Value: req.Roles},
+			{Key: "user_type", Value: req.Roles[0]},
+			{Key: "updated_at", Value: Updated_at},
+		}}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while updating roles"})
+			return
+		}
+
+		// the roles are in the tokens, so the user has to login again to get tokens with the new ones
+		if err := helper.RevokeUserTokens(ctx, *user.User_id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while revoking the tokens"})
+			return
+		}
+		helper.InvalidateUserPermissions(*user.User_id)
+
+		helper.RecordAuditChange(c, helper.AuditUserRoles, *user.User_id, helper.TenantOf(user),
+			map[string]interface{}{"roles": helper.UserRoles(user), "user_type": user.User_type},
+			map[string]interface{}{"roles": req.Roles, "user_type": req.Roles[0]})
+		emitUserEvent(helper.WebhookUserRolesChanged, user, map[string]interface{}{"previous_roles": helper.UserRoles(user), "roles": req.Roles})
+		c.JSON(http.StatusOK, gin.H{"user_id": c.Param("user_id"), "roles": req.Roles})
+	}
+}
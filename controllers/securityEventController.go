@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ListSecurityEvents pages through the security events of :user_id, newest first.
+// ?limit=20 (max 100), ?cursor=<next_cursor of the previous page>, filters ?type=login and ?outcome=failure.
+func ListSecurityEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		limit := usersPageSize(c.Query("limit"))
+
+		var cursor *helper.PageCursor
+		if encoded := c.Query("cursor"); encoded != "" {
+			decoded, err := helper.DecodeCursor(encoded, helper.SecurityEventSort)
+			if err != nil || decoded.Direction != helper.CursorNext {
+				c.JSON(http.StatusBadRequest, gin.H{"error": helper.ErrInvalidCursor.Error(), "code": "invalid_cursor"})
+				return
+			}
+			cursor = &decoded
+		}
+
+		filter := bson.M{}
+		if eventType := c.Query("type"); eventType != "" {
+			filter["type"] = eventType
+		}
+		if outcome := c.Query("outcome"); outcome != "" {
+			filter["outcome"] = outcome
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := selfOrScopedUser(c, ctx, false)
+		if !ok {
+			return
+		}
+
+		// one more than asked, to know whether there is another page
+		events, docs, err := helper.ListSecurityEvents(ctx, *user.User_id, filter, cursor, limit+1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the security events"})
+			return
+		}
+
+		response := gin.H{"events": events, "next_cursor": nil}
+		if len(events) > limit {
+			events = events[:limit]
+			next, _ := helper.EncodeCursor(helper.PageCursor{
+				Sort:      helper.SortKey(helper.SecurityEventSort),
+				Direction: helper.CursorNext,
+				Values:    helper.CursorValues(docs[limit-1], helper.SecurityEventSort),
+			})
+			response["events"] = events
+			response["next_cursor"] = next
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type refreshTokenRequest struct {
+	Refresh_token string `json:"refresh_token" validate:"required"`
+}
+
+// selfOrScopedUser loads the user of :user_id for the routes about one account (sessions, security events), answering
+// the request itself when it can't be done. Users can always reach their own account, for anyone else the caller has
+// the permission of the route and the user has to be one the caller can see (or manage, when manage is set).
+func selfOrScopedUser(c *gin.Context, ctx context.Context, manage bool) (models.User, bool) {
+	self := c.Param("user_id") == c.GetString("uid")
+	if manage && !self {
+		return findManagedUser(c, ctx)
+	}
+
+	filter := bson.M{"user_id": c.Param("user_id")}
+	if !self {
+		filter = helper.ScopedUserFilter(c, filter)
+	}
+
+	var user models.User
+	err := userCollection.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return user, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the user"})
+		return user, false
+	}
+	return user, true
+}
+
+// RefreshToken exchanges a refresh token for a new token pair of the same session. Every refresh token works once,
+// presenting one that was already exchanged revokes the session, as someone else must hold a copy of it.
+func RefreshToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req refreshTokenRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		// refresh tokens issued before sessions existed can't be rotated, their owners have to login again
+		claims, msg := helper.ValidateToken(req.Refresh_token)
+		if msg != "" || claims.Scope != helper.ScopeRefresh || claims.Session_id == "" || claims.Id == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token", "code": "invalid_refresh_token"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		state, err := helper.LoadAccountState(ctx, claims.Uid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the account"})
+			return
+		}
+		if !state.Found || state.Token_version != claims.Token_version {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked, kindly login again", "code": "token_revoked"})
+			return
+		}
+		if state.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled", "code": "account_disabled"})
+			return
+		}
+
+		// loaded before the rotation, so that a failure here does not cost the client its refresh token
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": claims.Uid}).Decode(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the user"})
+			return
+		}
+
+		session, err := helper.RotateSessionRefresh(ctx, claims.Session_id, claims.Id, c.ClientIP())
+		switch {
+		case err == helper.ErrRefreshReused:
+			helper.RecordSecurityEvent(c, *user.User_id, helper.TenantOf(user), helper.SecurityTokenRefresh, helper.OutcomeFailure,
+				map[string]interface{}{"session_id": claims.Session_id, "reason": "refresh_token_reused"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "refresh_token_reused"})
+			return
+		case err == helper.ErrSessionRevoked || (err == nil && session.User_id != claims.Uid):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": helper.ErrSessionRevoked.Error(), "code": "session_revoked"})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while refreshing the session"})
+			return
+		}
+
+		token, refreshToken, _ := helper.GenerateAllTokens(user, helper.ScopeFor(user.Email_verified), session)
+		helper.RecordSecurityEvent(c, *user.User_id, helper.TenantOf(user), helper.SecurityTokenRefresh, helper.OutcomeSuccess,
+			map[string]interface{}{"session_id": session.Session_id})
+		c.JSON(http.StatusOK, gin.H{"token": token, "refresh_token": refreshToken, "session_id": session.Session_id})
+	}
+}
+
+// ListSessions returns the active sessions of :user_id, the one of the calling token is marked current
+func ListSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := selfOrScopedUser(c, ctx, false)
+		if !ok {
+			return
+		}
+
+		sessions, err := helper.ListSessions(ctx, *user.User_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the sessions"})
+			return
+		}
+		for i := range sessions {
+			sessions[i].Current = sessions[i].Session_id == c.GetString("sid")
+		}
+		c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+	}
+}
+
+// RevokeSession logs one device out, its access token stops working and its refresh token can't be used anymore
+func RevokeSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := selfOrScopedUser(c, ctx, true)
+		if !ok {
+			return
+		}
+		userId := *user.User_id
+
+		sessionId := c.Param("session_id")
+		revoked, err := helper.RevokeSessions(ctx, bson.M{"user_id": userId, "session_id": sessionId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while revoking the session"})
+			return
+		}
+		if revoked == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+
+		helper.RecordSecurityEvent(c, userId, helper.TenantOf(user), helper.SecuritySessionRevoke, helper.OutcomeSuccess,
+			map[string]interface{}{"session_id": sessionId, "by": c.GetString("uid")})
+		if userId != c.GetString("uid") {
+			helper.RecordAudit(c, helper.AuditSessionRevoke, userId, helper.TenantOf(user), map[string]interface{}{"session_id": sessionId})
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+	}
+}
+
+// RevokeOtherSessions logs out every other device of the caller, or every device of another user for an admin
+func RevokeOtherSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := selfOrScopedUser(c, ctx, true)
+		if !ok {
+			return
+		}
+		userId := *user.User_id
+
+		filter := bson.M{"user_id": userId}
+		if userId == c.GetString("uid") && c.GetString("sid") != "" {
+			filter["session_id"] = bson.M{"$ne": c.GetString("sid")}
+		}
+
+		revoked, err := helper.RevokeSessions(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while revoking the sessions"})
+			return
+		}
+
+		helper.RecordSecurityEvent(c, userId, helper.TenantOf(user), helper.SecuritySessionRevoke, helper.OutcomeSuccess,
+			map[string]interface{}{"revoked": revoked, "by": c.GetString("uid")})
+		if userId != c.GetString("uid") {
+			helper.RecordAudit(c, helper.AuditSessionRevoke, userId, helper.TenantOf(user), map[string]interface{}{"revoked": revoked})
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "sessions revoked", "revoked": revoked})
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -12,35 +14,33 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/someshnayak29/golang-jwt-project/database"
 	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/mailer"
 	"github.com/someshnayak29/golang-jwt-project/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
 var validate = validator.New() // To validate whether the user matches the description and fields of user struct
 
 func HashPassword(password string) string {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14) // Converts the password string into a byte slice, as GenerateFromPassword
-	// 14 is cost parameter or the "work factor" of bcrypt. It determines how computationally expensive the hashing will be
-	// A higher cost value means more iterations of the bcrypt hashing algorithm
+	// hashed with the current policy (argon2id by default), the returned string records the algorithm and its parameters
+	hashed, err := helper.CurrentHasher().Hash(password)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	return string(bytes)
+	return hashed
 }
 
 func VerifyPassword(userPassword string, providedPassword string) (bool, string) {
 
-	// CompareHashAndPassword compares a bcrypt hashed password with its possible plaintext equivalent. Returns nil on success, or an error on failure.
-	err := bcrypt.CompareHashAndPassword([]byte(providedPassword), []byte(userPassword))
-	check := true
+	// providedPassword is the stored hash, the right algorithm is picked from its format (bcrypt or argon2id)
+	check, err := helper.VerifyPasswordHash(userPassword, providedPassword)
 	msg := ""
 
-	if err != nil {
+	if err != nil || !check {
 		msg = fmt.Sprintf("password of email is incorrect")
 		check = false
 	}
@@ -52,11 +52,31 @@ func Signup() gin.HandlerFunc {
 
 		var user models.User
 
+		if !selfSignupAllowed() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "signup is disabled, kindly ask an admin for an invitation", "code": "signup_disabled"})
+			return
+		}
+
 		if err := c.BindJSON(&user); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		// whatever the client sends, a self signup is a plain user. Other roles are given by an admin or an invitation
+		userType := "USER"
+		user.User_type = &userType
+		user.Roles = []string{userType}
+
+		// phone is stored in E.164, so that different ways of writing the same number are caught by the uniqueness check
+		if user.Phone != nil {
+			phone, err := helper.NormalizePhone(*user.Phone)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			user.Phone = &phone
+		}
+
 		// To validate whether the user matches the description and fields of user struct
 		validationErr := validate.Struct(user)
 		if validationErr != nil {
@@ -64,34 +84,38 @@ func Signup() gin.HandlerFunc {
 			return
 		}
 
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-
-		// checking if email already exists in dB or not
-		count, err := userCollection.CountDocuments(ctx, bson.M{"email": user.Email})
-		defer cancel() // to stop searching after 100 sec
-
-		if err != nil {
-			log.Panic(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking for the email"})
+		violations := helper.DefaultPasswordPolicy().CheckPassword(*user.Password, passwordOwner(user))
+		if len(violations) > 0 {
+			abortPasswordPolicy(c, violations)
+			return
 		}
 
-		password := HashPassword(*user.Password)
-		user.Password = &password
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel() // to stop searching after 100 sec
 
-		// checking if phone already exists in dB or not
-		count, err = userCollection.CountDocuments(ctx, bson.M{"phone": user.Phone})
-		defer cancel()
+		// the user joins the default organization, or one that opted in to open signup. Others are only joined
+		// through an invitation, the same answer is given whether the organization exists or not.
+		tenantId := helper.TenantOf(user)
+		user.Tenant_id = &tenantId
 
+		open, err := helper.TenantOpenForSignup(ctx, tenantId)
 		if err != nil {
-			log.Panic(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking for thr phone number"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the organization"})
+			return
+		}
+		if !open {
+			c.JSON(http.StatusForbidden, gin.H{"error": "this organization only accepts invited users", "code": "signup_closed"})
+			return
 		}
 
-		// if user already exists
-		if count > 0 {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "this email or phone number already exists"})
+		if taken, err := emailOrPhoneTaken(ctx, tenantId, *user.Email, *user.Phone); err != nil || taken {
+			abortEmailOrPhoneTaken(c, err)
+			return
 		}
 
+		password := HashPassword(*user.Password)
+		user.Password = &password
+
 		user.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.ID = primitive.NewObjectID() // generate a new unique ObjectID
@@ -99,9 +123,9 @@ func Signup() gin.HandlerFunc {
 		hex := user.ID.Hex() // direct not working, therefore first stored it int string, then use below
 		user.User_id = &hex
 
-		token, refreshToken, _ := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, *user.User_id)
-		user.Token = &token
-		user.Refresh_token = &refreshToken
+		// email has to be proven by clicking the link we send, whatever the client sent
+		user.Email_verified = false
+		user.Phone_verified = false
 
 		// Use fmt.Sprintf to format strings and capture the result.
 		// Use fmt.Printf to format strings and print them directly to standard output.
@@ -115,11 +139,35 @@ func Signup() gin.HandlerFunc {
 			return
 		}
 		defer cancel()
+
+		go sendEmailVerification(user, mailer.LocaleFromHeader(c.GetHeader("Accept-Language")))
+		emitUserEvent(helper.WebhookUserCreated, user, map[string]interface{}{"source": "signup", "roles": user.Roles})
+
 		c.JSON(http.StatusOK, resultInsertionNumber)
 
 	}
 }
 
+// ALLOW_SELF_SIGNUP=false turns off /users/signup, users then only join through invitations
+func selfSignupAllowed() bool {
+	return os.Getenv("ALLOW_SELF_SIGNUP") != "false"
+}
+
+// emailOrPhoneTaken checks the uniqueness of email and phone, both are unique inside an organization
+// so the same person can have accounts in several
+func emailOrPhoneTaken(ctx context.Context, tenantId string, email string, phone string) (bool, error) {
+	count, err := userCollection.CountDocuments(ctx, helper.ScopeToTenant(tenantId, bson.M{"$or": []bson.M{{"email": email}, {"phone": phone}}}))
+	return count > 0, err
+}
+
+func abortEmailOrPhoneTaken(c *gin.Context, err error) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking for the email or phone number"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "this email or phone number already exists"})
+}
+
 func Login() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
@@ -131,12 +179,35 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
+		if user.Email == nil || user.Password == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email and password are required"})
+			return
+		}
+
+		// the same email can exist in several organizations, tenant_id says which account is meant
+		tenantId := helper.TenantOf(user)
+		account := helper.LoginAccount(tenantId, *user.Email)
+
+		// refuse early if this account or ip failed too many times, before spending time on bcrypt
+		clientIP := c.ClientIP()
+		block, err := helper.CheckLoginAllowed(account, clientIP)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking login attempts"})
+			return
+		}
+		if block.Code != "" {
+			abortLoginBlocked(c, block)
+			helper.RecordAccountSecurityEvent(c, tenantId, *user.Email, helper.SecurityLogin, helper.OutcomeBlocked, map[string]interface{}{"method": "password", "reason": block.Code})
+			return
+		}
+
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
-		err := userCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&foundUser)
+		err = userCollection.FindOne(ctx, helper.ScopeToTenant(tenantId, bson.M{"email": user.Email})).Decode(&foundUser)
 		defer cancel()
 
 		if err != nil {
+			recordLoginFailure(c, models.User{}, account, clientIP, "password")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "email or password is incorrect"})
 			return
 		}
@@ -146,135 +217,402 @@ func Login() gin.HandlerFunc {
 		defer cancel()
 
 		if !passwordIsValid {
+			recordLoginFailure(c, foundUser, account, clientIP, "password")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
 
+		helper.ResetLoginFailures(account)
+
+		// the password is known right now, so hashes made with an older algorithm or weaker parameters are upgraded silently
+		if helper.PasswordNeedsRehash(*foundUser.Password) {
+			rehashed := HashPassword(*user.Password)
+			_, err := userCollection.UpdateOne(ctx, bson.M{"user_id": *foundUser.User_id, "password": *foundUser.Password},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "password", Value: rehashed}}}})
+			if err != nil {
+				log.Println("could not rehash password:", err)
+			}
+		}
+
 		// we can add many more checks like this one: if user is not found in dB, then we can also prompt it to signup
 		if foundUser.Email == nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found!!! Kindly Sign Up "})
 		}
 
-		// now will generate a new token for the login users new session
-		token, refreshToken, _ := helper.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, *foundUser.User_type, *foundUser.User_id)
-
-		// update both token and refreshToken in the user profile
-		helper.UpdateAllTokens(token, refreshToken, *foundUser.User_id)
+		if abortIfDisabled(c, foundUser, "password") {
+			return
+		}
 
-		// once again fetch user with updated values from dB using user_id
-		err = userCollection.FindOne(ctx, bson.M{"user_id": *foundUser.User_id}).Decode(&foundUser)
-		defer cancel()
+		if !foundUser.Email_verified && helper.UnverifiedEmailPolicy() == helper.UnverifiedPolicyBlock {
+			c.JSON(http.StatusForbidden, gin.H{"error": "email is not verified, kindly check your inbox", "code": "email_not_verified"})
+			return
+		}
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if challengeSecondFactor(c, ctx, foundUser) {
 			return
 		}
-		c.JSON(http.StatusOK, foundUser)
 
+		issueLoginTokens(c, ctx, foundUser, "password")
+	}
+}
+
+// recordLoginFailure counts a failed login for the lockout and records it in the security events of the account,
+// user is empty when no account has the email
+func recordLoginFailure(c *gin.Context, user models.User, account string, clientIP string, method string) {
+	locked, err := helper.RecordLoginFailure(account, clientIP)
+	if err != nil {
+		log.Println("could not record login failure:", err)
+	}
+	if user.User_id == nil {
+		return
+	}
+
+	helper.RecordSecurityEvent(c, *user.User_id, helper.TenantOf(user), helper.SecurityLogin, helper.OutcomeFailure, map[string]interface{}{"method": method})
+	if locked {
+		helper.RecordSecurityEvent(c, *user.User_id, helper.TenantOf(user), helper.SecurityAccountLock, helper.OutcomeBlocked, nil)
+	}
+}
+
+// challengeSecondFactor answers with an MFA challenge instead of tokens when the user has a second factor.
+// The tokens are then issued by LoginMfa (TOTP) or FinishPasskeyLogin (passkey) once the second factor is checked.
+func challengeSecondFactor(c *gin.Context, ctx context.Context, foundUser models.User) bool {
+	methods := []string{}
+	if foundUser.Mfa_enabled {
+		methods = append(methods, "totp")
+	}
+	if hasPasskeys(ctx, *foundUser.User_id) {
+		methods = append(methods, "webauthn")
+	}
+
+	if len(methods) == 0 {
+		return false
+	}
+
+	mfaToken, err := helper.GenerateMfaChallenge(*foundUser.User_id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the mfa challenge"})
+		return true
+	}
+	c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_methods": methods, "mfa_token": mfaToken, "expires_in": int(helper.MfaChallengeTTL.Seconds())})
+	return true
+}
+
+// issueLoginTokens finishes every kind of login (password, MFA ...) by issuing a new token pair for the user,
+// method is recorded in the security event of the login
+func issueLoginTokens(c *gin.Context, ctx context.Context, foundUser models.User, method string) {
+
+	// checked here too so that no kind of login (MFA, passkey, magic link ...) works for a disabled account
+	if abortIfDisabled(c, foundUser, method) {
+		return
+	}
+
+	// every login is a session of its own, logging in on a phone does not touch the session of the laptop
+	userAgent := c.GetHeader("User-Agent")
+	session, err := helper.CreateSession(ctx, foundUser, helper.DeviceName(c.GetHeader("X-Device-Name"), userAgent), userAgent, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the session"})
+		return
+	}
+
+	// now will generate a new token for the login users new session
+	token, refreshToken, _ := helper.GenerateAllTokens(foundUser, helper.ScopeFor(foundUser.Email_verified), session)
+
+	helper.RecordSecurityEvent(c, *foundUser.User_id, helper.TenantOf(foundUser), helper.SecurityLogin, helper.OutcomeSuccess,
+		map[string]interface{}{"method": method, "session_id": session.Session_id})
+	emitUserEvent(helper.WebhookUserLogin, foundUser, map[string]interface{}{"method": method})
+	c.JSON(http.StatusOK, models.NewLoginResponse(foundUser, token, refreshToken, session.Session_id))
+}
+
+// abortIfDisabled refuses the login of an account disabled by an admin, only after the credentials were checked
+// so that the state of an account is not revealed to someone who does not own it
+func abortIfDisabled(c *gin.Context, user models.User, method string) bool {
+	if !user.Disabled {
+		return false
 	}
+	helper.RecordSecurityEvent(c, *user.User_id, helper.TenantOf(user), helper.SecurityLogin, helper.OutcomeFailure,
+		map[string]interface{}{"method": method, "reason": "account_disabled"})
+	c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled, kindly contact an admin", "code": "account_disabled"})
+	return true
 }
 
-// GetUsers can only be accessed by ADMIN
+// abortLoginBlocked answers a refused login with a distinct code per reason, so clients can tell a lock from a wrong password
+func abortLoginBlocked(c *gin.Context, block helper.LoginBlock) {
+	retryAfter := int(math.Ceil(block.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+	status := http.StatusTooManyRequests
+	msg := "too many failed login attempts, kindly wait before trying again"
+	if block.Code == helper.LoginCodeAccountLocked {
+		status = http.StatusLocked
+		msg = "account is temporarily locked because of too many failed login attempts"
+	}
+
+	c.JSON(status, gin.H{"error": msg, "code": block.Code, "retry_after": retryAfter})
+}
 
-// strconv.Atoi to convert string to int
-// Page number less than 1 doesn't make sense that's why default value is 1 and in error case also its also set to 1
-// If parsing "startIndex" fails (err != nil), startIndex retains its value calculated from (page - 1) * recordPerPage.
+// GetUsers needs the users:read permission, checked by the policy of the route.
+// Only the users of the caller's organization are listed, unless the caller is a SUPER_ADMIN.
+
+// Two ways of paging:
+// - cursor (default): ?limit=10, then ?cursor=<next_cursor or prev_cursor of the previous answer>. Each page is an index
+//   range scan starting where the last one stopped, so it costs the same on page 1 and page 10000.
+// - compatibility: ?page=2&recordPerPage=10 (or startIndex), with $skip. Kept for older clients, slower on deep pages.
+// total_count is counted separately in compatibility mode, and in cursor mode only when asked with include_total=true.
+// Each user is sent as a models.UserListItem, ?fields=user_id,email keeps only some of its fields.
 
 func GetUsers() gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		// filters, search and sort come from a whitelist, see helpers.ParseUserListQuery
+		query, err := helper.ParseUserListQuery(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_query"})
 			return
 		}
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
-		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage")) // fetch from context request and convert to int
-		// retrieve the value of a query parameter named "recordPerPage" from HTTP request handled by gin context c
+		fields, ok := parseViewFields(c, models.UserListItem{})
+		if !ok {
+			return
+		}
+
+		helper.RecordAudit(c, helper.AuditUserList, "", c.GetString("tenant_id"), map[string]interface{}{"query": c.Request.URL.RawQuery})
+
+		filter := helper.ScopedUserFilter(c, query.Filter)
 
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10 // if we dont mention in context and default and error case also we take it as 10
+		if c.Query("page") != "" || c.Query("recordPerPage") != "" || c.Query("startIndex") != "" {
+			getUsersByPage(c, filter, query.Sort, fields)
+			return
 		}
+		getUsersByCursor(c, filter, query.Sort, fields)
+	}
 
-		page, err1 := strconv.Atoi(c.Query("page"))
-		if err1 != nil || page < 1 {
-			page = 1
+}
+
+// usersPageSize reads a page size parameter, 10 by default and at most 100
+func usersPageSize(value string) int {
+	size, err := strconv.Atoi(value) // fetch from context request and convert to int
+	if err != nil || size < 1 {
+		return 10 // if we dont mention in context and default and error case also we take it as 10
+	}
+	if size > 100 {
+		return 100
+	}
+	return size
+}
+
+// parseViewFields reads ?fields= and checks it against the view the handler answers with
+func parseViewFields(c *gin.Context, view interface{}) ([]string, bool) {
+	fields := helper.ParseFields(c.Query("fields"))
+	if _, err := helper.PickFields(view, fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_fields"})
+		return nil, false
+	}
+	return fields, true
+}
+
+// userListItems turns the raw documents of the aggregation into list items, the raw documents stay around for the cursors
+func userListItems(docs []bson.M, fields []string) ([]interface{}, error) {
+	items := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, err
 		}
+		var user models.User
+		if err := bson.Unmarshal(raw, &user); err != nil {
+			return nil, err
+		}
+		item, err := helper.PickFields(models.NewUserListItem(user), fields)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
 
-		// similar to skip and limit of node.js
-		startIndex := (page - 1) * recordPerPage
-		startIndex, err = strconv.Atoi(c.Query("startIndex")) // if we specify in context starting index we will take it otherwise above calculated default page-1 * record will be used
+// findUserPage runs the page query as a plain pipeline, so the $match and $sort can use the indexes
+// of the users collection, which they can't once inside a $facet
+func findUserPage(ctx context.Context, filter bson.M, sort bson.D, skip int, limit int) ([]bson.M, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: filter}},
+		bson.D{{Key: "$sort", Value: sort}},
+	}
+	if skip > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: skip}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
 
-		// MongoDB Aggregation Pipeline
-		matchStage := bson.D{{Key: "$match", Value: bson.D{{}}}} // $match: Filters documents to pass only those that match the specified conditions.
+	result, err := userCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	users := []bson.M{}
+	if err := result.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
 
-		// _id : on what field we wants data to be grouped on; null value means all data in one single group
-		// if we give value to _id, the it will group all unique ids together and give total docs under it using $sum
-		// $group Stage: This is a MongoDB aggregation pipeline stage that groups documents
-		// data Field: This stage creates a field data where each document in the group is added to an array.
-		// Value: 1 specifies that for each document in the group, the accumulator should add 1 to the total count.
+func getUsersByPage(c *gin.Context, filter bson.M, sort bson.D, fields []string) {
+	recordPerPage := usersPageSize(c.Query("recordPerPage"))
 
-		groupStage := bson.D{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: bson.D{{Key: "_id", Value: "null"}}},
-			{Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}},
-			{Key: "data", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}}}}}
+	// Page number less than 1 doesn't make sense that's why default value is 1 and in error case also its also set to 1
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
 
-		// $project allows you to manipulate and transform data within your MongoDB collection i.e. which all data points we want
-		// Here, 0 means Excludes the _id field. 1 meanIncludes a field total_count. and Includes an array field user_items that is sliced from an array field data, based on startIndex and recordPerPage.
-		// []interface This is an array of interfaces containing the arguments for the $slice operator:
-		// The $ symbol is used in MongoDB query operators to indicate that the following string is a field name or a reference to a field within a document.
+	// similar to skip and limit of node.js, startIndex wins over page when it is given
+	startIndex := (page - 1) * recordPerPage
+	if index, err := strconv.Atoi(c.Query("startIndex")); err == nil && index >= 0 {
+		startIndex = index
+	}
 
-		projectStage := bson.D{
-			{Key: "$project", Value: bson.D{
-				{Key: "_id", Value: 0},
-				{Key: "total_count", Value: 1},
-				{Key: "user_items", Value: bson.D{{Key: "$slice", Value: []interface{}{"$data", startIndex, recordPerPage}}}}}}}
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
 
-		result, err := userCollection.Aggregate(ctx, mongo.Pipeline{matchStage, groupStage, projectStage})
-		defer cancel()
+	// only the users of the page are sent back from mongo, never the whole collection
+	users, err := findUserPage(ctx, filter, sort, startIndex, recordPerPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing user items"})
+		return
+	}
+
+	total, err := userCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing user items"})
+		return
+	}
+
+	items, err := userListItems(users, fields)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing user items"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total_count": total, "user_items": items})
+}
+
+func getUsersByCursor(c *gin.Context, filter bson.M, sort bson.D, fields []string) {
+	limit := usersPageSize(c.Query("limit"))
 
+	// a prev cursor walks backwards: reversed sort from the first user of the page, then the page is put back in order
+	var cursor helper.PageCursor
+	backwards := false
+	pageSort := sort
+	pageFilter := filter
+
+	if encoded := c.Query("cursor"); encoded != "" {
+		var err error
+		cursor, err = helper.DecodeCursor(encoded, sort)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing user items"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_cursor"})
+			return
 		}
+		backwards = cursor.Direction == helper.CursorPrev
+		if backwards {
+			pageSort = helper.ReverseSort(sort)
+		}
+		pageFilter = bson.M{"$and": bson.A{filter, helper.KeysetFilter(pageSort, cursor.Values)}}
+	}
 
-		// M is an unordered representation of a BSON document.
-		// mongo driver returns mongo.Cursor, therefore we will store this in bson.M
-		// result.All: Retrieves all documents from the aggregation result (result) and decodes them into the slice allUsers
-		// All iterates the cursor and decodes each document into results.
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
 
-		var allUsers []bson.M
-		if err = result.All(ctx, &allUsers); err != nil {
-			// Fatal is equivalent to [Print] followed by a call to os.Exit(1).
-			log.Fatal(err)
+	// one more than asked, to know whether there is another page after this one
+	users, err := findUserPage(ctx, pageFilter, pageSort, 0, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing user items"})
+		return
+	}
+
+	hasMore := len(users) > limit
+	if hasMore {
+		users = users[:limit]
+	}
+	if backwards {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
 		}
+	}
 
-		c.JSON(http.StatusOK, allUsers[0])
+	items, err := userListItems(users, fields)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing user items"})
+		return
+	}
+
+	response := gin.H{"user_items": items, "next_cursor": nil, "prev_cursor": nil}
 
+	// going forward there is a previous page whenever we came from a cursor, going backwards there is always a next one
+	hasNext := hasMore
+	hasPrev := cursor.Direction != ""
+	if backwards {
+		hasNext, hasPrev = true, hasMore
+	}
+	if len(users) > 0 {
+		if hasNext {
+			next, _ := helper.EncodeCursor(helper.PageCursor{Sort: helper.SortKey(sort), Direction: helper.CursorNext, Values: helper.CursorValues(users[len(users)-1], sort)})
+			response["next_cursor"] = next
+		}
+		if hasPrev {
+			prev, _ := helper.EncodeCursor(helper.PageCursor{Sort: helper.SortKey(sort), Direction: helper.CursorPrev, Values: helper.CursorValues(users[0], sort)})
+			response["prev_cursor"] = prev
+		}
 	}
 
+	// counting walks every matching user, so it is only done when asked
+	if c.Query("include_total") == "true" {
+		total, err := userCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing user items"})
+			return
+		}
+		response["total_count"] = total
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func GetUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userId := c.Param("user_id") // context have every info regarding http request and user_id bcoz its used in url users/user_id
 
-		// function to check if id is of admin or not
-		if err := helper.MatchUserTypeToUid(c, userId); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		// access is decided by the policy of the route, see middleware.Authorize
+		// users get the self view of their own account, admins the admin view of the others
+
+		var view interface{} = models.UserAdminView{}
+		if userId == c.GetString("uid") {
+			view = models.UserSelfView{}
+		}
+		fields, ok := parseViewFields(c, view)
+		if !ok {
+			return
 		}
 
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
 		var user models.User
-		err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user) // user_id is from json of models
+		// users of another organization look like they don't exist
+		err := userCollection.FindOne(ctx, helper.ScopedUserFilter(c, bson.M{"user_id": userId})).Decode(&user) // user_id is from json of models
 		defer cancel()
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, user) // send user details
+		if userId == c.GetString("uid") {
+			view = models.NewUserSelfView(user)
+		} else {
+			view = models.NewUserAdminView(user)
+			helper.RecordAudit(c, helper.AuditUserView, userId, helper.TenantOf(user), nil)
+		}
+		response, err := helper.PickFields(view, fields)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response) // send user details
 	}
 
 }
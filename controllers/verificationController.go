@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/mailer"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const resendVerificationResponse = "if an unverified account exists for this email, a verification link has been sent"
+
+type verifyEmailRequest struct {
+	Token string `json:"token" form:"token" validate:"required"`
+}
+
+type resendVerificationRequest struct {
+	Email     string `json:"email" validate:"required,email"`
+	Tenant_id string `json:"tenant_id"`
+}
+
+func emailVerificationTTL() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("EMAIL_VERIFICATION_TTL_HOURS"))
+	if err != nil || hours < 1 {
+		hours = 48
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func sendEmailVerification(user models.User, locale string) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	rawToken, err := helper.IssueOneTimeToken(helper.PurposeEmailVerification, *user.User_id, emailVerificationTTL())
+	if err != nil {
+		log.Println("could not issue email verification token:", err)
+		return
+	}
+
+	msg, err := mailer.Render("verify_email", locale, *user.Email, gin.H{
+		"Name": *user.First_name,
+		"Link": apiBaseURL() + "/users/verify-email?token=" + rawToken,
+		"TTL":  emailVerificationTTL().String(),
+	})
+	if err != nil {
+		log.Println("could not render verification email:", err)
+		return
+	}
+
+	if err := mailer.Send(ctx, msg); err != nil {
+		log.Println("could not send verification email:", err)
+	}
+}
+
+// VerifyEmail accepts the token either from the link (GET ?token=) or from a frontend (POST {"token": ...})
+func VerifyEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req verifyEmailRequest
+		if c.Request.Method == http.MethodGet {
+			req.Token = c.Query("token")
+		} else if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		userId, err := helper.ConsumeOneTimeToken(helper.PurposeEmailVerification, req.Token)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": helper.ErrInvalidOneTimeToken.Error()})
+			return
+		}
+
+		Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		// the user as it was before, to tell whether the email was verified already
+		var user models.User
+		err = userCollection.FindOneAndUpdate(ctx, bson.M{"user_id": userId}, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "email_verified", Value: true},
+			{Key: "updated_at", Value: Updated_at},
+		}}}).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusBadRequest, gin.H{"error": helper.ErrInvalidOneTimeToken.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while verifying the email"})
+			return
+		}
+
+		// older links are useless now
+		helper.RevokeOneTimeTokens(helper.PurposeEmailVerification, userId)
+		if !user.Email_verified {
+			emitUserEvent(helper.WebhookUserEmailVerified, user, nil)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "email verified, kindly login again to get full access"})
+	}
+}
+
+// ResendVerification is public because with the block policy the user has no token yet
+func ResendVerification() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req resendVerificationRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		locale := mailer.LocaleFromHeader(c.GetHeader("Accept-Language"))
+		go func() {
+			var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+			defer cancel()
+
+			var user models.User
+			if err := userCollection.FindOne(ctx, helper.ScopeToTenant(req.Tenant_id, bson.M{"email": req.Email, "email_verified": bson.M{"$ne": true}})).Decode(&user); err != nil {
+				return
+			}
+			sendEmailVerification(user, locale)
+		}()
+
+		c.JSON(http.StatusOK, gin.H{"message": resendVerificationResponse})
+	}
+}
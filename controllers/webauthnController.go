@@ -0,0 +1,379 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"github.com/someshnayak29/golang-jwt-project/webauthn"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var webauthnCollection *mongo.Collection = database.OpenCollection(database.Client, "webauthn_credentials")
+
+func init() {
+	database.EnsureIndexes(webauthnCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "credential_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	)
+}
+
+type finishPasskeyRegistrationRequest struct {
+	Name string `json:"name"` // label shown in the list of passkeys, e.g. "YubiKey" or "MacBook"
+	webauthn.RegistrationResponse
+}
+
+type beginPasskeyLoginRequest struct {
+	Email     string `json:"email"`     // optional, limits the login to the passkeys of this account
+	Tenant_id string `json:"tenant_id"` // organization of the email
+	Mfa_token string `json:"mfa_token"` // set when the passkey is used as second factor after the password
+}
+
+type publicKeyCredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// userPasskeys returns the usable credentials of a user, in the form browsers expect for allow/excludeCredentials
+func userPasskeys(ctx context.Context, userId string) ([]publicKeyCredentialDescriptor, error) {
+	cursor, err := webauthnCollection.Find(ctx, bson.M{"user_id": userId, "clone_detected": bson.M{"$ne": true}})
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials []models.WebauthnCredential
+	if err := cursor.All(ctx, &credentials); err != nil {
+		return nil, err
+	}
+
+	descriptors := []publicKeyCredentialDescriptor{}
+	for _, credential := range credentials {
+		descriptors = append(descriptors, publicKeyCredentialDescriptor{Type: "public-key", ID: credential.Credential_id})
+	}
+	return descriptors, nil
+}
+
+func hasPasskeys(ctx context.Context, userId string) bool {
+	count, err := webauthnCollection.CountDocuments(ctx, bson.M{"user_id": userId, "clone_detected": bson.M{"$ne": true}})
+	return err == nil && count > 0
+}
+
+// BeginPasskeyRegistration returns the options for navigator.credentials.create()
+func BeginPasskeyRegistration() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		uid := c.GetString("uid")
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": uid}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		existing, err := userPasskeys(ctx, uid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing passkeys"})
+			return
+		}
+
+		// the random one time token is used as the challenge, and lets us find the ceremony again when the browser answers
+		challenge, err := helper.IssueOneTimeToken(helper.PurposeWebauthnRegister, uid, helper.WebauthnCeremonyTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the challenge"})
+			return
+		}
+
+		params := []gin.H{}
+		for _, alg := range webauthn.SupportedAlgorithms {
+			params = append(params, gin.H{"type": "public-key", "alg": alg})
+		}
+
+		rp := helper.RelyingParty()
+		c.JSON(http.StatusOK, gin.H{"publicKey": gin.H{
+			"challenge": challenge,
+			"rp":        gin.H{"id": rp.ID, "name": rp.Name},
+			"user": gin.H{
+				"id":          webauthn.EncodeBase64URL([]byte(uid)),
+				"name":        *user.Email,
+				"displayName": *user.First_name + " " + *user.Last_name,
+			},
+			"pubKeyCredParams":       params,
+			"timeout":                helper.WebauthnCeremonyTTL.Milliseconds(),
+			"attestation":            "none",
+			"excludeCredentials":     existing, // the same authenticator can't be registered twice
+			"authenticatorSelection": gin.H{"residentKey": "preferred", "userVerification": "preferred"},
+		}})
+	}
+}
+
+// FinishPasskeyRegistration verifies the answer of the authenticator and stores the new credential
+func FinishPasskeyRegistration() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req finishPasskeyRegistrationRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+
+		challenge, err := webauthn.ChallengeOf(req.Response.ClientDataJSON)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		token, err := helper.ConsumeBoundOneTimeToken(helper.PurposeWebauthnRegister, challenge)
+		if err != nil || token.User_id != uid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "registration has expired, kindly start again"})
+			return
+		}
+
+		credential, err := helper.RelyingParty().VerifyRegistration(challenge, req.RegistrationResponse)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			name = "Passkey"
+		}
+
+		now := time.Now().UTC()
+		stored := models.WebauthnCredential{
+			ID:            primitive.NewObjectID(),
+			User_id:       uid,
+			Credential_id: webauthn.EncodeBase64URL(credential.ID),
+			Public_key:    credential.PublicKey,
+			Sign_count:    credential.SignCount,
+			Name:          name,
+			Created_at:    now,
+			Last_used_at:  now,
+		}
+
+		if _, err := webauthnCollection.InsertOne(ctx, stored); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "this passkey is already registered"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while saving the passkey"})
+			return
+		}
+
+		helper.RecordSecurityEvent(c, uid, c.GetString("tenant_id"), helper.SecurityPasskeyAdd, helper.OutcomeSuccess,
+			map[string]interface{}{"credential_id": stored.Credential_id, "name": name})
+		c.JSON(http.StatusOK, stored)
+	}
+}
+
+func ListPasskeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := webauthnCollection.Find(ctx, bson.M{"user_id": c.GetString("uid")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing passkeys"})
+			return
+		}
+
+		credentials := []models.WebauthnCredential{}
+		if err := cursor.All(ctx, &credentials); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing passkeys"})
+			return
+		}
+
+		c.JSON(http.StatusOK, credentials)
+	}
+}
+
+func DeletePasskey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := webauthnCollection.DeleteOne(ctx, bson.M{"user_id": c.GetString("uid"), "credential_id": c.Param("credential_id")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while deleting the passkey"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "passkey not found"})
+			return
+		}
+
+		helper.RecordSecurityEvent(c, c.GetString("uid"), c.GetString("tenant_id"), helper.SecurityPasskeyRemove, helper.OutcomeSuccess,
+			map[string]interface{}{"credential_id": c.Param("credential_id")})
+		c.JSON(http.StatusOK, gin.H{"message": "passkey deleted"})
+	}
+}
+
+// BeginPasskeyLogin returns the options for navigator.credentials.get().
+// Without a body any discoverable passkey can be used, with mfa_token the passkey completes a password login.
+func BeginPasskeyLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req beginPasskeyLoginRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		userId := ""
+		binding := helper.WebauthnPasswordless
+		userVerification := "required"
+
+		if req.Mfa_token != "" {
+			claims, msg := helper.ValidateToken(req.Mfa_token)
+			if msg != "" || claims.Scope != helper.ScopeMfa {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "mfa token is invalid or has expired, kindly login again"})
+				return
+			}
+			userId = claims.Uid
+			binding = helper.WebauthnSecondFactor
+			userVerification = "preferred" // the password was already checked
+		} else if req.Email != "" {
+			var user models.User
+			if err := userCollection.FindOne(ctx, helper.ScopeToTenant(req.Tenant_id, bson.M{"email": req.Email})).Decode(&user); err == nil {
+				userId = *user.User_id
+			}
+		}
+
+		allowed := []publicKeyCredentialDescriptor{}
+		if userId != "" {
+			var err error
+			if allowed, err = userPasskeys(ctx, userId); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing passkeys"})
+				return
+			}
+		}
+
+		challenge, err := helper.IssueBoundOneTimeToken(helper.PurposeWebauthnLogin, userId, binding, helper.WebauthnCeremonyTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the challenge"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"publicKey": gin.H{
+			"challenge":        challenge,
+			"rpId":             helper.RelyingParty().ID,
+			"timeout":          helper.WebauthnCeremonyTTL.Milliseconds(),
+			"userVerification": userVerification,
+			"allowCredentials": allowed,
+		}})
+	}
+}
+
+// FinishPasskeyLogin verifies the signature of the authenticator and issues the tokens
+func FinishPasskeyLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req webauthn.AssertionResponse
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		challenge, err := webauthn.ChallengeOf(req.Response.ClientDataJSON)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		token, err := helper.ConsumeBoundOneTimeToken(helper.PurposeWebauthnLogin, challenge)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "login has expired, kindly start again"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var stored models.WebauthnCredential
+		if err := webauthnCollection.FindOne(ctx, bson.M{"credential_id": strings.TrimRight(req.ID, "=")}).Decode(&stored); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "passkey is not registered"})
+			return
+		}
+
+		// a challenge issued for one account can't be answered with the passkey of another
+		if token.User_id != "" && token.User_id != stored.User_id {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "passkey is not registered"})
+			return
+		}
+		if stored.Clone_detected {
+			recordPasskeyFailure(c, ctx, stored.User_id, "credential_cloned")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": webauthn.ErrCloneDetected.Error(), "code": "credential_cloned"})
+			return
+		}
+
+		credential := webauthn.Credential{PublicKey: stored.Public_key, SignCount: stored.Sign_count}
+		signCount, err := helper.RelyingParty().VerifyAssertion(challenge, credential, req, token.Binding == helper.WebauthnPasswordless)
+		if err == webauthn.ErrCloneDetected {
+			webauthnCollection.UpdateOne(ctx, bson.M{"_id": stored.ID}, bson.M{"$set": bson.M{"clone_detected": true}})
+			recordPasskeyFailure(c, ctx, stored.User_id, "credential_cloned")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "credential_cloned"})
+			return
+		}
+		if err != nil {
+			recordPasskeyFailure(c, ctx, stored.User_id, "invalid_assertion")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		// the counter is only moved forward from the value we checked against, a concurrent login with a copy of the key loses
+		result, err := webauthnCollection.UpdateOne(ctx,
+			bson.M{"_id": stored.ID, "sign_count": stored.Sign_count},
+			bson.M{"$set": bson.M{"sign_count": signCount, "last_used_at": time.Now().UTC()}},
+		)
+		if err != nil || result.MatchedCount == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "passkey was used concurrently, kindly try again"})
+			return
+		}
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": stored.User_id}).Decode(&user); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+
+		if !user.Email_verified && helper.UnverifiedEmailPolicy() == helper.UnverifiedPolicyBlock {
+			c.JSON(http.StatusForbidden, gin.H{"error": "email is not verified, kindly check your inbox", "code": "email_not_verified"})
+			return
+		}
+
+		issueLoginTokens(c, ctx, user, "passkey")
+	}
+}
+
+// recordPasskeyFailure records a refused passkey login in the security events of the owner of the passkey
+func recordPasskeyFailure(c *gin.Context, ctx context.Context, userId string, reason string) {
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+		return
+	}
+	helper.RecordSecurityEvent(c, userId, helper.TenantOf(user), helper.SecurityLogin, helper.OutcomeFailure,
+		map[string]interface{}{"method": "passkey", "reason": reason})
+}
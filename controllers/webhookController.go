@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"github.com/someshnayak29/golang-jwt-project/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var webhookCollection *mongo.Collection = database.OpenCollection(database.Client, "webhooks")
+var webhookDeliveryCollection *mongo.Collection = database.OpenCollection(database.Client, "webhook_deliveries")
+
+type createWebhookRequest struct {
+	Url         string   `json:"url" validate:"required,url,max=500"`
+	Events      []string `json:"events" validate:"required,min=1,dive,required"`
+	Description string   `json:"description" validate:"max=200"`
+	Tenant_id   string   `json:"tenant_id"` // only a SUPER_ADMIN can add a webhook to another organization
+}
+
+// webhookWithSecret is the answer to CreateWebhook, the only time the secret is shown
+type webhookWithSecret struct {
+	models.Webhook
+	Secret string `json:"secret"`
+}
+
+// emitUserEvent queues a webhook event about a user, data never holds anything secret.
+// It is called before answering, so the event is in the outbox once the client sees the action done.
+func emitUserEvent(eventType string, user models.User, extra map[string]interface{}) {
+	data := map[string]interface{}{"user_id": *user.User_id, "tenant_id": helper.TenantOf(user)}
+	if user.Email != nil {
+		data["email"] = *user.Email
+	}
+	for key, value := range extra {
+		data[key] = value
+	}
+	helper.EmitWebhookEvent(helper.TenantOf(user), eventType, data)
+}
+
+// publicWebhookHost refuses localhost and ip addresses that are not public
+func publicWebhookHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return webhook.PublicAddress(ip)
+	}
+	return true
+}
+
+// checkWebhookEvents answers the request itself when an event can't be subscribed to, and removes duplicates
+func checkWebhookEvents(c *gin.Context, events []string) ([]string, bool) {
+	known := map[string]bool{"*": true}
+	for _, event := range helper.WebhookEvents {
+		known[event] = true
+	}
+
+	unique := []string{}
+	seen := map[string]bool{}
+	unknown := []string{}
+	for _, event := range events {
+		if !known[event] {
+			unknown = append(unknown, event)
+			continue
+		}
+		if !seen[event] {
+			seen[event] = true
+			unique = append(unique, event)
+		}
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown events", "code": "unknown_events", "events": unknown, "allowed": helper.WebhookEvents})
+		return nil, false
+	}
+	return unique, true
+}
+
+// findWebhook loads a webhook of the caller's organization, answering 404 itself
+func findWebhook(c *gin.Context, ctx context.Context) (models.Webhook, bool) {
+	var hook models.Webhook
+	err := webhookCollection.FindOne(ctx, helper.ScopedUserFilter(c, bson.M{"webhook_id": c.Param("webhook_id")})).Decode(&hook)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return hook, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the webhook"})
+		return hook, false
+	}
+	return hook, true
+}
+
+// CreateWebhook subscribes a url to user events of the organization. The answer holds the signing secret,
+// it is not shown again.
+func CreateWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req createWebhookRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(req); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		target, err := url.Parse(req.Url)
+		if err != nil || target.Host == "" || !(target.Scheme == "https" || (target.Scheme == "http" && helper.WebhookAllowHTTP())) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an absolute https url", "code": "invalid_url"})
+			return
+		}
+		// names are checked again when delivering, once resolved, this only refuses the obvious ones early
+		if !helper.WebhookAllowPrivate() && !publicWebhookHost(target.Hostname()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url must point to a public address", "code": "invalid_url"})
+			return
+		}
+
+		events, ok := checkWebhookEvents(c, req.Events)
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tenantId := helper.NormalizeTenant(c.GetString("tenant_id"))
+		if req.Tenant_id != "" && req.Tenant_id != tenantId {
+			if !helper.CrossTenant(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "you can only add webhooks to your own organization"})
+				return
+			}
+			tenantId = helper.NormalizeTenant(req.Tenant_id)
+		}
+		if exists, err := helper.TenantExists(ctx, tenantId); err != nil || !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "organization does not exist", "code": "unknown_tenant"})
+			return
+		}
+
+		secret, err := helper.RandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the webhook"})
+			return
+		}
+
+		now := time.Now().UTC()
+		hook := models.Webhook{
+			ID:          primitive.NewObjectID(),
+			Tenant_id:   tenantId,
+			Url:         target.String(),
+			Events:      events,
+			Description: req.Description,
+			Secret:      "whsec_" + secret,
+			Created_by:  c.GetString("uid"),
+			Created_at:  now,
+			Updated_at:  now,
+		}
+		hook.Webhook_id = hook.ID.Hex()
+
+		if _, err := webhookCollection.InsertOne(ctx, hook); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the webhook"})
+			return
+		}
+
+		helper.RecordAudit(c, helper.AuditWebhookCreate, hook.Webhook_id, tenantId,
+			map[string]interface{}{"url": hook.Url, "events": hook.Events})
+		c.JSON(http.StatusCreated, webhookWithSecret{Webhook: hook, Secret: hook.Secret})
+	}
+}
+
+// ListWebhooks shows the webhooks of the organization, without their secrets
+func ListWebhooks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := webhookCollection.Find(ctx, helper.ScopedUserFilter(c, bson.M{}), options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing webhooks"})
+			return
+		}
+
+		webhooks := []models.Webhook{}
+		if err := cursor.All(ctx, &webhooks); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing webhooks"})
+			return
+		}
+		c.JSON(http.StatusOK, webhooks)
+	}
+}
+
+// DeleteWebhook stops the deliveries to a webhook, the pending ones are given up
+func DeleteWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		hook, ok := findWebhook(c, ctx)
+		if !ok {
+			return
+		}
+
+		if _, err := webhookCollection.DeleteOne(ctx, bson.M{"webhook_id": hook.Webhook_id}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while deleting the webhook"})
+			return
+		}
+		if _, err := webhookDeliveryCollection.UpdateMany(ctx,
+			bson.M{"webhook_id": hook.Webhook_id, "status": helper.DeliveryPending},
+			bson.M{"$set": bson.M{"status": helper.DeliveryDead, "last_error": "webhook was deleted"}}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while deleting the webhook"})
+			return
+		}
+
+		helper.RecordAudit(c, helper.AuditWebhookDelete, hook.Webhook_id, hook.Tenant_id,
+			map[string]interface{}{"url": hook.Url, "events": hook.Events})
+		c.JSON(http.StatusOK, gin.H{"message": "webhook deleted"})
+	}
+}
+
+// ListWebhookDeliveries shows the latest deliveries of a webhook, the newest first.
+// ?limit=10 (max 100), ?status=dead to find the ones to redeliver.
+func ListWebhookDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		hook, ok := findWebhook(c, ctx)
+		if !ok {
+			return
+		}
+
+		filter := bson.M{"webhook_id": hook.Webhook_id}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetLimit(int64(usersPageSize(c.Query("limit"))))
+		cursor, err := webhookDeliveryCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing deliveries"})
+			return
+		}
+
+		deliveries := []models.WebhookDelivery{}
+		if err := cursor.All(ctx, &deliveries); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing deliveries"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+	}
+}
+
+// RedeliverWebhookDelivery sends a delivery again, typically a dead one once the receiver is fixed.
+// The payload and delivery id are unchanged, so receivers can ignore what they already processed.
+func RedeliverWebhookDelivery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		hook, ok := findWebhook(c, ctx)
+		if !ok {
+			return
+		}
+
+		deliveryId := c.Param("delivery_id")
+		found, err := helper.RedeliverWebhook(ctx, hook.Webhook_id, deliveryId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while scheduling the delivery"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+			return
+		}
+
+		helper.RecordAudit(c, helper.AuditWebhookRetry, hook.Webhook_id, hook.Tenant_id, map[string]interface{}{"delivery_id": deliveryId})
+		c.JSON(http.StatusAccepted, gin.H{"message": "delivery scheduled"})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"testing"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -18,13 +19,17 @@ import (
 func DBinstance() *mongo.Client {
 
 	// Load environment variables from .env file
+	// go test runs in the package directory, where there is none: tests only read the process environment
 	err := godotenv.Load(".env")
-	if err != nil {
+	if err != nil && !testing.Testing() {
 		log.Fatal("Error loading .env file")
 	}
 
 	// Retrieve MongoDB connection string from environment variables
 	MongoDb := os.Getenv("MONGODB_URL") // Retrieves the MongoDB connection string from environment variables loaded earlier.
+	if MongoDb == "" && testing.Testing() {
+		MongoDb = "mongodb://localhost:27017" // tests needing mongo are skipped when it is not there
+	}
 
 	// Set up MongoDB client options
 	clientOptions := options.Client().ApplyURI(MongoDb)
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// EnsureIndexes creates the given indexes in the background so that startup is not blocked
+// when the cluster is slow to answer. Failures are only logged, queries still work without them.
+func EnsureIndexes(collection *mongo.Collection, indexes ...mongo.IndexModel) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if _, err := collection.Indexes().CreateMany(ctx, indexes); err != nil {
+			log.Printf("could not create indexes on %s: %v", collection.Name(), err)
+		}
+	}()
+}
@@ -0,0 +1,108 @@
+package helpers
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/abac"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	policyEngine     *abac.Engine
+	policyEngineOnce sync.Once
+)
+
+// PolicyEngine returns the ABAC rules loaded from ABAC_POLICY_DIR (default "policies"),
+// they are loaded on first use so that .env has been read
+func PolicyEngine() *abac.Engine {
+	policyEngineOnce.Do(func() {
+		dir := os.Getenv("ABAC_POLICY_DIR")
+		if dir == "" {
+			dir = "policies"
+		}
+		policyEngine = abac.NewEngine(dir)
+		if err := policyEngine.Reload(); err != nil {
+			log.Println("could not load abac policies:", err)
+		}
+	})
+	return policyEngine
+}
+
+// SubjectAttributes are the attributes of the logged in user, taken from the claims put in the context by middleware.Authenticate
+func SubjectAttributes(c *gin.Context) abac.Attributes {
+	return abac.Attributes{
+		"uid":       c.GetString("uid"),
+		"email":     c.GetString("email"),
+		"user_type": c.GetString("user_type"),
+		"roles":     c.GetStringSlice("roles"),
+		"region":    c.GetString("region"),
+		"tenant_id": c.GetString("tenant_id"),
+		"scope":     c.GetString("scope"),
+	}
+}
+
+// SubjectFromUser builds the same attributes from a stored user, used to explain decisions for someone else
+func SubjectFromUser(user models.User) abac.Attributes {
+	return abac.Attributes{
+		"uid":       user.User_id,
+		"email":     user.Email,
+		"user_type": user.User_type,
+		"roles":     UserRoles(user),
+		"region":    user.Region,
+		"tenant_id": TenantOf(user),
+		"scope":     ScopeFor(user.Email_verified),
+	}
+}
+
+// ResourceAttributes are the attributes of a user being accessed, secrets are never exposed to policies
+func ResourceAttributes(user models.User) abac.Attributes {
+	return abac.Attributes{
+		"user_id":        user.User_id,
+		"email":          user.Email,
+		"user_type":      user.User_type,
+		"roles":          UserRoles(user),
+		"region":         user.Region,
+		"tenant_id":      TenantOf(user),
+		"email_verified": user.Email_verified,
+		"phone_verified": user.Phone_verified,
+		"mfa_enabled":    user.Mfa_enabled,
+	}
+}
+
+// LoadResourceAttributes finds the user a request is about, an unknown user has no attributes.
+// The filter should come from ScopedUserFilter so rules never see users of another tenant.
+func LoadResourceAttributes(ctx context.Context, filter bson.M) (abac.Attributes, error) {
+	var user models.User
+	err := userCollection.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return abac.Attributes{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ResourceAttributes(user), nil
+}
+
+// EnvironmentAttributes describe the request itself, hour and weekday are in ABAC_TIMEZONE (default UTC)
+func EnvironmentAttributes(c *gin.Context, now time.Time) abac.Attributes {
+	location, err := time.LoadLocation(os.Getenv("ABAC_TIMEZONE"))
+	if err != nil {
+		location = time.UTC
+	}
+	now = now.In(location)
+
+	return abac.Attributes{
+		"ip":      c.ClientIP(),
+		"time":    now.Format(time.RFC3339),
+		"hour":    now.Hour(),
+		"minute":  now.Minute(),
+		"weekday": now.Weekday().String(),
+	}
+}
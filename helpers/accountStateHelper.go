@@ -0,0 +1,80 @@
+package helpers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AccountState is what middleware.Authenticate needs to know about a user beyond the token:
+// a disabled account and a token version bumped by a forced logout both make old tokens useless
+type AccountState struct {
+	Found         bool
+	Disabled      bool
+	Token_version int
+}
+
+// states are cached for a few seconds, changes made on this replica are seen right away
+const accountStateTTL = 5 * time.Second
+
+type cachedAccountState struct {
+	state   AccountState
+	fetched time.Time
+}
+
+var (
+	accountStateMu    sync.Mutex
+	accountStateCache = map[string]cachedAccountState{}
+)
+
+func InvalidateAccountState(userId string) {
+	accountStateMu.Lock()
+	defer accountStateMu.Unlock()
+
+	delete(accountStateCache, userId)
+}
+
+func LoadAccountState(ctx context.Context, userId string) (AccountState, error) {
+	accountStateMu.Lock()
+	cached, ok := accountStateCache[userId]
+	accountStateMu.Unlock()
+	if ok && time.Since(cached.fetched) < accountStateTTL {
+		return cached.state, nil
+	}
+
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"user_id": userId},
+		options.FindOne().SetProjection(bson.M{"disabled": 1, "token_version": 1})).Decode(&user)
+	state := AccountState{}
+	if err == nil {
+		state = AccountState{Found: true, Disabled: user.Disabled, Token_version: user.Token_version}
+	} else if err != mongo.ErrNoDocuments {
+		return state, err
+	}
+
+	accountStateMu.Lock()
+	accountStateCache[userId] = cachedAccountState{state: state, fetched: time.Now()}
+	accountStateMu.Unlock()
+
+	return state, nil
+}
+
+// RevokeUserTokens logs the user out everywhere, every token issued before stops working and every session is revoked
+func RevokeUserTokens(ctx context.Context, userId string) error {
+	// token and refresh_token were stored on the user before sessions existed
+	_, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, bson.M{
+		"$inc":   bson.M{"token_version": 1},
+		"$unset": bson.M{"token": "", "refresh_token": ""},
+	})
+	InvalidateAccountState(userId)
+	if err != nil {
+		return err
+	}
+	_, err = RevokeSessions(ctx, bson.M{"user_id": userId})
+	return err
+}
@@ -0,0 +1,145 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/audit"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// audit actions
+const (
+	AuditUserCreate    = "user.create"
+	AuditUserDisable   = "user.disable"
+	AuditUserEnable    = "user.enable"
+	AuditUserRoles     = "user.roles"
+	AuditUserMfaReset  = "user.mfa_reset"
+	AuditUserLogout    = "user.logout"
+	AuditUserUnlock    = "user.unlock"
+	AuditUserList      = "user.list"
+	AuditUserView      = "user.view"
+	AuditUserDelete    = "user.delete"
+	AuditSessionRevoke = "session.revoke"
+	AuditRoleSave      = "role.save"
+	AuditGroupCreate   = "group.create"
+	AuditGroupUpdate   = "group.update"
+	AuditGroupDelete   = "group.delete"
+	AuditGroupMembers  = "group.members"
+	AuditInviteCreate  = "invitation.create"
+	AuditInviteRevoke  = "invitation.revoke"
+	AuditOrgCreate     = "organization.create"
+	AuditPolicyReload  = "policy.reload"
+	AuditWebhookCreate = "webhook.create"
+	AuditWebhookDelete = "webhook.delete"
+	AuditWebhookRetry  = "webhook.redeliver"
+)
+
+var auditCollection *mongo.Collection = database.OpenCollection(database.Client, "audit_log")
+
+func init() {
+	// seq is unique, two replicas appending at the same time can't both take the same place in the chain.
+	// sparse, as entries written before the chain existed have no seq.
+	database.EnsureIndexes(auditCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	)
+}
+
+// RecordAudit stores a privileged action done by the logged in user. The action already happened, so a failure is only logged.
+func RecordAudit(c *gin.Context, action string, targetId string, tenantId string, details map[string]interface{}) {
+	recordAuditEntry(c, action, targetId, tenantId, details, nil)
+}
+
+// RecordAuditChange is RecordAudit for an action that modified something, only the fields that differ
+// between before and after are kept
+func RecordAuditChange(c *gin.Context, action string, targetId string, tenantId string, before map[string]interface{}, after map[string]interface{}) {
+	recordAuditEntry(c, action, targetId, tenantId, nil, audit.Diff(before, after))
+}
+
+// wait before appending again when another replica took the next seq first, doubled up to auditAppendMaxBackoff.
+// Appending is retried until the context of the entry runs out, an entry is never dropped because of contention.
+const (
+	auditAppendBackoff    = 10 * time.Millisecond
+	auditAppendMaxBackoff = time.Second
+)
+
+// auditAppendMu queues the appends of this replica, so only other replicas can race for the next seq
+var auditAppendMu sync.Mutex
+
+func recordAuditEntry(c *gin.Context, action string, targetId string, tenantId string, details map[string]interface{}, changes map[string]models.AuditChange) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	entry := models.AuditEntry{
+		Action:     action,
+		Actor_id:   c.GetString("uid"),
+		Target_id:  targetId,
+		Tenant_id:  NormalizeTenant(tenantId),
+		Ip:         c.ClientIP(),
+		Request_id: c.GetString("request_id"),
+		Details:    details,
+		Changes:    changes,
+		Created_at: time.Now().UTC().Truncate(time.Millisecond), // what mongo keeps, so the hash still matches when read back
+	}
+	if err := appendAuditEntry(ctx, entry); err != nil {
+		// the entry is logged in full, so it can still be found and appended by hand
+		raw, _ := json.Marshal(entry)
+		log.Printf("could not write audit entry %s on %s: %v, entry: %s", action, targetId, err, raw)
+	}
+}
+
+// appendAuditEntry links the entry to the last one of the chain and stores it
+func appendAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	auditAppendMu.Lock()
+	defer auditAppendMu.Unlock()
+
+	backoff := auditAppendBackoff
+	for {
+		var last models.AuditEntry
+		err := auditCollection.FindOne(ctx, bson.M{"seq": bson.M{"$gt": 0}},
+			options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})).Decode(&last)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		entry.ID = primitive.NewObjectID()
+		entry.Seq = last.Seq + 1
+		entry.Prev_hash = last.Hash
+		if entry.Seq == 1 {
+			entry.Prev_hash = audit.GenesisHash
+		}
+		if entry.Hash, err = audit.Hash(entry); err != nil {
+			return err
+		}
+
+		_, err = auditCollection.InsertOne(ctx, entry)
+		if err == nil || !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+
+		// the replicas that collided wait a random part of the backoff, so they don't collide again
+		timer := time.NewTimer(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("gave up appending to the audit chain: %w", ctx.Err())
+		case <-timer.C:
+		}
+		if backoff < auditAppendMaxBackoff {
+			backoff *= 2
+		}
+	}
+}
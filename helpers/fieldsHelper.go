@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseFields reads a ?fields=a,b,c parameter, nil means every field
+func ParseFields(value string) []string {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// PickFields keeps only the requested JSON fields of a response view. Only fields of the view can be picked,
+// so a client can ask for less than the view but never for more.
+func PickFields(view interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return view, nil
+	}
+
+	raw, err := json.Marshal(view)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, err
+	}
+
+	picked := map[string]interface{}{}
+	for _, field := range fields {
+		value, ok := all[field]
+		if !ok {
+			allowed := make([]string, 0, len(all))
+			for name := range all {
+				allowed = append(allowed, name)
+			}
+			sort.Strings(allowed)
+			return nil, fmt.Errorf("unknown field %q, allowed fields are %s", field, strings.Join(allowed, ", "))
+		}
+		picked[field] = value
+	}
+	return picked, nil
+}
@@ -0,0 +1,112 @@
+package helpers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/models"
+)
+
+// secretUser has every secret a user document can carry, with values easy to spot in an encoded answer
+func secretUser() models.User {
+	str := func(value string) *string { return &value }
+	return models.User{
+		First_name:         str("Ada"),
+		Last_name:          str("Lovelace"),
+		Password:           str("$argon2id$v=19$m=65536,t=3,p=2$SECRETSALT$SECRETHASH"),
+		Email:              str("ada@example.com"),
+		Phone:              str("+15555550100"),
+		User_type:          str("ADMIN"),
+		Roles:              []string{"ADMIN"},
+		User_id:            str("user-1"),
+		Tenant_id:          str("default"),
+		Created_at:         time.Now(),
+		Updated_at:         time.Now(),
+		Token_version:      424242,
+		Mfa_enabled:        true,
+		Mfa_secret:         str("SECRETTOTPSEED"),
+		Mfa_pending_secret: str("SECRETPENDINGSEED"),
+		Mfa_recovery_codes: []string{"SECRETRECOVERY1", "SECRETRECOVERY2"},
+		Mfa_last_step:      987654321,
+	}
+}
+
+// secret keys and values of secretUser, none of them may appear in an answer
+var secretKeys = []string{"password", "token_version", "mfa_secret", "mfa_pending_secret", "mfa_recovery_codes", "mfa_last_step"}
+var secretValues = []string{"SECRETSALT", "SECRETHASH", "SECRETTOTPSEED", "SECRETPENDINGSEED", "SECRETRECOVERY", "424242", "987654321"}
+
+func userViews() map[string]interface{} {
+	user := secretUser()
+	return map[string]interface{}{
+		"self view":      models.NewUserSelfView(user),
+		"admin view":     models.NewUserAdminView(user),
+		"list item":      models.NewUserListItem(user),
+		"login response": models.NewLoginResponse(user, "access-token", "refresh-token", "session-1"),
+	}
+}
+
+func assertNoSecrets(t *testing.T, name string, answer interface{}) {
+	t.Helper()
+
+	raw, err := json.Marshal(answer)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	for key := range fields {
+		for _, secret := range secretKeys {
+			if strings.EqualFold(key, secret) {
+				t.Errorf("%s has the field %q", name, key)
+			}
+		}
+	}
+	for _, secret := range secretValues {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("%s leaks %q: %s", name, secret, raw)
+		}
+	}
+}
+
+func TestUserViewsHaveNoSecrets(t *testing.T) {
+	for name, view := range userViews() {
+		assertNoSecrets(t, name, view)
+
+		picked, err := PickFields(view, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		assertNoSecrets(t, name+" with every field", picked)
+
+		picked, err = PickFields(view, []string{"user_id", "email"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		assertNoSecrets(t, name+" with some fields", picked)
+	}
+}
+
+func TestPickFieldsRefusesSecrets(t *testing.T) {
+	for name, view := range userViews() {
+		for _, field := range append(secretKeys, "Password", "ID", "_id") {
+			if _, err := PickFields(view, ParseFields("email,"+field)); err == nil {
+				t.Errorf("%s: fields=email,%s was accepted", name, field)
+			}
+		}
+	}
+}
+
+func TestPickFields(t *testing.T) {
+	picked, err := PickFields(models.NewUserListItem(secretUser()), ParseFields(" user_id , email,"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := picked.(map[string]interface{})
+	if len(fields) != 2 || fields["user_id"] != "user-1" || fields["email"] != "ada@example.com" {
+		t.Fatalf("got %v", fields)
+	}
+}
@@ -0,0 +1,116 @@
+package helpers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var groupCollection *mongo.Collection = database.OpenCollection(database.Client, "groups")
+
+func init() {
+	database.EnsureIndexes(groupCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "group_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "members", Value: 1}}},
+	)
+}
+
+// the effective permissions of a user (roles + groups) are cached like role permissions,
+// membership changes made on this replica invalidate them right away, other replicas catch up after the TTL
+type cachedPermissions struct {
+	roles       string // the roles the entry was computed for, tokens issued before a role change still carry the old ones
+	permissions []string
+	fetched     time.Time
+}
+
+var (
+	userPermissionMu    sync.Mutex
+	userPermissionCache = map[string]cachedPermissions{}
+)
+
+// InvalidateUserPermissions forgets the effective permissions of the given users
+func InvalidateUserPermissions(userIds ...string) {
+	userPermissionMu.Lock()
+	defer userPermissionMu.Unlock()
+
+	for _, userId := range userIds {
+		delete(userPermissionCache, userId)
+	}
+}
+
+func invalidateAllUserPermissions() {
+	userPermissionMu.Lock()
+	defer userPermissionMu.Unlock()
+
+	userPermissionCache = map[string]cachedPermissions{}
+}
+
+// GroupPermissions is the union of the permissions of every group the user is a member of
+func GroupPermissions(ctx context.Context, userId string) ([]string, error) {
+	cursor, err := groupCollection.Find(ctx, bson.M{"members": userId}, options.Find().SetProjection(bson.M{"permissions": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var groups []models.Group
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	permissions := []string{}
+	for _, group := range groups {
+		permissions = append(permissions, group.Permissions...)
+	}
+	return permissions, nil
+}
+
+// EffectivePermissions is everything a user may do: the permissions of the roles plus those inherited from groups
+func EffectivePermissions(ctx context.Context, userId string, tenantId string, roles []string) ([]string, error) {
+	key := NormalizeTenant(tenantId) + "/" + strings.Join(roles, ",")
+
+	userPermissionMu.Lock()
+	cached, ok := userPermissionCache[userId]
+	userPermissionMu.Unlock()
+	if ok && cached.roles == key && time.Since(cached.fetched) < rolePermissionTTL {
+		return cached.permissions, nil
+	}
+
+	permissions, err := RolePermissions(ctx, tenantId, roles)
+	if err != nil {
+		return nil, err
+	}
+	if userId != "" {
+		inherited, err := GroupPermissions(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, inherited...)
+	}
+	permissions = UniqueStrings(permissions)
+
+	userPermissionMu.Lock()
+	userPermissionCache[userId] = cachedPermissions{roles: key, permissions: permissions, fetched: time.Now()}
+	userPermissionMu.Unlock()
+
+	return permissions, nil
+}
+
+// UniqueStrings drops repeated values, keeping the first occurrence
+func UniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,184 @@
+package helpers
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// error codes returned to the client when a login is refused before the password is even checked
+const (
+	LoginCodeAccountLocked = "account_locked"
+	LoginCodeIPLocked      = "ip_locked"
+	LoginCodeThrottled     = "login_throttled"
+)
+
+var loginAttemptCollection *mongo.Collection = database.OpenCollection(database.Client, "login_attempts")
+
+func init() {
+	// counters of keys that stopped failing are dropped after a day
+	database.EnsureIndexes(loginAttemptCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "last_failure_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(24 * 60 * 60)},
+	)
+}
+
+// LoginBlock explains why a login attempt is refused, Code is empty when the attempt is allowed
+type LoginBlock struct {
+	Code       string
+	RetryAfter time.Duration
+}
+
+func envInt(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value < 1 {
+		return def
+	}
+	return value
+}
+
+// thresholds, all configurable:
+// LOGIN_BACKOFF_AFTER failures => every further attempt has to wait 1s, 2s, 4s ... (max 5 minutes)
+// LOGIN_LOCKOUT_THRESHOLD failures of one account => account locked for LOGIN_LOCKOUT_MINUTES
+// LOGIN_IP_LOCKOUT_THRESHOLD failures from one ip => ip locked for LOGIN_LOCKOUT_MINUTES
+func loginBackoffAfter() int       { return envInt("LOGIN_BACKOFF_AFTER", 3) }
+func accountLockoutThreshold() int { return envInt("LOGIN_LOCKOUT_THRESHOLD", 10) }
+func ipLockoutThreshold() int      { return envInt("LOGIN_IP_LOCKOUT_THRESHOLD", 50) }
+func lockoutDuration() time.Duration {
+	return time.Duration(envInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute
+}
+
+const maxLoginBackoff = 5 * time.Minute
+
+func accountKey(email string) string { return "account:" + strings.ToLower(strings.TrimSpace(email)) }
+func ipKey(ip string) string         { return "ip:" + ip }
+
+// CheckLoginAllowed must be called before verifying the password
+func CheckLoginAllowed(email string, ip string) (LoginBlock, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	cursor, err := loginAttemptCollection.Find(ctx, bson.M{"key": bson.M{"$in": []string{accountKey(email), ipKey(ip)}}})
+	if err != nil {
+		return LoginBlock{}, err
+	}
+
+	var attempts []models.LoginAttempt
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return LoginBlock{}, err
+	}
+
+	now := time.Now().UTC()
+	block := LoginBlock{}
+
+	for _, attempt := range attempts {
+		if attempt.Locked_until.After(now) {
+			code := LoginCodeAccountLocked
+			if attempt.Key == ipKey(ip) {
+				code = LoginCodeIPLocked
+			}
+			// a lock always wins over throttling
+			if block.Code == "" || block.Code == LoginCodeThrottled || attempt.Locked_until.Sub(now) > block.RetryAfter {
+				block = LoginBlock{Code: code, RetryAfter: attempt.Locked_until.Sub(now)}
+			}
+			continue
+		}
+
+		if attempt.Next_attempt_at.After(now) && (block.Code == "" || block.Code == LoginCodeThrottled) {
+			if wait := attempt.Next_attempt_at.Sub(now); wait > block.RetryAfter {
+				block = LoginBlock{Code: LoginCodeThrottled, RetryAfter: wait}
+			}
+		}
+	}
+	return block, nil
+}
+
+// RecordLoginFailure increments both counters, it is also called for unknown emails so they look like real accounts.
+// locked is true when this failure locked the account.
+func RecordLoginFailure(email string, ip string) (locked bool, err error) {
+	if locked, err = recordFailure(accountKey(email), accountLockoutThreshold()); err != nil {
+		return locked, err
+	}
+	_, err = recordFailure(ipKey(ip), ipLockoutThreshold())
+	return locked, err
+}
+
+func recordFailure(key string, threshold int) (bool, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	upsert := true
+	after := options.After
+
+	// counting is a single pipeline update, so concurrent failures on different replicas are all counted.
+	// Once a lock has expired the key starts again from scratch instead of being locked on the next mistake.
+	lockExpired := bson.M{"$and": bson.A{
+		bson.M{"$gt": bson.A{"$locked_until", time.Time{}}},
+		bson.M{"$lte": bson.A{"$locked_until", now}},
+	}}
+	var attempt models.LoginAttempt
+	err := loginAttemptCollection.FindOneAndUpdate(ctx,
+		bson.M{"key": key},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$cond": bson.A{lockExpired, 1,
+				bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}}}},
+			"locked_until":    bson.M{"$cond": bson.A{lockExpired, time.Time{}, bson.M{"$ifNull": bson.A{"$locked_until", time.Time{}}}}},
+			"last_failure_at": now,
+		}}}},
+		&options.FindOneAndUpdateOptions{Upsert: &upsert, ReturnDocument: &after},
+	).Decode(&attempt)
+	if err != nil {
+		return false, err
+	}
+
+	failures := attempt.Failures
+
+	var nextAttempt, lockedUntil time.Time
+	if failures >= threshold {
+		lockedUntil = now.Add(lockoutDuration())
+	} else if failures >= loginBackoffAfter() {
+		delay := time.Second << uint(failures-loginBackoffAfter())
+		if delay > maxLoginBackoff || delay <= 0 {
+			delay = maxLoginBackoff
+		}
+		nextAttempt = now.Add(delay)
+	}
+	if nextAttempt.IsZero() && lockedUntil.IsZero() {
+		return false, nil
+	}
+
+	// only ever moved forward, a slower concurrent failure can't shorten a wait or lift a lock
+	_, err = loginAttemptCollection.UpdateOne(ctx, bson.M{"key": key}, bson.M{"$max": bson.M{
+		"next_attempt_at": nextAttempt,
+		"locked_until":    lockedUntil,
+	}})
+	return !lockedUntil.IsZero(), err
+}
+
+// ResetLoginFailures is called after a successful login. Only the account is cleared: the counter of the ip is left
+// alone, otherwise logging into an account of one's own between guesses would lift the ip lockout.
+func ResetLoginFailures(account string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	_, err := loginAttemptCollection.DeleteOne(ctx, bson.M{"key": accountKey(account)})
+	return err
+}
+
+// UnlockAccount clears the counters of an account, used by admins
+func UnlockAccount(email string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	_, err := loginAttemptCollection.DeleteOne(ctx, bson.M{"key": accountKey(email)})
+	return err
+}
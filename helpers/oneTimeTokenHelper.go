@@ -0,0 +1,145 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// purposes of one time tokens, a token issued for one purpose can never be consumed for another
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+	PurposeWebauthnRegister  = "webauthn_register"
+	PurposeWebauthnLogin     = "webauthn_login"
+	PurposeMagicLink         = "magic_link"
+	PurposeInvitation        = "invitation" // User_id holds the invitation_id, the invitee has no account yet
+)
+
+var ErrInvalidOneTimeToken = errors.New("token is invalid or has expired")
+
+var oneTimeTokenCollection *mongo.Collection = database.OpenCollection(database.Client, "one_time_token")
+
+func init() {
+	// expireAfterSeconds 0 => mongo removes the document as soon as expires_at is in the past
+	database.EnsureIndexes(oneTimeTokenCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+}
+
+// RandomToken returns n random bytes encoded as url safe base64, safe to put in links
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken is used to store tokens, so that a leaked database does not leak usable links
+func HashToken(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueOneTimeToken stores the hash of a new random token and returns the raw token to be sent to the user
+func IssueOneTimeToken(purpose string, userId string, ttl time.Duration) (string, error) {
+	return IssueBoundOneTimeToken(purpose, userId, "", ttl)
+}
+
+// IssueBoundOneTimeToken is IssueOneTimeToken with a binding stored next to the token, returned by ConsumeBoundOneTimeToken
+func IssueBoundOneTimeToken(purpose string, userId string, binding string, ttl time.Duration) (string, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	rawToken, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	token := models.OneTimeToken{
+		ID:         primitive.NewObjectID(),
+		Purpose:    purpose,
+		User_id:    userId,
+		Token_hash: HashToken(rawToken),
+		Binding:    binding,
+		Expires_at: now.Add(ttl),
+		Created_at: now,
+	}
+
+	if _, err := oneTimeTokenCollection.InsertOne(ctx, token); err != nil {
+		return "", err
+	}
+	return rawToken, nil
+}
+
+// ConsumeOneTimeToken deletes the token and returns the user it belongs to.
+// FindOneAndDelete is atomic, so two concurrent requests can never both use the same token.
+func ConsumeOneTimeToken(purpose string, rawToken string) (string, error) {
+	token, err := ConsumeBoundOneTimeToken(purpose, rawToken)
+	return token.User_id, err
+}
+
+// ConsumeBoundOneTimeToken is ConsumeOneTimeToken returning the whole token, binding included
+func ConsumeBoundOneTimeToken(purpose string, rawToken string) (models.OneTimeToken, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"purpose":    purpose,
+		"token_hash": HashToken(rawToken),
+		"expires_at": bson.M{"$gt": time.Now().UTC()},
+	}
+
+	var token models.OneTimeToken
+	err := oneTimeTokenCollection.FindOneAndDelete(ctx, filter).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return token, ErrInvalidOneTimeToken
+	}
+	return token, err
+}
+
+// PeekOneTimeToken returns the user of a valid token without using it up, e.g. to validate a request before consuming
+func PeekOneTimeToken(purpose string, rawToken string) (string, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"purpose":    purpose,
+		"token_hash": HashToken(rawToken),
+		"expires_at": bson.M{"$gt": time.Now().UTC()},
+	}
+
+	var token models.OneTimeToken
+	err := oneTimeTokenCollection.FindOne(ctx, filter).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return "", ErrInvalidOneTimeToken
+	}
+	if err != nil {
+		return "", err
+	}
+	return token.User_id, nil
+}
+
+// RevokeOneTimeTokens removes every outstanding token of the given purpose for a user
+func RevokeOneTimeTokens(purpose string, userId string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	_, err := oneTimeTokenCollection.DeleteMany(ctx, bson.M{"purpose": purpose, "user_id": userId})
+	return err
+}
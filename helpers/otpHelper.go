@@ -0,0 +1,122 @@
+package helpers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	PhoneOtpTTL         = 10 * time.Minute
+	PhoneOtpMaxAttempts = 5
+	PhoneOtpResendAfter = time.Minute // a new code can't be requested before this, to avoid SMS flooding
+)
+
+var (
+	ErrOtpInvalid         = errors.New("code is incorrect")
+	ErrOtpExpired         = errors.New("code has expired or was never requested, kindly request a new one")
+	ErrOtpTooManyAttempts = errors.New("too many incorrect attempts, kindly request a new code")
+	ErrOtpTooSoon         = errors.New("a code was sent recently, kindly wait before requesting a new one")
+)
+
+var phoneOtpCollection *mongo.Collection = database.OpenCollection(database.Client, "phone_otp")
+
+func init() {
+	database.EnsureIndexes(phoneOtpCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+}
+
+// 6 digit codes are easy to brute force offline, so they are hashed with the server secret instead of a plain sha256
+func hashOtp(userId string, code string) string {
+	mac := hmac.New(sha256.New, []byte(SECRET_KEY))
+	mac.Write([]byte(userId + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IssuePhoneOtp replaces any pending code of the user with a new one and returns the plain code to send
+func IssuePhoneOtp(userId string, phone string) (string, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var existing models.PhoneOtp
+	err := phoneOtpCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&existing)
+	if err == nil && time.Since(existing.Created_at) < PhoneOtpResendAfter {
+		return "", ErrOtpTooSoon
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		return "", err
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	now := time.Now().UTC()
+	otp := models.PhoneOtp{
+		ID:         primitive.NewObjectID(),
+		User_id:    userId,
+		Phone:      phone,
+		Code_hash:  hashOtp(userId, code),
+		Attempts:   0,
+		Expires_at: now.Add(PhoneOtpTTL),
+		Created_at: now,
+	}
+
+	upsert := true
+	_, err = phoneOtpCollection.ReplaceOne(ctx, bson.M{"user_id": userId}, otp, &options.ReplaceOptions{Upsert: &upsert})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// VerifyPhoneOtp checks the code and returns the phone it was sent to.
+// Every attempt is counted before comparing, so concurrent guesses can't go over the limit.
+func VerifyPhoneOtp(userId string, code string) (string, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userId, "expires_at": bson.M{"$gt": time.Now().UTC()}}
+	after := options.After
+
+	var otp models.PhoneOtp
+	err := phoneOtpCollection.FindOneAndUpdate(ctx, filter,
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		&options.FindOneAndUpdateOptions{ReturnDocument: &after},
+	).Decode(&otp)
+	if err == mongo.ErrNoDocuments {
+		return "", ErrOtpExpired
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if otp.Attempts > PhoneOtpMaxAttempts {
+		phoneOtpCollection.DeleteOne(ctx, bson.M{"_id": otp.ID})
+		return "", ErrOtpTooManyAttempts
+	}
+
+	if !hmac.Equal([]byte(otp.Code_hash), []byte(hashOtp(userId, code))) {
+		return "", ErrOtpInvalid
+	}
+
+	phoneOtpCollection.DeleteOne(ctx, bson.M{"_id": otp.ID})
+	return otp.Phone, nil
+}
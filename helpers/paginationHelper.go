@@ -0,0 +1,118 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// cursor directions
+const (
+	CursorNext = "next"
+	CursorPrev = "prev"
+)
+
+var ErrInvalidCursor = errors.New("cursor is invalid, kindly start again from the first page")
+
+// PageCursor points just after (next) or just before (prev) a document in a sorted list.
+// It is handed to the client as an opaque string, Values are the sort fields of that document with their bson types.
+type PageCursor struct {
+	Sort      string `bson:"s"` // SortKey of the list it was made for, a cursor can't be reused with another sort
+	Direction string `bson:"d"`
+	Values    bson.A `bson:"v"`
+}
+
+func EncodeCursor(cursor PageCursor) (string, error) {
+	raw, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// DecodeCursor reads a cursor made for the given sort
+func DecodeCursor(encoded string, sort bson.D) (PageCursor, error) {
+	var cursor PageCursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := bson.Unmarshal(raw, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if cursor.Sort != SortKey(sort) || len(cursor.Values) != len(sort) ||
+		(cursor.Direction != CursorNext && cursor.Direction != CursorPrev) {
+		return cursor, ErrInvalidCursor
+	}
+	for _, value := range cursor.Values {
+		if !cursorScalar(value) {
+			return cursor, ErrInvalidCursor
+		}
+	}
+	return cursor, nil
+}
+
+// cursorScalar tells whether a cursor value is a plain value. The values end up in KeysetFilter, where a document
+// would be read as query operators ({"$ne": null}) and an array or a regex would match more than one value.
+func cursorScalar(value interface{}) bool {
+	switch value.(type) {
+	case nil, string, bool, int32, int64, float64,
+		primitive.ObjectID, primitive.DateTime, primitive.Timestamp, primitive.Decimal128:
+		return true
+	}
+	return false
+}
+
+// SortKey describes a sort, e.g. "created_at:-1,_id:1"
+func SortKey(sort bson.D) string {
+	parts := make([]string, len(sort))
+	for i, field := range sort {
+		parts[i] = fmt.Sprintf("%s:%v", field.Key, field.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ReverseSort flips every direction, used to walk backwards from a prev cursor
+func ReverseSort(sort bson.D) bson.D {
+	reversed := make(bson.D, len(sort))
+	for i, field := range sort {
+		direction, _ := field.Value.(int)
+		reversed[i] = bson.E{Key: field.Key, Value: -direction}
+	}
+	return reversed
+}
+
+// CursorValues picks the sort fields of a document, to make a cursor pointing at it
+func CursorValues(doc bson.M, sort bson.D) bson.A {
+	values := bson.A{}
+	for _, field := range sort {
+		values = append(values, doc[field.Key])
+	}
+	return values
+}
+
+// KeysetFilter matches the documents coming after the cursor values in the given sort:
+// (a > va) or (a == va and b > vb) or ... with < for descending fields.
+// The sort has to end with a unique field (_id) for this to be exact.
+func KeysetFilter(sort bson.D, values bson.A) bson.M {
+	or := []bson.M{}
+	for i, field := range sort {
+		condition := bson.M{}
+		for j := 0; j < i; j++ {
+			condition[sort[j].Key] = values[j]
+		}
+
+		operator := "$gt"
+		if direction, _ := field.Value.(int); direction < 0 {
+			operator = "$lt"
+		}
+		condition[field.Key] = bson.M{operator: values[i]}
+		or = append(or, condition)
+	}
+	return bson.M{"$or": or}
+}
@@ -0,0 +1,53 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testSort = bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}}
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	created := primitive.NewDateTimeFromTime(time.Now().Truncate(time.Millisecond))
+	encoded, err := EncodeCursor(PageCursor{Sort: SortKey(testSort), Direction: CursorNext, Values: bson.A{created, id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := DecodeCursor(encoded, testSort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.Direction != CursorNext || cursor.Values[0] != created || cursor.Values[1] != id {
+		t.Fatalf("cursor changed on the way: %+v", cursor)
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	id := primitive.NewObjectID()
+	cases := map[string]PageCursor{
+		"other sort":        {Sort: "email:1,_id:1", Direction: CursorNext, Values: bson.A{"a@example.com", id}},
+		"unknown direction": {Sort: SortKey(testSort), Direction: "up", Values: bson.A{"x", id}},
+		"missing value":     {Sort: SortKey(testSort), Direction: CursorNext, Values: bson.A{id}},
+		"document":          {Sort: SortKey(testSort), Direction: CursorNext, Values: bson.A{bson.D{{Key: "$ne", Value: nil}}, id}},
+		"array":             {Sort: SortKey(testSort), Direction: CursorNext, Values: bson.A{bson.A{1, 2}, id}},
+		"regex":             {Sort: SortKey(testSort), Direction: CursorPrev, Values: bson.A{primitive.Regex{Pattern: ".*"}, id}},
+	}
+	for name, cursor := range cases {
+		encoded, err := EncodeCursor(cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeCursor(encoded, testSort); err != ErrInvalidCursor {
+			t.Errorf("%s: got %v, want ErrInvalidCursor", name, err)
+		}
+	}
+
+	if _, err := DecodeCursor("not base64!", testSort); err != ErrInvalidCursor {
+		t.Errorf("garbage: got %v, want ErrInvalidCursor", err)
+	}
+}
@@ -0,0 +1,179 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes passwords into self describing strings, the algorithm and its parameters are stored
+// inside every hash, so old hashes keep working after the policy changes and can be upgraded on the next login.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports false with a nil error when the password is wrong, error means the hash could not be read
+	Verify(password string, encoded string) (bool, error)
+	// Owns reports whether the encoded hash was produced by this algorithm
+	Owns(encoded string) bool
+	// NeedsRehash reports whether the hash was made with weaker parameters than the current ones
+	NeedsRehash(encoded string) bool
+}
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// BcryptHasher produces the standard "$2a$<cost>$..." strings
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(bytes), err
+}
+
+func (h BcryptHasher) Verify(password string, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) Owns(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < h.Cost
+}
+
+// Argon2idHasher produces PHC strings: $argon2id$v=19$m=<KiB>,t=<iterations>,p=<threads>$<salt>$<hash>
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type argon2Params struct {
+	memory, iterations uint32
+	parallelism        uint8
+	salt, key          []byte
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	// PHC strings use base64 without padding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func decodeArgon2id(encoded string) (argon2Params, error) {
+	var p argon2Params
+
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, ErrUnknownHashFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return p, ErrUnknownHashFormat
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, ErrUnknownHashFormat
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, ErrUnknownHashFormat
+	}
+
+	// argon2.IDKey panics on zero iterations or threads, and an empty key would match any password
+	if p.memory == 0 || p.iterations == 0 || p.parallelism == 0 || len(p.salt) == 0 || len(p.key) == 0 {
+		return p, ErrUnknownHashFormat
+	}
+	return p, nil
+}
+
+func (h Argon2idHasher) Verify(password string, encoded string) (bool, error) {
+	p, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	// the stored parameters are used, not the current ones, so older hashes still verify
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h Argon2idHasher) Owns(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	p, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.memory < h.Memory || p.iterations < h.Iterations || p.parallelism < h.Parallelism ||
+		uint32(len(p.salt)) < h.SaltLength || uint32(len(p.key)) < h.KeyLength
+}
+
+var (
+	bcryptHasher   = BcryptHasher{Cost: 14}
+	argon2idHasher = Argon2idHasher{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+	// every algorithm we can verify, whatever the current policy
+	knownHashers = []PasswordHasher{argon2idHasher, bcryptHasher}
+)
+
+// CurrentHasher is the algorithm new hashes are made with, PASSWORD_HASH_ALGO=bcrypt keeps the old behaviour
+func CurrentHasher() PasswordHasher {
+	if os.Getenv("PASSWORD_HASH_ALGO") == "bcrypt" {
+		return bcryptHasher
+	}
+	return argon2idHasher
+}
+
+func hasherFor(encoded string) (PasswordHasher, error) {
+	for _, h := range knownHashers {
+		if h.Owns(encoded) {
+			return h, nil
+		}
+	}
+	return nil, ErrUnknownHashFormat
+}
+
+// VerifyPasswordHash dispatches on the format of the stored hash
+func VerifyPasswordHash(password string, encoded string) (bool, error) {
+	h, err := hasherFor(encoded)
+	if err != nil {
+		return false, err
+	}
+	return h.Verify(password, encoded)
+}
+
+// PasswordNeedsRehash is true when the hash was made with another algorithm or older parameters than CurrentHasher
+func PasswordNeedsRehash(encoded string) bool {
+	current := CurrentHasher()
+	return !current.Owns(encoded) || current.NeedsRehash(encoded)
+}
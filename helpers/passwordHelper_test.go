@@ -0,0 +1,182 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap parameters, the format is the same whatever they are
+var (
+	testBcrypt   = BcryptHasher{Cost: bcrypt.MinCost}
+	testArgon2id = Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+)
+
+func TestPasswordHashRoundTrip(t *testing.T) {
+	for _, hasher := range []PasswordHasher{testBcrypt, testArgon2id} {
+		encoded, err := hasher.Hash("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasher.Owns(encoded) {
+			t.Errorf("%T does not own its hash %s", hasher, encoded)
+		}
+
+		if ok, err := VerifyPasswordHash("correct horse", encoded); !ok || err != nil {
+			t.Errorf("%T: right password refused: %v", hasher, err)
+		}
+		if ok, err := VerifyPasswordHash("correct horse ", encoded); ok || err != nil {
+			t.Errorf("%T: wrong password got %v, %v, want false without an error", hasher, ok, err)
+		}
+
+		again, _ := hasher.Hash("correct horse")
+		if again == encoded {
+			t.Errorf("%T: two hashes of the same password are equal, the salt is missing", hasher)
+		}
+	}
+}
+
+func TestArgon2idFormat(t *testing.T) {
+	encoded, err := testArgon2id.Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("not a PHC string: %s", encoded)
+	}
+
+	p, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.memory != 1024 || p.iterations != 1 || p.parallelism != 1 || len(p.salt) != 16 || len(p.key) != 32 {
+		t.Fatalf("decoded %+v", p)
+	}
+}
+
+func TestDecodeArgon2idRejects(t *testing.T) {
+	valid, _ := testArgon2id.Hash("pw")
+	parts := strings.Split(valid, "$")
+	salt, key := parts[4], parts[5]
+
+	cases := map[string]string{
+		"argon2i":           "$argon2i$v=19$m=1024,t=1,p=1$" + salt + "$" + key,
+		"other version":     "$argon2id$v=16$m=1024,t=1,p=1$" + salt + "$" + key,
+		"missing part":      "$argon2id$v=19$m=1024,t=1,p=1$" + salt,
+		"extra part":        valid + "$x",
+		"no parameters":     "$argon2id$v=19$$" + salt + "$" + key,
+		"zero iterations":   "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key,
+		"zero threads":      "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key,
+		"zero memory":       "$argon2id$v=19$m=0,t=1,p=1$" + salt + "$" + key,
+		"negative":          "$argon2id$v=19$m=1024,t=-1,p=1$" + salt + "$" + key,
+		"threads too large": "$argon2id$v=19$m=1024,t=1,p=256$" + salt + "$" + key,
+		"padded salt":       "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "==$" + key,
+		"bad key":           "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$not base64!",
+		"empty salt":        "$argon2id$v=19$m=1024,t=1,p=1$$" + key,
+		"empty key":         "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$",
+	}
+	for name, encoded := range cases {
+		if _, err := decodeArgon2id(encoded); err != ErrUnknownHashFormat {
+			t.Errorf("%s: got %v, want ErrUnknownHashFormat", name, err)
+		}
+		// a broken stored hash is an error, never a panic nor a match
+		if ok, err := VerifyPasswordHash("pw", encoded); ok || err == nil {
+			t.Errorf("%s: verified %v, %v", name, ok, err)
+		}
+	}
+}
+
+func TestHasherFor(t *testing.T) {
+	cases := map[string]PasswordHasher{
+		"$2a$10$abc":         bcryptHasher,
+		"$2b$10$abc":         bcryptHasher,
+		"$2y$10$abc":         bcryptHasher,
+		"$argon2id$v=19$...": argon2idHasher,
+	}
+	for encoded, want := range cases {
+		if got, err := hasherFor(encoded); err != nil || got != want {
+			t.Errorf("hasherFor(%q) = %T, %v", encoded, got, err)
+		}
+	}
+
+	for _, encoded := range []string{"", "plaintext", "$2x$10$abc", "$argon2i$v=19$...", "$scrypt$..."} {
+		if _, err := hasherFor(encoded); err != ErrUnknownHashFormat {
+			t.Errorf("hasherFor(%q) = %v, want ErrUnknownHashFormat", encoded, err)
+		}
+		if ok, err := VerifyPasswordHash("plaintext", encoded); ok || err != ErrUnknownHashFormat {
+			t.Errorf("VerifyPasswordHash(%q) = %v, %v", encoded, ok, err)
+		}
+	}
+}
+
+func TestBcryptHashUnderArgon2idPolicy(t *testing.T) {
+	t.Setenv("PASSWORD_HASH_ALGO", "argon2id")
+
+	encoded, err := testBcrypt.Hash("old password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// users created before the switch still log in, and get their hash upgraded
+	if ok, err := VerifyPasswordHash("old password", encoded); !ok || err != nil {
+		t.Fatalf("bcrypt hash refused under the argon2id policy: %v", err)
+	}
+	if !PasswordNeedsRehash(encoded) {
+		t.Fatal("bcrypt hash not upgraded under the argon2id policy")
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	// NeedsRehash only reads the cost of a bcrypt hash, no need to pay for cost 14
+	bcryptCost := func(cost string) string { return "$2a$" + cost + "$" + strings.Repeat("a", 53) }
+
+	current, err := argon2idHasher.Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weaker := func(change func(h *Argon2idHasher)) string {
+		h := argon2idHasher
+		change(&h)
+		encoded, err := h.Hash("pw")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+
+	argon2Policy := map[string]bool{
+		"current parameters": false,
+		"less memory":        true,
+		"fewer iterations":   true,
+		"fewer threads":      true,
+		"shorter salt":       true,
+		"shorter key":        true,
+		"bcrypt":             true,
+		"unreadable":         true,
+	}
+	hashes := map[string]string{
+		"current parameters": current,
+		"less memory":        weaker(func(h *Argon2idHasher) { h.Memory /= 2 }),
+		"fewer iterations":   weaker(func(h *Argon2idHasher) { h.Iterations-- }),
+		"fewer threads":      weaker(func(h *Argon2idHasher) { h.Parallelism-- }),
+		"shorter salt":       weaker(func(h *Argon2idHasher) { h.SaltLength = 8 }),
+		"shorter key":        weaker(func(h *Argon2idHasher) { h.KeyLength = 16 }),
+		"bcrypt":             bcryptCost("14"),
+		"unreadable":         "$argon2id$v=19$m=65536,t=0,p=2$c2FsdA$a2V5",
+	}
+
+	t.Setenv("PASSWORD_HASH_ALGO", "")
+	for name, want := range argon2Policy {
+		if got := PasswordNeedsRehash(hashes[name]); got != want {
+			t.Errorf("argon2id policy, %s: needs rehash %v, want %v", name, got, want)
+		}
+	}
+
+	t.Setenv("PASSWORD_HASH_ALGO", "bcrypt")
+	bcryptPolicy := map[string]bool{bcryptCost("14"): false, bcryptCost("15"): false, bcryptCost("10"): true, current: true, "$2a$": true}
+	for encoded, want := range bcryptPolicy {
+		if got := PasswordNeedsRehash(encoded); got != want {
+			t.Errorf("bcrypt policy, %.12s: needs rehash %v, want %v", encoded, got, want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package helpers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// PolicyViolation is one reason a password was rejected, Code is stable for clients and Message is for humans
+type PolicyViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordOwner is what we know about the user the password belongs to, used to reject passwords built from it
+type PasswordOwner struct {
+	Email      string
+	First_name string
+	Last_name  string
+}
+
+// PasswordPolicy is read from the environment, see PASSWORD_* in the README
+type PasswordPolicy struct {
+	MinLength  int // in characters
+	MaxBytes   int // bcrypt ignores everything after 72 bytes, so longer passwords would be silently truncated
+	MinClasses int // how many of lower, upper, digit and symbol must be present
+	Breached   *BreachedCorpus
+}
+
+var (
+	policyOnce    sync.Once
+	defaultPolicy PasswordPolicy
+)
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	policyOnce.Do(func() {
+		defaultPolicy = PasswordPolicy{
+			MinLength:  envInt("PASSWORD_MIN_LENGTH", 8),
+			MaxBytes:   envInt("PASSWORD_MAX_BYTES", 72),
+			MinClasses: envInt("PASSWORD_MIN_CLASSES", 2),
+		}
+		if path := os.Getenv("BREACHED_PASSWORDS_PATH"); path != "" {
+			defaultPolicy.Breached = &BreachedCorpus{Path: path}
+		}
+	})
+	return defaultPolicy
+}
+
+// CheckPassword returns every rule the password breaks, an empty slice means the password is accepted
+func (p PasswordPolicy) CheckPassword(password string, owner PasswordOwner) []PolicyViolation {
+	violations := []PolicyViolation{}
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, PolicyViolation{"too_short", "password must be at least " + strconv.Itoa(p.MinLength) + " characters long"})
+	}
+	if len(password) > p.MaxBytes {
+		violations = append(violations, PolicyViolation{"too_long", "password must be at most " + strconv.Itoa(p.MaxBytes) + " bytes long"})
+	}
+
+	if classes := characterClasses(password); classes < p.MinClasses {
+		violations = append(violations, PolicyViolation{"too_simple", "password must mix at least " + strconv.Itoa(p.MinClasses) + " of lowercase letters, uppercase letters, digits and symbols"})
+	}
+
+	if containsPersonalInfo(password, owner) {
+		violations = append(violations, PolicyViolation{"contains_personal_info", "password must not contain your email or name"})
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			// a missing corpus must not stop everyone from signing up
+			log.Println("could not check breached passwords:", err)
+		} else if breached {
+			violations = append(violations, PolicyViolation{"breached", "password has appeared in a data breach, kindly choose another one"})
+		}
+	}
+
+	return violations
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+func containsPersonalInfo(password string, owner PasswordOwner) bool {
+	lowered := strings.ToLower(password)
+
+	parts := []string{owner.First_name, owner.Last_name}
+	if at := strings.Index(owner.Email, "@"); at > 0 {
+		parts = append(parts, owner.Email[:at], owner.Email)
+	}
+
+	for _, part := range parts {
+		part = strings.ToLower(strings.TrimSpace(part))
+		// very short names would match far too many passwords
+		if len(part) >= 3 && strings.Contains(lowered, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// BreachedCorpus looks passwords up in a local copy of the Have I Been Pwned password list, by SHA-1.
+// Path is either:
+//   - a directory of range files named by the 5 character hash prefix (e.g. "5BAA6"), each line "<35 char suffix>:<count>",
+//     which is what the HIBP downloader produces
+//   - a single file ordered by hash, each line "<40 char hash>:<count>", searched with a binary search on disk
+//     so the multi gigabyte file is never loaded in memory
+type BreachedCorpus struct {
+	Path string
+}
+
+func (b *BreachedCorpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	info, err := os.Stat(b.Path)
+	if err != nil {
+		return false, err
+	}
+	if info.IsDir() {
+		return containsInRangeFile(filepath.Join(b.Path, hash[:5]), hash[5:])
+	}
+	return containsInSortedFile(b.Path, hash)
+}
+
+// lineHash returns the part of a corpus line before the count
+func lineHash(line []byte) string {
+	line = bytes.TrimRight(line, "\r\n")
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	return strings.ToUpper(string(line))
+}
+
+func containsInRangeFile(path string, suffix string) (bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// no file for a prefix means no breached password has it
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if lineHash(scanner.Bytes()) == suffix {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func containsInSortedFile(path string, hash string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	// lo is always the start of a line, and only lines starting in [lo, hi) can still match
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, line, err := lineAtOrAfter(file, mid)
+		if err == io.EOF || (err == nil && start >= hi) {
+			hi = mid
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		switch current := lineHash(line); {
+		case current == hash:
+			return true, nil
+		case current < hash:
+			lo = start + int64(len(line))
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// lineAtOrAfter returns the first line that starts at offset or later, with its trailing newline
+func lineAtOrAfter(file *os.File, offset int64) (int64, []byte, error) {
+	start := offset
+	if offset > 0 {
+		// the line starting at offset is the one right after the newline at offset-1
+		start = offset - 1
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, start, 1<<62))
+	if offset > 0 {
+		skipped, err := reader.ReadBytes('\n')
+		if err != nil {
+			return 0, nil, io.EOF
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := reader.ReadBytes('\n')
+	if len(line) == 0 {
+		return 0, nil, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	return start, line, nil
+}
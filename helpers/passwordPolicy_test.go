@@ -0,0 +1,156 @@
+package helpers
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func violationCodes(violations []PolicyViolation) string {
+	codes := make([]string, len(violations))
+	for i, violation := range violations {
+		codes[i] = violation.Code
+	}
+	return strings.Join(codes, ",")
+}
+
+func TestCheckPassword(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MaxBytes: 72, MinClasses: 2}
+	owner := PasswordOwner{Email: "ada.lovelace@example.com", First_name: "Ada", Last_name: "Lovelace"}
+
+	cases := []struct {
+		password string
+		want     string
+	}{
+		{"Tr0ub4dor", ""},
+		{"correct horse battery", ""}, // spaces count as symbols
+		{"correcthorsebattery", "too_simple"},
+		{"12345678", "too_simple"},
+		{"Ab1!", "too_short"},
+		{"ab", "too_short,too_simple"},
+		{"élève-été", ""},               // 9 characters, more bytes
+		{"ééé1", "too_short"},           // 4 characters in 8 bytes
+		{strings.Repeat("aB1", 24), ""}, // 72 bytes
+		{strings.Repeat("aB1", 24) + "x", "too_long"},
+		{strings.Repeat("é", 37) + "1", "too_long"}, // 38 characters, 75 bytes
+		{"ILoveLovelace1", "contains_personal_info"},
+		{"ada.lovelace-2024", "contains_personal_info"},
+		{"xADA.LOVELACE@EXAMPLE.COMx", "contains_personal_info"},
+		{"", "too_short,too_simple"},
+	}
+	for _, tc := range cases {
+		if got := violationCodes(policy.CheckPassword(tc.password, owner)); got != tc.want {
+			t.Errorf("CheckPassword(%q) = %q, want %q", tc.password, got, tc.want)
+		}
+	}
+
+	// names shorter than 3 characters would match far too many passwords, they are not looked for
+	if got := violationCodes(policy.CheckPassword("Always-99", PasswordOwner{First_name: "Al", Email: "al@example.com"})); got != "" {
+		t.Errorf("short name: %q", got)
+	}
+}
+
+func TestCharacterClasses(t *testing.T) {
+	cases := map[string]int{"": 0, "abc": 1, "aB": 2, "aB3": 3, "aB3!": 4, "ÉÀ": 1, "٣": 1, "a b": 2}
+	for password, want := range cases {
+		if got := characterClasses(password); got != want {
+			t.Errorf("characterClasses(%q) = %d, want %d", password, got, want)
+		}
+	}
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeSortedCorpus writes the single file format for the given passwords, counts of varying widths make
+// lines of different lengths so the binary search lands in the middle of lines
+func writeSortedCorpus(t *testing.T, passwords []string, newline string, trailing bool) string {
+	hashes := make([]string, len(passwords))
+	for i, password := range passwords {
+		hashes[i] = sha1Hex(password)
+	}
+	sort.Strings(hashes)
+
+	lines := make([]string, len(hashes))
+	for i, hash := range hashes {
+		lines[i] = fmt.Sprintf("%s:%d", hash, 1+i*i*37)
+	}
+	content := strings.Join(lines, newline)
+	if trailing && len(lines) > 0 {
+		content += newline
+	}
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords-sha1-ordered-by-hash.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBreachedCorpusSortedFile(t *testing.T) {
+	for size := 0; size <= 40; size++ {
+		breached := make([]string, size)
+		for i := range breached {
+			breached[i] = fmt.Sprintf("breached-%d", i)
+		}
+
+		for _, newline := range []string{"\n", "\r\n"} {
+			for _, trailing := range []bool{true, false} {
+				corpus := &BreachedCorpus{Path: writeSortedCorpus(t, breached, newline, trailing)}
+				name := fmt.Sprintf("%d lines, newline %q, trailing %v", size, newline, trailing)
+
+				for _, password := range breached {
+					if found, err := corpus.Contains(password); err != nil || !found {
+						t.Fatalf("%s: %q not found (%v)", name, password, err)
+					}
+				}
+				for i := 0; i < 20; i++ {
+					if found, err := corpus.Contains(fmt.Sprintf("safe-%d", i)); err != nil || found {
+						t.Fatalf("%s: safe-%d found (%v)", name, i, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestBreachedCorpusRangeFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, password := range []string{"password", "123456", "hunter2"} {
+		hash := sha1Hex(password)
+		// the HIBP downloader writes one file per prefix, lines are the suffix with CRLF
+		content := "0000000000000000000000000000000000A:3\r\n" + strings.ToLower(hash[5:]) + ":42\r\n"
+		if err := os.WriteFile(filepath.Join(dir, hash[:5]), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	corpus := &BreachedCorpus{Path: dir}
+	cases := map[string]bool{"password": true, "123456": true, "hunter2": true, "hunter3": false, "Password": false}
+	for password, want := range cases {
+		if found, err := corpus.Contains(password); err != nil || found != want {
+			t.Errorf("Contains(%q) = %v, %v, want %v", password, found, err, want)
+		}
+	}
+}
+
+func TestBreachedPasswordViolation(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MaxBytes: 72, MinClasses: 2,
+		Breached: &BreachedCorpus{Path: writeSortedCorpus(t, []string{"P@ssw0rd"}, "\n", true)}}
+	if got := violationCodes(policy.CheckPassword("P@ssw0rd", PasswordOwner{})); got != "breached" {
+		t.Errorf("breached password: %q", got)
+	}
+
+	// a missing corpus is logged, it doesn't refuse every password
+	policy.Breached = &BreachedCorpus{Path: filepath.Join(t.TempDir(), "missing")}
+	if got := violationCodes(policy.CheckPassword("P@ssw0rd", PasswordOwner{})); got != "" {
+		t.Errorf("missing corpus: %q", got)
+	}
+}
@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidPhone = errors.New("phone number is not valid, use the international format e.g. +14155550100")
+
+// E.164 => "+" followed by the country code and subscriber number, at most 15 digits and never starting with 0
+var e164Regex = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// numbers written without a country code are assumed to belong to DEFAULT_PHONE_COUNTRY_CODE
+func defaultCountryCode() string {
+	code := strings.TrimPrefix(os.Getenv("DEFAULT_PHONE_COUNTRY_CODE"), "+")
+	if code == "" {
+		code = "1"
+	}
+	return code
+}
+
+// NormalizePhone converts the ways people write numbers ("+1 (415) 555-0100", "0044 20 7946 0000", "4155550100")
+// into E.164, so the same number is always stored, and compared, the same way
+func NormalizePhone(raw string) (string, error) {
+	phone := strings.TrimSpace(raw)
+
+	international := false
+	switch {
+	case strings.HasPrefix(phone, "+"):
+		international = true
+		phone = phone[1:]
+	case strings.HasPrefix(phone, "00"):
+		international = true
+		phone = phone[2:]
+	}
+
+	var digits strings.Builder
+	for _, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+			// formatting characters are dropped
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	number := digits.String()
+	if !international {
+		// national numbers often carry a leading trunk prefix 0 that is not part of the international form
+		number = defaultCountryCode() + strings.TrimPrefix(number, "0")
+	}
+
+	number = "+" + number
+	if !e164Regex.MatchString(number) {
+		return "", ErrInvalidPhone
+	}
+	return number, nil
+}
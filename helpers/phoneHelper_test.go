@@ -0,0 +1,55 @@
+package helpers
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	t.Setenv("DEFAULT_PHONE_COUNTRY_CODE", "1")
+
+	cases := []struct {
+		raw  string
+		want string
+	}{
+		// the same number written in every usual way is stored once
+		{"+1 (555) 555-0100", "+15555550100"},
+		{"+15555550100", "+15555550100"},
+		{"555-555-0100", "+15555550100"},
+		{"(555) 555.0100", "+15555550100"},
+		{"001 555 555 0100", "+15555550100"},
+		{"  +1 555 555 0100  ", "+15555550100"},
+		{"5550100", "+15550100"},
+		{"0044 20 7946 0000", "+442079460000"},
+		{"+44 20 7946 0000", "+442079460000"},
+		{"+1 (555) 010", ""}, // too short once normalized
+		{"", ""},
+		{"+", ""},
+		{"+0 555 555 0100", ""},       // country codes never start with 0
+		{"+1 555 555 0100 99999", ""}, // more than 15 digits
+		{"+1 555 555 0100 ext 1", ""}, // letters
+		{"+1/555/555/0100", ""},       // unknown separator
+		{"+1 555 555 0100; drop", ""}, // anything else
+		{"+１５５５５５５０１００", ""},          // full-width digits are not digits here
+	}
+	for _, tc := range cases {
+		got, err := NormalizePhone(tc.raw)
+		if tc.want == "" {
+			if err != ErrInvalidPhone {
+				t.Errorf("NormalizePhone(%q) = %q, %v, want ErrInvalidPhone", tc.raw, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("NormalizePhone(%q) = %q, %v, want %q", tc.raw, got, err, tc.want)
+		}
+	}
+}
+
+func TestNormalizePhoneDefaultCountry(t *testing.T) {
+	t.Setenv("DEFAULT_PHONE_COUNTRY_CODE", "+44")
+
+	// the trunk prefix 0 of a national number is dropped
+	for _, raw := range []string{"020 7946 0000", "20 7946 0000"} {
+		if got, err := NormalizePhone(raw); err != nil || got != "+442079460000" {
+			t.Errorf("NormalizePhone(%q) = %q, %v, want +442079460000", raw, got, err)
+		}
+	}
+}
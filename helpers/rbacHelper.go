@@ -0,0 +1,248 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// permissions checked by the routes, a role can also hold "*" (everything) or "users:*" (everything on users)
+const (
+	PermUsersRead     = "users:read"
+	PermUsersWrite    = "users:write"
+	PermRolesRead     = "roles:read"
+	PermRolesWrite    = "roles:write"
+	PermRolesAssign   = "roles:assign"
+	PermPoliciesRead  = "policies:read"
+	PermPoliciesWrite = "policies:write"
+	PermGroupsRead    = "groups:read"
+	PermGroupsWrite   = "groups:write"
+	PermAuditRead     = "audit:read"
+	PermWebhooksRead  = "webhooks:read"
+	PermWebhooksWrite = "webhooks:write"
+)
+
+// KnownPermissions is the catalog seeded in the permissions collection
+var KnownPermissions = []models.Permission{
+	{Name: PermUsersRead, Description: "read any user"},
+	{Name: PermUsersWrite, Description: "modify any user"},
+	{Name: PermRolesRead, Description: "list roles and permissions"},
+	{Name: PermRolesWrite, Description: "create and edit roles"},
+	{Name: PermRolesAssign, Description: "change the roles of a user"},
+	{Name: PermPoliciesRead, Description: "list ABAC policies and explain decisions"},
+	{Name: PermPoliciesWrite, Description: "reload ABAC policies"},
+	{Name: PermGroupsRead, Description: "list groups and their members"},
+	{Name: PermGroupsWrite, Description: "create and edit groups and their members"},
+	{Name: PermAuditRead, Description: "read the audit log of admin actions"},
+	{Name: PermWebhooksRead, Description: "list webhooks and their deliveries"},
+	{Name: PermWebhooksWrite, Description: "create, delete and redeliver webhooks"},
+}
+
+// default roles, ADMIN and USER match the old user_type values so existing users keep their access.
+// Every role except SUPER_ADMIN only applies inside the organization of the user, see ScopedUserFilter.
+var defaultRoles = []models.Role{
+	{Name: "ADMIN", Description: "full access", Permissions: []string{"*"}},
+	{Name: "USER", Description: "access to own account only", Permissions: []string{}},
+	{Name: RoleOrgAdmin, Description: "manages the users of its own organization", Permissions: []string{PermUsersRead, PermUsersWrite, PermRolesRead, PermRolesAssign, PermGroupsRead, PermGroupsWrite, PermAuditRead, PermWebhooksRead, PermWebhooksWrite}},
+	{Name: RoleSuperAdmin, Description: "full access to every organization", Permissions: []string{"*"}},
+}
+
+var roleCollection *mongo.Collection = database.OpenCollection(database.Client, "roles")
+var permissionCollection *mongo.Collection = database.OpenCollection(database.Client, "permissions")
+
+func init() {
+	// names are unique per organization, the built-in roles have no tenant_id
+	database.EnsureIndexes(roleCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+	)
+	go seedRBAC()
+}
+
+// seedRBAC creates the catalog and default roles, roles edited by admins are never overwritten
+func seedRBAC() {
+	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// role names used to be unique across organizations, and roles created back then belong to the default one
+	var serverErr mongo.ServerError
+	if _, err := roleCollection.Indexes().DropOne(ctx, "name_1"); err != nil && !(errors.As(err, &serverErr) && serverErr.HasErrorCode(27)) { // 27: IndexNotFound
+		log.Println("could not drop the old role index:", err)
+	}
+	builtin := []string{}
+	for _, role := range defaultRoles {
+		builtin = append(builtin, role.Name)
+	}
+	if _, err := roleCollection.UpdateMany(ctx, bson.M{"name": bson.M{"$nin": builtin}, "tenant_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"tenant_id": DefaultTenant}}); err != nil {
+		log.Println("could not move roles to the default organization:", err)
+		return
+	}
+
+	upsert := true
+	opts := &options.UpdateOptions{Upsert: &upsert}
+
+	for _, permission := range KnownPermissions {
+		if _, err := permissionCollection.UpdateOne(ctx, bson.M{"_id": permission.Name},
+			bson.M{"$set": bson.M{"description": permission.Description}}, opts); err != nil {
+			log.Println("could not seed permissions:", err)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, role := range defaultRoles {
+		if _, err := roleCollection.UpdateOne(ctx, bson.M{"name": role.Name, "tenant_id": bson.M{"$exists": false}}, bson.M{"$setOnInsert": bson.M{
+			"description": role.Description,
+			"permissions": role.Permissions,
+			"created_at":  now,
+			"updated_at":  now,
+		}}, opts); err != nil {
+			log.Println("could not seed roles:", err)
+			return
+		}
+	}
+}
+
+// BuiltinRole tells whether a role is one of the default roles. Those are shared by every organization,
+// so only a SUPER_ADMIN may change them, any other role belongs to one organization.
+func BuiltinRole(name string) bool {
+	for _, role := range defaultRoles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleTenantFilter limits a role filter to the roles usable in an organization: its own and the built-in ones
+func RoleTenantFilter(tenantId string, filter bson.M) bson.M {
+	scoped := bson.M{}
+	for key, value := range filter {
+		scoped[key] = value
+	}
+	scoped["tenant_id"] = bson.M{"$in": []interface{}{NormalizeTenant(tenantId), nil}}
+	return scoped
+}
+
+// ScopedRoleFilter limits a role filter to the organization of the logged in user, unless that user is a SUPER_ADMIN
+func ScopedRoleFilter(c *gin.Context, filter bson.M) bson.M {
+	if CrossTenant(c) {
+		return filter
+	}
+	return RoleTenantFilter(c.GetString("tenant_id"), filter)
+}
+
+// UserRoles returns the roles of a user, users created before roles existed only have user_type
+func UserRoles(user models.User) []string {
+	if len(user.Roles) > 0 {
+		return user.Roles
+	}
+	if user.User_type != nil {
+		return []string{*user.User_type}
+	}
+	return []string{}
+}
+
+// role permissions are cached for a short time so that every request does not hit mongo,
+// a change of role made on another replica is picked up at most rolePermissionTTL later
+const rolePermissionTTL = 30 * time.Second
+
+type cachedRole struct {
+	permissions []string
+	fetched     time.Time
+}
+
+var (
+	roleCacheMu sync.Mutex
+	roleCache   = map[string]cachedRole{}
+)
+
+// InvalidateRoleCache forgets cached permissions, called when a role is edited on this replica
+func InvalidateRoleCache() {
+	roleCacheMu.Lock()
+	defer roleCacheMu.Unlock()
+
+	roleCache = map[string]cachedRole{}
+	invalidateAllUserPermissions()
+}
+
+// RolePermissions resolves roles to the union of their permissions in an organization, unknown roles and roles of
+// other organizations grant nothing
+func RolePermissions(ctx context.Context, tenantId string, roles []string) ([]string, error) {
+	tenantId = NormalizeTenant(tenantId)
+	permissions := []string{}
+	missing := []string{}
+
+	roleCacheMu.Lock()
+	for _, role := range roles {
+		cached, ok := roleCache[tenantId+"/"+role]
+		if ok && time.Since(cached.fetched) < rolePermissionTTL {
+			permissions = append(permissions, cached.permissions...)
+		} else {
+			missing = append(missing, role)
+		}
+	}
+	roleCacheMu.Unlock()
+
+	if len(missing) == 0 {
+		return permissions, nil
+	}
+
+	cursor, err := roleCollection.Find(ctx, RoleTenantFilter(tenantId, bson.M{"name": bson.M{"$in": missing}}))
+	if err != nil {
+		return nil, err
+	}
+	var found []models.Role
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	roleCacheMu.Lock()
+	defer roleCacheMu.Unlock()
+
+	now := time.Now()
+	for _, name := range missing {
+		// unknown roles are cached too, as granting nothing
+		roleCache[tenantId+"/"+name] = cachedRole{permissions: []string{}, fetched: now}
+	}
+	for _, role := range found {
+		roleCache[tenantId+"/"+role.Name] = cachedRole{permissions: role.Permissions, fetched: now}
+		permissions = append(permissions, role.Permissions...)
+	}
+	return permissions, nil
+}
+
+// PermissionGranted reports whether a granted permission covers the required one, with "*" and "resource:*" wildcards
+func PermissionGranted(granted []string, required string) bool {
+	for _, permission := range granted {
+		if permission == "*" || permission == required {
+			return true
+		}
+		if strings.HasSuffix(permission, ":*") && strings.HasPrefix(required, strings.TrimSuffix(permission, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission checks the roles put in the context by middleware.Authenticate and the groups of the user
+func HasPermission(c *gin.Context, required string) (bool, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	permissions, err := EffectivePermissions(ctx, c.GetString("uid"), c.GetString("tenant_id"), c.GetStringSlice("roles"))
+	if err != nil {
+		return false, err
+	}
+	return PermissionGranted(permissions, required), nil
+}
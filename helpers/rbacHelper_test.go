@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRoleTenantFilter(t *testing.T) {
+	filter := bson.M{"name": "SUPPORT"}
+	got := RoleTenantFilter("", filter)
+	want := bson.M{"name": "SUPPORT", "tenant_id": bson.M{"$in": []interface{}{DefaultTenant, nil}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if _, ok := filter["tenant_id"]; ok {
+		t.Fatal("the filter given was modified")
+	}
+
+	got = RoleTenantFilter("acme", bson.M{})
+	if !reflect.DeepEqual(got, bson.M{"tenant_id": bson.M{"$in": []interface{}{"acme", nil}}}) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestRolePermissionsStayInTheirTenant(t *testing.T) {
+	requireMongo(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	name := "TEST_ROLE_" + primitive.NewObjectID().Hex()
+	now := time.Now().UTC()
+	if _, err := roleCollection.InsertOne(ctx, bson.M{"_id": primitive.NewObjectID(), "name": name, "tenant_id": "test-a",
+		"permissions": []string{PermGroupsRead}, "created_at": now, "updated_at": now}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		roleCollection.DeleteMany(context.Background(), bson.M{"name": name})
+		InvalidateRoleCache()
+	})
+
+	got, err := RolePermissions(ctx, "test-a", []string{name, "USER"})
+	if err != nil || !reflect.DeepEqual(got, []string{PermGroupsRead}) {
+		t.Fatalf("own tenant: %v, %v", got, err)
+	}
+	// the cache is per tenant too
+	got, err = RolePermissions(ctx, "test-b", []string{name})
+	if err != nil || len(got) != 0 {
+		t.Fatalf("other tenant: %v, %v", got, err)
+	}
+}
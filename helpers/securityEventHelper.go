@@ -0,0 +1,130 @@
+package helpers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// security event types
+const (
+	SecurityLogin          = "login" // details.method: password, totp, recovery_code, passkey, magic_link or invitation
+	SecurityTokenRefresh   = "token.refresh"
+	SecurityPasswordChange = "password.change"
+	SecurityPasswordReset  = "password.reset"
+	SecurityMfaEnable      = "mfa.enable"
+	SecurityMfaReset       = "mfa.reset"
+	SecurityPasskeyAdd     = "passkey.add"
+	SecurityPasskeyRemove  = "passkey.remove"
+	SecurityAccountLock    = "account.lock"
+	SecuritySessionRevoke  = "session.revoke"
+)
+
+// security event outcomes
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeBlocked = "blocked" // refused by the lockout before the credentials were checked
+)
+
+var securityEventCollection *mongo.Collection = database.OpenCollection(database.Client, "security_events")
+
+func init() {
+	// every event carries its own expiry, so a new retention applies to new events without rebuilding the index
+	database.EnsureIndexes(securityEventCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+}
+
+// SECURITY_EVENT_RETENTION_DAYS is how long security events are kept, 90 days by default
+func securityEventRetention() time.Duration {
+	return time.Duration(envInt("SECURITY_EVENT_RETENTION_DAYS", 90)) * 24 * time.Hour
+}
+
+// RecordSecurityEvent stores an event of the account userId with the ip and user agent of the request.
+// Like RecordAudit it is called after the fact, so a failure is only logged.
+func RecordSecurityEvent(c *gin.Context, userId string, tenantId string, eventType string, outcome string, details map[string]interface{}) {
+	if userId == "" {
+		return
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	event := models.SecurityEvent{
+		ID:         primitive.NewObjectID(),
+		User_id:    userId,
+		Tenant_id:  NormalizeTenant(tenantId),
+		Type:       eventType,
+		Outcome:    outcome,
+		Ip:         c.ClientIP(),
+		User_agent: c.GetHeader("User-Agent"),
+		Details:    details,
+		Created_at: now,
+		Expires_at: now.Add(securityEventRetention()),
+	}
+	if _, err := securityEventCollection.InsertOne(ctx, event); err != nil {
+		log.Printf("could not write security event %s of %s: %v", eventType, userId, err)
+	}
+}
+
+// RecordAccountSecurityEvent is RecordSecurityEvent for the places that only know the email of the account,
+// e.g. a login refused by the lockout. Nothing is recorded when no account has this email.
+func RecordAccountSecurityEvent(c *gin.Context, tenantId string, email string, eventType string, outcome string, details map[string]interface{}) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := userCollection.FindOne(ctx, ScopeToTenant(tenantId, bson.M{"email": email}),
+		options.FindOne().SetProjection(bson.M{"user_id": 1, "tenant_id": 1})).Decode(&user)
+	if err != nil || user.User_id == nil {
+		return
+	}
+	RecordSecurityEvent(c, *user.User_id, TenantOf(user), eventType, outcome, details)
+}
+
+// SecurityEventSort is the order of the event feed, newest first
+var SecurityEventSort = bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}
+
+// ListSecurityEvents returns up to limit events of a user matching filter, after the cursor when there is one.
+// The raw documents are returned too, to make the cursor of the next page.
+func ListSecurityEvents(ctx context.Context, userId string, filter bson.M, cursor *PageCursor, limit int) ([]models.SecurityEvent, []bson.M, error) {
+	filter["user_id"] = userId
+	if cursor != nil {
+		filter = bson.M{"$and": []bson.M{filter, KeysetFilter(SecurityEventSort, cursor.Values)}}
+	}
+
+	result, err := securityEventCollection.Find(ctx, filter, options.Find().SetSort(SecurityEventSort).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var docs []bson.M
+	if err := result.All(ctx, &docs); err != nil {
+		return nil, nil, err
+	}
+
+	events := make([]models.SecurityEvent, 0, len(docs))
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		var event models.SecurityEvent
+		if err := bson.Unmarshal(raw, &event); err != nil {
+			return nil, nil, err
+		}
+		events = append(events, event)
+	}
+	return events, docs, nil
+}
@@ -0,0 +1,210 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RefreshTokenTTL is the lifetime of a refresh token, every refresh starts a new one
+const RefreshTokenTTL = 168 * time.Hour
+
+var (
+	ErrSessionRevoked = errors.New("session has been revoked, kindly login again")
+	ErrRefreshReused  = errors.New("refresh token was already used, the session has been revoked")
+)
+
+var sessionCollection *mongo.Collection = database.OpenCollection(database.Client, "sessions")
+
+func init() {
+	// a session is deleted once its last refresh token expired, revoked sessions are kept until then to detect reuse
+	database.EnsureIndexes(sessionCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "session_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_used_at", Value: -1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+}
+
+// DeviceName is what the client calls itself in the X-Device-Name header, otherwise a guess from the user agent
+func DeviceName(header string, userAgent string) string {
+	if header = strings.TrimSpace(header); header != "" {
+		if len(header) > 100 {
+			header = header[:100]
+		}
+		return header
+	}
+
+	ua := strings.ToLower(userAgent)
+	for _, platform := range []struct{ match, name string }{
+		{"iphone", "iPhone"}, {"ipad", "iPad"}, {"android", "Android"}, {"windows", "Windows"},
+		{"macintosh", "Mac"}, {"mac os", "Mac"}, {"linux", "Linux"},
+	} {
+		if strings.Contains(ua, platform.match) {
+			return platform.name
+		}
+	}
+	return "Unknown device"
+}
+
+// CreateSession starts the session of a new login, the first refresh token of the family gets Refresh_jti
+func CreateSession(ctx context.Context, user models.User, device string, userAgent string, ip string) (models.Session, error) {
+	sessionId, err := RandomToken(18)
+	if err != nil {
+		return models.Session{}, err
+	}
+	family, err := RandomToken(18)
+	if err != nil {
+		return models.Session{}, err
+	}
+	jti, err := RandomToken(18)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	now := time.Now().UTC()
+	session := models.Session{
+		ID:             primitive.NewObjectID(),
+		Session_id:     sessionId,
+		User_id:        *user.User_id,
+		Tenant_id:      TenantOf(user),
+		Device:         device,
+		User_agent:     userAgent,
+		Ip:             ip,
+		Refresh_family: family,
+		Refresh_jti:    jti,
+		Created_at:     now,
+		Last_used_at:   now,
+		Expires_at:     now.Add(RefreshTokenTTL),
+	}
+	_, err = sessionCollection.InsertOne(ctx, session)
+	return session, err
+}
+
+// RotateSessionRefresh exchanges the refresh token jti of a session for a new one. Only the latest refresh token of a
+// family is valid: an older one means two parties hold the tokens of the session, so the whole session is revoked.
+func RotateSessionRefresh(ctx context.Context, sessionId string, jti string, ip string) (models.Session, error) {
+	newJti, err := RandomToken(18)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	now := time.Now().UTC()
+	after := options.After
+
+	// matching the old jti in the filter makes the rotation atomic, two refreshes with the same token can't both win
+	var session models.Session
+	err = sessionCollection.FindOneAndUpdate(ctx,
+		bson.M{"session_id": sessionId, "refresh_jti": jti, "revoked_at": nil, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"refresh_jti": newJti, "last_used_at": now, "ip": ip, "expires_at": now.Add(RefreshTokenTTL)}},
+		&options.FindOneAndUpdateOptions{ReturnDocument: &after},
+	).Decode(&session)
+	if err == nil {
+		return session, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return session, err
+	}
+
+	err = sessionCollection.FindOne(ctx, bson.M{"session_id": sessionId}).Decode(&session)
+	if err == mongo.ErrNoDocuments || (err == nil && (session.Revoked_at != nil || !session.Expires_at.After(now))) {
+		return session, ErrSessionRevoked
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if _, err := RevokeSessions(ctx, bson.M{"session_id": sessionId}); err != nil {
+		return session, err
+	}
+	return session, ErrRefreshReused
+}
+
+// ListSessions returns the active sessions of a user, the most recently used first
+func ListSessions(ctx context.Context, userId string) ([]models.Session, error) {
+	cursor, err := sessionCollection.Find(ctx,
+		bson.M{"user_id": userId, "revoked_at": nil, "expires_at": bson.M{"$gt": time.Now().UTC()}},
+		options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSessions revokes the active sessions matching filter and returns how many there were
+func RevokeSessions(ctx context.Context, filter bson.M) (int64, error) {
+	filter["revoked_at"] = nil
+	now := time.Now().UTC()
+
+	result, err := sessionCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": now}})
+	clearSessionCache()
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// session states are cached like account states, a revocation on another replica is seen within sessionStateTTL
+const sessionStateTTL = 5 * time.Second
+
+// last_used_at is written at most once a minute per session, not on every request
+const sessionTouchInterval = time.Minute
+
+type cachedSessionState struct {
+	active  bool
+	fetched time.Time
+}
+
+var (
+	sessionStateMu    sync.Mutex
+	sessionStateCache = map[string]cachedSessionState{}
+)
+
+func clearSessionCache() {
+	sessionStateMu.Lock()
+	defer sessionStateMu.Unlock()
+
+	sessionStateCache = map[string]cachedSessionState{}
+}
+
+// SessionActive tells middleware.Authenticate whether the session of an access token was revoked
+func SessionActive(ctx context.Context, sessionId string) (bool, error) {
+	sessionStateMu.Lock()
+	cached, ok := sessionStateCache[sessionId]
+	sessionStateMu.Unlock()
+	if ok && time.Since(cached.fetched) < sessionStateTTL {
+		return cached.active, nil
+	}
+
+	now := time.Now().UTC()
+	_, err := sessionCollection.UpdateOne(ctx,
+		bson.M{"session_id": sessionId, "revoked_at": nil, "last_used_at": bson.M{"$lt": now.Add(-sessionTouchInterval)}},
+		bson.M{"$set": bson.M{"last_used_at": now}})
+	if err != nil {
+		return false, err
+	}
+	count, err := sessionCollection.CountDocuments(ctx, bson.M{"session_id": sessionId, "revoked_at": nil, "expires_at": bson.M{"$gt": now}})
+	if err != nil {
+		return false, err
+	}
+	active := count > 0
+
+	sessionStateMu.Lock()
+	sessionStateCache[sessionId] = cachedSessionState{active: active, fetched: time.Now()}
+	sessionStateMu.Unlock()
+
+	return active, nil
+}
@@ -0,0 +1,128 @@
+package helpers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultTenant is the organization of users created before organizations existed, they have no tenant_id
+const DefaultTenant = "default"
+
+// roles that deal with tenants, ORG_ADMIN manages the users of its own organization, SUPER_ADMIN works across all of them
+const (
+	RoleSuperAdmin = "SUPER_ADMIN"
+	RoleOrgAdmin   = "ORG_ADMIN"
+)
+
+var organizationCollection *mongo.Collection = database.OpenCollection(database.Client, "organizations")
+
+func init() {
+	database.EnsureIndexes(organizationCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	)
+	// an email (and a phone) can be used once per organization
+	database.EnsureIndexes(userCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "phone", Value: 1}}},
+	)
+	go seedDefaultOrganization()
+}
+
+func seedDefaultOrganization() {
+	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	upsert := true
+	_, err := organizationCollection.UpdateOne(ctx, bson.M{"tenant_id": DefaultTenant}, bson.M{"$setOnInsert": bson.M{
+		"_id":        primitive.NewObjectID(),
+		"name":       "Default",
+		"created_at": now,
+		"updated_at": now,
+	}}, &options.UpdateOptions{Upsert: &upsert})
+	if err != nil {
+		log.Println("could not seed the default organization:", err)
+	}
+}
+
+// NormalizeTenant maps a missing tenant to DefaultTenant
+func NormalizeTenant(tenantId string) string {
+	if tenantId == "" {
+		return DefaultTenant
+	}
+	return tenantId
+}
+
+// TenantOf returns the organization of a user
+func TenantOf(user models.User) string {
+	if user.Tenant_id == nil {
+		return DefaultTenant
+	}
+	return NormalizeTenant(*user.Tenant_id)
+}
+
+// ScopeToTenant adds the tenant condition to a user filter, users of the default tenant may have no tenant_id at all
+func ScopeToTenant(tenantId string, filter bson.M) bson.M {
+	scoped := bson.M{}
+	for key, value := range filter {
+		scoped[key] = value
+	}
+
+	tenantId = NormalizeTenant(tenantId)
+	if tenantId == DefaultTenant {
+		scoped["tenant_id"] = bson.M{"$in": []interface{}{DefaultTenant, nil}}
+	} else {
+		scoped["tenant_id"] = tenantId
+	}
+	return scoped
+}
+
+// CrossTenant reports whether the logged in user may work on every tenant
+func CrossTenant(c *gin.Context) bool {
+	return c.GetString("scope") == ScopeFull && CheckUserType(c, RoleSuperAdmin) == nil
+}
+
+// ScopedUserFilter limits a user filter to the tenant of the logged in user, unless that user is a SUPER_ADMIN.
+// Every query on users made on behalf of a logged in user goes through here, it works the same for any collection with a tenant_id (groups ...).
+func ScopedUserFilter(c *gin.Context, filter bson.M) bson.M {
+	if CrossTenant(c) {
+		return filter
+	}
+	return ScopeToTenant(c.GetString("tenant_id"), filter)
+}
+
+// TenantOpenForSignup tells whether anyone may self signup into the organization. The default organization is open
+// (ALLOW_SELF_SIGNUP closes it), any other one only when it was created with open_signup.
+func TenantOpenForSignup(ctx context.Context, tenantId string) (bool, error) {
+	tenantId = NormalizeTenant(tenantId)
+	if tenantId == DefaultTenant {
+		return TenantExists(ctx, tenantId)
+	}
+
+	count, err := organizationCollection.CountDocuments(ctx, bson.M{"tenant_id": tenantId, "open_signup": true})
+	return count > 0, err
+}
+
+// TenantExists checks that an organization was created for the tenant
+func TenantExists(ctx context.Context, tenantId string) (bool, error) {
+	count, err := organizationCollection.CountDocuments(ctx, bson.M{"tenant_id": NormalizeTenant(tenantId)})
+	return count > 0, err
+}
+
+// LoginAccount is the key of an account for the login lockout, the same email in two tenants is two accounts
+func LoginAccount(tenantId string, email string) string {
+	tenantId = NormalizeTenant(tenantId)
+	if tenantId == DefaultTenant {
+		return email // keeps the counters made before tenants existed
+	}
+	return tenantId + "/" + email
+}
@@ -1,7 +1,6 @@
 package helpers
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"os"
@@ -9,47 +8,104 @@ import (
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/someshnayak29/golang-jwt-project/database"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/someshnayak29/golang-jwt-project/models"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type SignedDetails struct {
-	Email      string
-	First_name string
-	Last_name  string
-	Uid        string
-	User_type  string
+	Email         string
+	First_name    string
+	Last_name     string
+	Uid           string
+	User_type     string
+	Roles         []string
+	Region        string
+	Tenant_id     string
+	Token_version int    // User.Token_version when the token was issued, see RevokeUserTokens
+	Session_id    string `json:"sid,omitempty"` // models.Session of the login, missing in tokens issued before sessions existed
+	Scope         string
 	jwt.StandardClaims
 }
 
+// scopes of an access token, a restricted token is only accepted by routes that do not use middleware.RequireVerifiedEmail
+const (
+	ScopeFull       = "full"
+	ScopeUnverified = "unverified"
+	ScopeMfa        = "mfa" // password was correct but a second factor is still needed, only accepted by /users/login/mfa
+	ScopeMagicLink  = "magic_link"
+	ScopeInvitation = "invitation"
+	ScopeRefresh    = "refresh" // only accepted by /users/token/refresh
+)
+
+// MfaChallengeTTL is how long the user has to type the code after the password was accepted
+const MfaChallengeTTL = 5 * time.Minute
+
+// UNVERIFIED_EMAIL_POLICY decides what a user who has not verified the email may do:
+// "restrict" (default) => login works but the token has ScopeUnverified, "block" => login is refused
+const (
+	UnverifiedPolicyRestrict = "restrict"
+	UnverifiedPolicyBlock    = "block"
+)
+
+func UnverifiedEmailPolicy() string {
+	if os.Getenv("UNVERIFIED_EMAIL_POLICY") == UnverifiedPolicyBlock {
+		return UnverifiedPolicyBlock
+	}
+	return UnverifiedPolicyRestrict
+}
+
+// ScopeFor returns the scope a user should get based on the verification state of the email
+func ScopeFor(emailVerified bool) string {
+	if emailVerified {
+		return ScopeFull
+	}
+	return ScopeUnverified
+}
+
 // embedding jwt.StandardClaims into your custom claims struct, you can include both standard and custom claim data in your JWT tokens.
 
 var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
 var SECRET_KEY string = os.Getenv("SECRET_KEY")
 
-func GenerateAllTokens(email string, firstName string, lastName string, userType string, uid string) (signedToken string, signedRefreshToken string, err error) {
+// GenerateAllTokens takes the whole user, the claims are picked from it.
+// Both tokens belong to session, the refresh token is the one of session.Refresh_jti.
+func GenerateAllTokens(user models.User, scope string, session models.Session) (signedToken string, signedRefreshToken string, err error) {
 	// claims is the detail with which token will be made from
 	// expiresAt => time after which token expires, i.e. in our case 24 hrs after creation
 	// refresh token to create new token i.e. after 168 hrs
 	// newwithclaims func to create token, SigningMethodHS256 algo to create token, signed using secret key
 	// Unix returns t as a Unix time, the number of seconds elapsed since January 1, 1970 UTC.
 
+	region := ""
+	if user.Region != nil {
+		region = *user.Region
+	}
+
 	claims := &SignedDetails{
-		Email:      email,
-		First_name: firstName,
-		Last_name:  lastName,
-		Uid:        uid,
-		User_type:  userType,
+		Email:         *user.Email,
+		First_name:    *user.First_name,
+		Last_name:     *user.Last_name,
+		Uid:           *user.User_id,
+		User_type:     *user.User_type,
+		Roles:         UserRoles(user),
+		Region:        region,
+		Tenant_id:     TenantOf(user),
+		Token_version: user.Token_version,
+		Session_id:    session.Session_id,
+		Scope:         scope,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(24)).Unix(),
 		},
 	}
 
 	refreshClaims := &SignedDetails{
+		Uid:           *user.User_id,
+		Token_version: user.Token_version,
+		Session_id:    session.Session_id,
+		Scope:         ScopeRefresh,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(168)).Unix(),
+			Id:        session.Refresh_jti,
+			ExpiresAt: time.Now().Local().Add(RefreshTokenTTL).Unix(),
 		},
 	}
 
@@ -68,6 +124,51 @@ func GenerateAllTokens(email string, firstName string, lastName string, userType
 	return token, refreshToken, err
 }
 
+// GenerateMfaChallenge returns the short lived token handed out instead of the real tokens when MFA is enabled
+func GenerateMfaChallenge(uid string) (string, error) {
+	claims := &SignedDetails{
+		Uid:   uid,
+		Scope: ScopeMfa,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Local().Add(MfaChallengeTTL).Unix(),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+}
+
+// GenerateMagicLinkToken signs the token put in a magic login link, jti is a one time token that makes the link single use
+func GenerateMagicLinkToken(uid string, jti string, ttl time.Duration) (string, error) {
+	claims := &SignedDetails{
+		Uid:   uid,
+		Scope: ScopeMagicLink,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			ExpiresAt: time.Now().Local().Add(ttl).Unix(),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+}
+
+// GenerateInvitationToken signs the token put in an invitation link, the role and tenant can't be changed by the invitee.
+// jti is a one time token that makes the invitation single use and revocable.
+func GenerateInvitationToken(invitation models.Invitation, jti string, ttl time.Duration) (string, error) {
+	claims := &SignedDetails{
+		Uid:       *invitation.Invitation_id,
+		Email:     *invitation.Email,
+		Tenant_id: *invitation.Tenant_id,
+		Roles:     invitation.Roles,
+		Scope:     ScopeInvitation,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			ExpiresAt: time.Now().Local().Add(ttl).Unix(),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+}
+
 func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 
 	// It parses the signedToken and validates its signature using the SECRET_KEY.
@@ -111,42 +212,3 @@ func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 	return claims, msg
 
 }
-
-// primitive.D in Go provides a convenient way to work with BSON documents in mongoDB
-// primitive.E is key value pair
-
-// The Upsert option in options. UpdateOptions specifies whether to perform an upsert operation.
-// An upsert operation updates a document if it exists, or inserts it if it does not exist.
-
-/* error : go.mongodb.org/mongo-driver/bson/primitive.E struct literal uses unkeyed fields
-   solved using Key : "", Value:"" in bson.E and inside bson.D as all elements inside bson.D is bson.E */
-
-func UpdateAllTokens(signedToken string, signedRefreshToken string, userId string) {
-
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-
-	var updateObj primitive.D
-
-	updateObj = append(updateObj, bson.E{Key: "token", Value: signedToken})
-	updateObj = append(updateObj, bson.E{Key: "refresh_token", Value: signedRefreshToken})
-
-	Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: Updated_at})
-
-	upsert := true
-	filter := bson.M{"user_id": userId}
-	opt := options.UpdateOptions{
-		Upsert: &upsert,
-	}
-
-	_, err := userCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}}, &opt)
-
-	defer cancel()
-
-	if err != nil {
-		log.Panic(err)
-		return
-	}
-	//return
-
-}
@@ -0,0 +1,137 @@
+package helpers
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA1 key of RFC 4226 and RFC 6238, base32 encoded as authenticator apps get it
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTPVectors(t *testing.T) {
+	// RFC 4226 Appendix D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := hotp([]byte("12345678901234567890"), uint64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestTOTPVectors(t *testing.T) {
+	// RFC 6238 Appendix B, SHA1 rows, the 6 digit code being the last 6 digits of the 8 digit one
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tc := range cases {
+		now := time.Unix(tc.unix, 0)
+		code := tc.code[2:]
+		if step := ValidateTOTP(rfcSecret, code, now); step != tc.unix/30 {
+			t.Errorf("at %d: ValidateTOTP(%s) = step %d, want %d", tc.unix, code, step, tc.unix/30)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	key := []byte("12345678901234567890")
+	current := TOTPStep(now)
+
+	cases := map[int64]bool{-3: false, -2: false, -1: true, 0: true, 1: true, 2: false}
+	for offset, accepted := range cases {
+		code := hotp(key, uint64(current+offset))
+		step := ValidateTOTP(rfcSecret, code, now)
+		if accepted && step != current+offset {
+			t.Errorf("code of step %+d refused", offset)
+		}
+		if !accepted && step != 0 {
+			t.Errorf("code of step %+d accepted", offset)
+		}
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	// the secret as typed from the app, the code with spaces around
+	if step := ValidateTOTP(" "+strings.ToLower(rfcSecret)+" ", " 287082 ", now); step != 1 {
+		t.Errorf("lowercase secret and spaces refused: step %d", step)
+	}
+
+	for _, code := range []string{"", "28708", "2870820", "94287082", "287083", "abcdef", "287 082"} {
+		if step := ValidateTOTP(rfcSecret, code, now); step != 0 {
+			t.Errorf("ValidateTOTP(%q) = step %d, want 0", code, step)
+		}
+	}
+	for _, secret := range []string{"", "not base32!", "GEZDGNBVGY3TQOJQ="} {
+		if step := ValidateTOTP(secret, "287082", now); step != 0 {
+			t.Errorf("secret %q: step %d, want 0", secret, step)
+		}
+	}
+}
+
+func TestTOTPSecretAndURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+
+	uri, err := url.Parse(TOTPURI("Acme Corp", "ada@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Acme Corp:ada@example.com" ||
+		query.Get("secret") != secret || query.Get("issuer") != "Acme Corp" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("unexpected uri %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 9 || code[4] != '-' || strings.ContainsAny(code, "01ilo") || NormalizeRecoveryCode(code) != code {
+			t.Errorf("unexpected recovery code %q", code)
+		}
+		if seen[code] {
+			t.Errorf("recovery code %q given twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	cases := map[string]string{
+		"k3f9-x2mq":     "k3f9-x2mq",
+		"K3F9-X2MQ":     "k3f9-x2mq",
+		"k3f9x2mq":      "k3f9-x2mq",
+		" k3f9 x2mq ":   "k3f9-x2mq",
+		"k3-f9-x2-mq":   "k3f9-x2mq",
+		"k3f9-x2m":      "k3f9x2m", // not 8 characters, kept as is so it simply won't match
+		"k3f9-x2mq-abc": "k3f9x2mqabc",
+		"":              "",
+	}
+	for raw, want := range cases {
+		if got := NormalizeRecoveryCode(raw); got != want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package helpers
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// fields GET /users can be sorted on, each one has an index (behind tenant_id, which every list is filtered on)
+var userSortFields = []string{"created_at", "updated_at", "email", "first_name", "last_name", "user_type"}
+
+func init() {
+	indexes := []mongo.IndexModel{}
+	for _, field := range userSortFields {
+		if field == "email" {
+			continue // already unique per tenant, see tenantHelper
+		}
+		indexes = append(indexes, mongo.IndexModel{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: field, Value: 1}}})
+	}
+	database.EnsureIndexes(userCollection, indexes...)
+}
+
+// UserListQuery is GET /users translated for the aggregation pipeline
+type UserListQuery struct {
+	Filter bson.M
+	Sort   bson.D
+}
+
+// values go into the filter as plain strings so they can't become operators, these patterns just reject nonsense early
+var (
+	userTypePattern    = regexp.MustCompile(`^[A-Z_]{2,50}$`)
+	emailDomainPattern = regexp.MustCompile(`^[A-Za-z0-9.-]{1,253}$`)
+)
+
+// ParseUserListQuery reads the filters of GET /users:
+//
+//	user_type=ADMIN                           primary role
+//	email_domain=example.com                  case insensitive
+//	created_from=2024-01-01&created_to=...    RFC 3339 or YYYY-MM-DD, created_to is exclusive
+//	email_verified=true&phone_verified=false
+//	search=jo                                 case insensitive prefix of first name, last name or email
+//	sort=-created_at,last_name                fields of userSortFields, - for descending
+//
+// An invalid value is rejected. Field names and operators are all fixed here, the client only supplies values.
+func ParseUserListQuery(query url.Values) (UserListQuery, error) {
+	filter := bson.M{}
+
+	if userType := query.Get("user_type"); userType != "" {
+		if !userTypePattern.MatchString(userType) {
+			return UserListQuery{}, fmt.Errorf("user_type is invalid")
+		}
+		filter["user_type"] = userType
+	}
+
+	if domain := query.Get("email_domain"); domain != "" {
+		if !emailDomainPattern.MatchString(domain) {
+			return UserListQuery{}, fmt.Errorf("email_domain is invalid")
+		}
+		filter["email"] = primitive.Regex{Pattern: "@" + regexp.QuoteMeta(domain) + "$", Options: "i"}
+	}
+
+	created := bson.M{}
+	for param, operator := range map[string]string{"created_from": "$gte", "created_to": "$lt"} {
+		if value := query.Get(param); value != "" {
+			t, err := parseQueryTime(value)
+			if err != nil {
+				return UserListQuery{}, fmt.Errorf("%s must be RFC 3339 or YYYY-MM-DD", param)
+			}
+			created[operator] = t
+		}
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	for _, param := range []string{"email_verified", "phone_verified"} {
+		if value := query.Get(param); value != "" {
+			verified, err := strconv.ParseBool(value)
+			if err != nil {
+				return UserListQuery{}, fmt.Errorf("%s must be true or false", param)
+			}
+			if verified {
+				filter[param] = true
+			} else {
+				filter[param] = bson.M{"$ne": true} // users created before verification existed have no field
+			}
+		}
+	}
+
+	if search := strings.TrimSpace(query.Get("search")); search != "" {
+		if len(search) > 100 {
+			return UserListQuery{}, fmt.Errorf("search is too long")
+		}
+		// QuoteMeta so that the text is matched literally, the client can't send a regular expression
+		prefix := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(search), Options: "i"}
+		filter["$or"] = []bson.M{{"first_name": prefix}, {"last_name": prefix}, {"email": prefix}}
+	}
+
+	sort, err := parseUserSort(query.Get("sort"))
+	if err != nil {
+		return UserListQuery{}, err
+	}
+
+	return UserListQuery{Filter: filter, Sort: sort}, nil
+}
+
+func parseUserSort(value string) (bson.D, error) {
+	sort := bson.D{}
+	seen := map[string]bool{}
+
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		direction := 1
+		if strings.HasPrefix(field, "-") {
+			direction = -1
+			field = field[1:]
+		}
+		if !containsString(userSortFields, field) {
+			return nil, fmt.Errorf("can not sort on %q, allowed fields are %s", field, strings.Join(userSortFields, ", "))
+		}
+		if !seen[field] {
+			seen[field] = true
+			sort = append(sort, bson.E{Key: field, Value: direction})
+		}
+	}
+
+	// _id last, so that users with the same value keep a stable order between pages
+	return append(sort, bson.E{Key: "_id", Value: 1}), nil
+}
+
+func parseQueryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
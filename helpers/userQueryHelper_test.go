@@ -0,0 +1,112 @@
+package helpers
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func parseTestQuery(t *testing.T, raw string) (UserListQuery, error) {
+	t.Helper()
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ParseUserListQuery(values)
+}
+
+func TestParseUserListQuery(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 12, 30, 0, 0, time.FixedZone("", 2*60*60))
+
+	cases := []struct {
+		query string
+		want  bson.M
+	}{
+		{"", bson.M{}},
+		{"user_type=ADMIN", bson.M{"user_type": "ADMIN"}},
+		{"email_domain=example.com", bson.M{"email": primitive.Regex{Pattern: `@example\.com$`, Options: "i"}}},
+		{"created_from=2024-01-01", bson.M{"created_at": bson.M{"$gte": from}}},
+		{"created_from=2024-01-01&created_to=2024-02-01T12:30:00%2B02:00", bson.M{"created_at": bson.M{"$gte": from, "$lt": to}}},
+		{"email_verified=true&phone_verified=false", bson.M{"email_verified": true, "phone_verified": bson.M{"$ne": true}}},
+		{"email_verified=1", bson.M{"email_verified": true}},
+		{"search=jo", bson.M{"$or": []bson.M{
+			{"first_name": primitive.Regex{Pattern: "^jo", Options: "i"}},
+			{"last_name": primitive.Regex{Pattern: "^jo", Options: "i"}},
+			{"email": primitive.Regex{Pattern: "^jo", Options: "i"}},
+		}}},
+		// unknown parameters, including ones trying to smuggle an operator in the name, are ignored
+		{"user_type[$ne]=ADMIN&password=x&$where=1", bson.M{}},
+	}
+	for _, tc := range cases {
+		query, err := parseTestQuery(t, tc.query)
+		if err != nil {
+			t.Errorf("%q: %v", tc.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(query.Filter, tc.want) {
+			t.Errorf("%q: filter %v, want %v", tc.query, query.Filter, tc.want)
+		}
+	}
+}
+
+func TestParseUserListQueryRejects(t *testing.T) {
+	for _, query := range []string{
+		"user_type=admin",
+		"user_type=%24ne",
+		"user_type=ADMIN%7CUSER",
+		"email_domain=a%7Cb.com",
+		"email_domain=example.com%24",
+		"email_domain=.%2A",
+		"created_from=yesterday",
+		"created_to=2024-13-01",
+		"email_verified=yes",
+		"phone_verified=%7B%22%24ne%22%3Atrue%7D",
+		"search=" + string(make([]byte, 101)),
+		"sort=password",
+		"sort=-mfa_secret",
+		"sort=_id",
+		"sort=%24natural",
+		"sort=created_at,,tenant_id",
+	} {
+		if q, err := parseTestQuery(t, query); err == nil {
+			t.Errorf("%q accepted: %+v", query, q)
+		}
+	}
+}
+
+func TestSearchIsLiteral(t *testing.T) {
+	for _, search := range []string{".*", "a|b", "(x+)+$", "$where", "jo\\"} {
+		query, err := parseTestQuery(t, url.Values{"search": {search}}.Encode())
+		if err != nil {
+			t.Fatalf("%q: %v", search, err)
+		}
+
+		pattern := query.Filter["$or"].([]bson.M)[0]["first_name"].(primitive.Regex).Pattern
+		re := regexp.MustCompile(pattern)
+		if !re.MatchString(search+"son") || re.MatchString("x"+search) || re.MatchString("jo") {
+			t.Errorf("search %q became the pattern %q, which is not a literal prefix", search, pattern)
+		}
+	}
+}
+
+func TestParseUserSort(t *testing.T) {
+	cases := map[string]bson.D{
+		"":                          {{Key: "_id", Value: 1}},
+		"email":                     {{Key: "email", Value: 1}, {Key: "_id", Value: 1}},
+		"-created_at":               {{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}},
+		" -created_at , last_name ": {{Key: "created_at", Value: -1}, {Key: "last_name", Value: 1}, {Key: "_id", Value: 1}},
+		"email,-email":              {{Key: "email", Value: 1}, {Key: "_id", Value: 1}},
+	}
+	for value, want := range cases {
+		got, err := parseUserSort(value)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("parseUserSort(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package helpers
+
+import (
+	"os"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/webauthn"
+)
+
+// bindings of webauthn login challenges
+const (
+	WebauthnPasswordless = "passwordless" // the passkey is the only factor, user verification (PIN, biometric) is required
+	WebauthnSecondFactor = "second_factor"
+)
+
+// WebauthnCeremonyTTL is how long the browser has to answer a challenge
+const WebauthnCeremonyTTL = 5 * time.Minute
+
+// RelyingParty describes this service to authenticators, WEBAUTHN_RP_ID must be the domain the frontend is served from
+func RelyingParty() webauthn.RelyingParty {
+	rp := webauthn.RelyingParty{
+		ID:     os.Getenv("WEBAUTHN_RP_ID"),
+		Name:   os.Getenv("WEBAUTHN_RP_NAME"),
+		Origin: os.Getenv("WEBAUTHN_RP_ORIGIN"),
+	}
+	if rp.ID == "" {
+		rp.ID = "localhost"
+	}
+	if rp.Name == "" {
+		rp.Name = "golang-jwt-project"
+	}
+	if rp.Origin == "" {
+		rp.Origin = "http://localhost:" + os.Getenv("PORT")
+	}
+	return rp
+}
@@ -0,0 +1,315 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"github.com/someshnayak29/golang-jwt-project/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// webhook event types
+const (
+	WebhookUserCreated       = "user.created" // data.source: signup, admin or invitation
+	WebhookUserEmailVerified = "user.email_verified"
+	WebhookUserLogin         = "user.login"
+	WebhookUserRolesChanged  = "user.roles_changed"
+	WebhookUserDisabled      = "user.disabled"
+	WebhookUserEnabled       = "user.enabled"
+	WebhookUserDeleted       = "user.deleted"
+)
+
+// WebhookEvents is what a webhook can subscribe to, besides "*"
+var WebhookEvents = []string{
+	WebhookUserCreated, WebhookUserEmailVerified, WebhookUserLogin, WebhookUserRolesChanged,
+	WebhookUserDisabled, WebhookUserEnabled, WebhookUserDeleted,
+}
+
+// delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead" // gave up after WEBHOOK_MAX_ATTEMPTS, can be redelivered by hand
+)
+
+var webhookCollection *mongo.Collection = database.OpenCollection(database.Client, "webhooks")
+var webhookDeliveryCollection *mongo.Collection = database.OpenCollection(database.Client, "webhook_deliveries")
+
+func init() {
+	database.EnsureIndexes(webhookCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "webhook_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "events", Value: 1}}},
+	)
+	// delivered events are kept for a month, dead ones until someone looks at them
+	database.EnsureIndexes(webhookDeliveryCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "delivery_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "delivered_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(30 * 24 * 60 * 60)},
+	)
+}
+
+// WebhookSender posts the deliveries, it can be replaced, e.g. to trust the certificate of an httptest.NewTLSServer
+var WebhookSender = webhook.NewSender(10*time.Second, WebhookAllowPrivate())
+
+// configuration, all optional:
+// WEBHOOK_MAX_ATTEMPTS attempts before a delivery is dead (8)
+// WEBHOOK_BACKOFF_SECONDS delay before the first retry, doubled after every failure up to 6 hours (30)
+// WEBHOOK_POLL_SECONDS how often the outbox is looked at (5)
+// WEBHOOK_WORKERS deliveries sent at the same time by each replica (8)
+// WEBHOOK_ALLOW_HTTP=true accepts http:// urls, e.g. for a receiver running locally
+// WEBHOOK_ALLOW_PRIVATE=true lets deliveries reach loopback and private addresses, refused by default
+func webhookMaxAttempts() int { return envInt("WEBHOOK_MAX_ATTEMPTS", 8) }
+func webhookBackoff() time.Duration {
+	return time.Duration(envInt("WEBHOOK_BACKOFF_SECONDS", 30)) * time.Second
+}
+func webhookPollInterval() time.Duration {
+	return time.Duration(envInt("WEBHOOK_POLL_SECONDS", 5)) * time.Second
+}
+func webhookWorkers() int       { return max(envInt("WEBHOOK_WORKERS", 8), 1) }
+func WebhookAllowHTTP() bool    { return os.Getenv("WEBHOOK_ALLOW_HTTP") == "true" }
+func WebhookAllowPrivate() bool { return os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true" }
+
+const maxWebhookBackoff = 6 * time.Hour
+
+// a claimed delivery is not picked up by another replica for this long, if the replica dies it is retried after it
+const webhookClaimLease = time.Minute
+
+// EmitWebhookEvent queues an event for every webhook of the organization subscribed to it, it returns once the
+// deliveries are stored. The action already happened, so like RecordAudit a failure is only logged.
+func EmitWebhookEvent(tenantId string, eventType string, data map[string]interface{}) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	tenantId = NormalizeTenant(tenantId)
+	cursor, err := webhookCollection.Find(ctx, bson.M{"tenant_id": tenantId, "events": bson.M{"$in": []string{eventType, "*"}}})
+	if err != nil {
+		log.Printf("could not find webhooks for %s: %v", eventType, err)
+		return
+	}
+	var webhooks []models.Webhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		log.Printf("could not find webhooks for %s: %v", eventType, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	eventId := primitive.NewObjectID().Hex()
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":         eventId,
+		"type":       eventType,
+		"tenant_id":  tenantId,
+		"created_at": now,
+		"data":       data,
+	})
+	if err != nil {
+		log.Printf("could not encode webhook event %s: %v", eventType, err)
+		return
+	}
+
+	deliveries := make([]interface{}, 0, len(webhooks))
+	for _, hook := range webhooks {
+		id := primitive.NewObjectID()
+		deliveries = append(deliveries, models.WebhookDelivery{
+			ID:              id,
+			Delivery_id:     id.Hex(),
+			Webhook_id:      hook.Webhook_id,
+			Tenant_id:       tenantId,
+			Event_id:        eventId,
+			Event_type:      eventType,
+			Payload:         string(payload),
+			Status:          DeliveryPending,
+			Next_attempt_at: now,
+			Created_at:      now,
+		})
+	}
+	if _, err := webhookDeliveryCollection.InsertMany(ctx, deliveries); err != nil {
+		log.Printf("could not queue webhook event %s: %v", eventType, err)
+		return
+	}
+	wakeWebhookDispatcher()
+}
+
+// DispatchWebhooks delivers every delivery that is due and returns how many were attempted.
+// Up to WEBHOOK_WORKERS deliveries are sent at the same time, so one slow receiver doesn't hold back the others.
+// The background dispatcher calls it regularly, tests can call it directly.
+func DispatchWebhooks(ctx context.Context) (int, error) {
+	claimed := make(chan models.WebhookDelivery)
+	var workers sync.WaitGroup
+	var mu sync.Mutex
+	var deliverErr error
+
+	for i := 0; i < webhookWorkers(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for delivery := range claimed {
+				if err := deliverWebhook(ctx, delivery); err != nil {
+					// the delivery stays claimed and is picked up again once the lease runs out
+					log.Printf("could not record webhook delivery %s: %v", delivery.Delivery_id, err)
+					mu.Lock()
+					if deliverErr == nil {
+						deliverErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	attempted, err := claimWebhookDeliveries(ctx, claimed)
+	close(claimed)
+	workers.Wait()
+
+	if err == nil {
+		err = deliverErr
+	}
+	return attempted, err
+}
+
+// claimWebhookDeliveries hands the due deliveries to the workers one by one, claiming the next one only when
+// a worker is free so the others are left to the other replicas
+func claimWebhookDeliveries(ctx context.Context, claimed chan<- models.WebhookDelivery) (int, error) {
+	attempted := 0
+	for {
+		now := time.Now().UTC()
+		after := options.After
+
+		// claiming moves next_attempt_at forward, so the same delivery is not sent twice by two replicas
+		var delivery models.WebhookDelivery
+		err := webhookDeliveryCollection.FindOneAndUpdate(ctx,
+			bson.M{"status": DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"next_attempt_at": now.Add(webhookClaimLease)}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetReturnDocument(after),
+		).Decode(&delivery)
+		if err == mongo.ErrNoDocuments {
+			return attempted, nil
+		}
+		if err != nil {
+			return attempted, err
+		}
+
+		select {
+		case claimed <- delivery:
+			attempted++
+		case <-ctx.Done():
+			return attempted, ctx.Err()
+		}
+	}
+}
+
+func deliverWebhook(ctx context.Context, delivery models.WebhookDelivery) error {
+	var hook models.Webhook
+	err := webhookCollection.FindOne(ctx, bson.M{"webhook_id": delivery.Webhook_id}).Decode(&hook)
+	if err == mongo.ErrNoDocuments {
+		_, err = webhookDeliveryCollection.UpdateOne(ctx, bson.M{"_id": delivery.ID},
+			bson.M{"$set": bson.M{"status": DeliveryDead, "last_error": "webhook was deleted"}})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	statusCode, sendErr := WebhookSender.Deliver(sendCtx, webhook.Request{
+		URL:        hook.Url,
+		Secret:     hook.Secret,
+		Event:      delivery.Event_type,
+		DeliveryID: delivery.Delivery_id,
+		Body:       []byte(delivery.Payload),
+	})
+	cancel()
+
+	update := deliveryAttemptUpdate(delivery, statusCode, sendErr, time.Now().UTC())
+	if update["status"] == DeliveryDead {
+		log.Printf("webhook delivery %s to %s is dead after %d attempts: %v", delivery.Delivery_id, hook.Url, update["attempts"], sendErr)
+	}
+
+	_, err = webhookDeliveryCollection.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": update})
+	return err
+}
+
+// deliveryAttemptUpdate is what an attempt changes in the delivery: delivered, dead after WEBHOOK_MAX_ATTEMPTS,
+// or pending again after the backoff
+func deliveryAttemptUpdate(delivery models.WebhookDelivery, statusCode int, sendErr error, now time.Time) bson.M {
+	attempts := delivery.Attempts + 1
+	update := bson.M{"attempts": attempts, "last_status_code": statusCode, "last_error": ""}
+
+	switch {
+	case sendErr == nil:
+		update["status"] = DeliveryDelivered
+		update["delivered_at"] = now
+	case attempts >= webhookMaxAttempts():
+		update["status"] = DeliveryDead
+		update["last_error"] = sendErr.Error()
+	default:
+		update["last_error"] = sendErr.Error()
+		update["next_attempt_at"] = now.Add(webhook.Backoff(attempts, webhookBackoff(), maxWebhookBackoff))
+	}
+	return update
+}
+
+// RedeliverWebhook puts a delivery back in the outbox with a fresh number of attempts, whatever its status
+func RedeliverWebhook(ctx context.Context, webhookId string, deliveryId string) (bool, error) {
+	result, err := webhookDeliveryCollection.UpdateOne(ctx,
+		bson.M{"webhook_id": webhookId, "delivery_id": deliveryId},
+		bson.M{
+			"$set":   bson.M{"status": DeliveryPending, "attempts": 0, "next_attempt_at": time.Now().UTC(), "last_error": ""},
+			"$unset": bson.M{"delivered_at": ""},
+		})
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount > 0 {
+		wakeWebhookDispatcher()
+	}
+	return result.MatchedCount > 0, nil
+}
+
+var (
+	webhookWake          = make(chan struct{}, 1)
+	webhookDispatcherRun sync.Once
+)
+
+// wakeWebhookDispatcher lets new events go out right away instead of at the next poll
+func wakeWebhookDispatcher() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartWebhookDispatcher delivers the outbox in the background, every replica can run one
+func StartWebhookDispatcher() {
+	webhookDispatcherRun.Do(func() {
+		go func() {
+			ticker := time.NewTicker(webhookPollInterval())
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+				case <-webhookWake:
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+				if _, err := DispatchWebhooks(ctx); err != nil {
+					log.Println("webhook dispatch failed:", err)
+				}
+				cancel()
+			}
+		}()
+	})
+}
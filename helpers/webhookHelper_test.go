@@ -0,0 +1,153 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/models"
+	"github.com/someshnayak29/golang-jwt-project/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDeliveryAttemptUpdate(t *testing.T) {
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+	t.Setenv("WEBHOOK_BACKOFF_SECONDS", "10")
+	now := time.Now().UTC()
+	failed := errors.New("receiver answered 500")
+
+	update := deliveryAttemptUpdate(models.WebhookDelivery{}, http.StatusOK, nil, now)
+	if update["status"] != DeliveryDelivered || update["delivered_at"] != now || update["attempts"] != 1 {
+		t.Fatalf("success: %v", update)
+	}
+
+	update = deliveryAttemptUpdate(models.WebhookDelivery{Attempts: 1}, http.StatusInternalServerError, failed, now)
+	if _, ok := update["status"]; ok || update["next_attempt_at"] != now.Add(20*time.Second) || update["attempts"] != 2 {
+		t.Fatalf("second failure should stay pending and back off 20s: %v", update)
+	}
+
+	update = deliveryAttemptUpdate(models.WebhookDelivery{Attempts: 2}, http.StatusInternalServerError, failed, now)
+	if update["status"] != DeliveryDead || update["last_error"] != failed.Error() || update["attempts"] != 3 {
+		t.Fatalf("failure number WEBHOOK_MAX_ATTEMPTS should be dead: %v", update)
+	}
+	if _, ok := update["next_attempt_at"]; ok {
+		t.Fatalf("a dead delivery is not scheduled again: %v", update)
+	}
+}
+
+// requireMongo skips a test when no mongo answers at MONGODB_URL
+func requireMongo(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := database.Client.Ping(ctx, nil); err != nil {
+		t.Skip("mongo is not reachable, set MONGODB_URL to run this test:", err)
+	}
+}
+
+// testDelivery reads the only delivery of the test organization
+func testDelivery(t *testing.T, ctx context.Context, tenantId string) models.WebhookDelivery {
+	t.Helper()
+	var delivery models.WebhookDelivery
+	if err := webhookDeliveryCollection.FindOne(ctx, bson.M{"tenant_id": tenantId}).Decode(&delivery); err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+func TestWebhookOutbox(t *testing.T) {
+	requireMongo(t)
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "2")
+
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	var received atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify("whsec_test", r.Header.Get(webhook.HeaderSignature), body, time.Minute, time.Now()); err != nil {
+			t.Errorf("receiver could not verify the delivery: %v", err)
+		}
+		received.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	sender := WebhookSender
+	WebhookSender = &webhook.Sender{Client: srv.Client()}
+	defer func() { WebhookSender = sender }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tenantId := "webhook-test-" + primitive.NewObjectID().Hex()
+	hookId := primitive.NewObjectID()
+	if _, err := webhookCollection.InsertOne(ctx, models.Webhook{
+		ID: hookId, Webhook_id: hookId.Hex(), Tenant_id: tenantId, Url: srv.URL,
+		Events: []string{WebhookUserDisabled}, Secret: "whsec_test", Created_at: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer webhookCollection.DeleteOne(context.Background(), bson.M{"_id": hookId})
+	defer webhookDeliveryCollection.DeleteMany(context.Background(), bson.M{"tenant_id": tenantId})
+
+	// only subscribed events are queued
+	EmitWebhookEvent(tenantId, WebhookUserEnabled, map[string]interface{}{"user_id": "user-1"})
+	EmitWebhookEvent(tenantId, WebhookUserDisabled, map[string]interface{}{"user_id": "user-1"})
+	if count, err := webhookDeliveryCollection.CountDocuments(ctx, bson.M{"tenant_id": tenantId}); err != nil || count != 1 {
+		t.Fatalf("got %d deliveries (%v), want 1", count, err)
+	}
+
+	if _, err := DispatchWebhooks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	delivery := testDelivery(t, ctx, tenantId)
+	if delivery.Status != DeliveryPending || delivery.Attempts != 1 || delivery.Last_status_code != http.StatusInternalServerError ||
+		!delivery.Next_attempt_at.After(time.Now()) {
+		t.Fatalf("a failed attempt should be retried later: %+v", delivery)
+	}
+
+	// the retry is due right away, it is the last attempt allowed
+	if _, err := webhookDeliveryCollection.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": bson.M{"next_attempt_at": time.Now().UTC()}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DispatchWebhooks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if delivery = testDelivery(t, ctx, tenantId); delivery.Status != DeliveryDead || delivery.Attempts != 2 {
+		t.Fatalf("delivery should be dead after WEBHOOK_MAX_ATTEMPTS: %+v", delivery)
+	}
+
+	// a dead delivery is not sent again until it is redelivered
+	if _, err := DispatchWebhooks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if received.Load() != 2 {
+		t.Fatalf("receiver got %d attempts, want 2", received.Load())
+	}
+
+	status.Store(http.StatusOK)
+	if found, err := RedeliverWebhook(ctx, hookId.Hex(), delivery.Delivery_id); err != nil || !found {
+		t.Fatalf("redeliver: %v, %v", found, err)
+	}
+	if found, err := RedeliverWebhook(ctx, primitive.NewObjectID().Hex(), delivery.Delivery_id); err != nil || found {
+		t.Fatalf("a delivery was redelivered through another webhook: %v, %v", found, err)
+	}
+	if _, err := DispatchWebhooks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	redelivered := testDelivery(t, ctx, tenantId)
+	if redelivered.Status != DeliveryDelivered || redelivered.Attempts != 1 || redelivered.Delivered_at == nil ||
+		redelivered.Delivery_id != delivery.Delivery_id || redelivered.Payload != delivery.Payload {
+		t.Fatalf("redelivery should send the same delivery again: %+v", redelivered)
+	}
+	if received.Load() != 3 {
+		t.Fatalf("receiver got %d attempts, want 3", received.Load())
+	}
+}
@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every message as an .eml file in Dir, which can be opened with any mail client
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return err
+	}
+	body, err := msg.Bytes(m.From)
+	if err != nil {
+		return err
+	}
+
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + id + ".eml"
+	return os.WriteFile(filepath.Join(m.Dir, name), body, 0o644)
+}
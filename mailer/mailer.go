@@ -0,0 +1,140 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message is a single outgoing email, HTML is optional and sent as an alternative to Text
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer is implemented by every way we know of delivering email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer only prints the message, useful while developing locally
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
+
+// Default is the mailer used by Send. When left nil it is built from the environment on first use
+// (after .env has been loaded), wrapped in an outbox so handlers never wait for the mail server.
+// Tests can set it to a &MemoryMailer{} before sending anything.
+var Default Mailer
+
+var defaultOnce sync.Once
+
+func Send(ctx context.Context, msg Message) error {
+	defaultOnce.Do(func() {
+		if Default == nil {
+			outbox := NewOutbox(FromEnv(), 256)
+			outbox.SpoolDir = os.Getenv("MAIL_SPOOL_DIR")
+			Default = outbox.Start()
+		}
+	})
+	return Default.Send(ctx, msg)
+}
+
+// FromEnv picks the mail driver using MAIL_DRIVER (smtp, file, memory or log)
+func FromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	case "file":
+		dir := os.Getenv("MAIL_DROP_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return &FileMailer{Dir: dir, From: from}
+	case "memory":
+		return &MemoryMailer{}
+	default:
+		return LogMailer{}
+	}
+}
+
+// Bytes renders the message as an RFC 5322 document, used both on the wire (SMTP) and for .eml files
+func (m Message) Bytes(from string) ([]byte, error) {
+	messageId, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", messageId, "golang-jwt-project")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.HTML == "" {
+		writePart(&buf, "text/plain", m.Text)
+		return buf.Bytes(), nil
+	}
+
+	// multipart/alternative => mail clients show the last part they are able to render
+	boundary, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	writePart(&buf, "text/plain", m.Text)
+	fmt.Fprintf(&buf, "\r\n--%s\r\n", boundary)
+	writePart(&buf, "text/html", m.HTML)
+	fmt.Fprintf(&buf, "\r\n--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+func writePart(buf *bytes.Buffer, contentType string, body string) {
+	fmt.Fprintf(buf, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	w := quotedprintable.NewWriter(buf)
+	w.Write([]byte(body))
+	w.Close()
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,242 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrOutboxFull = errors.New("mail outbox is full")
+
+// Outbox queues messages and delivers them in the background with retries,
+// so a slow or unavailable mail server never blocks a request handler.
+// A failing message waits for its own next attempt, the messages queued behind it are still sent.
+type Outbox struct {
+	mailer      Mailer
+	size        int
+	MaxAttempts int
+	Backoff     time.Duration // delay before the first retry, doubled after every failure
+	SpoolDir    string        // when set, queued messages are kept there as files and sent again after a restart
+
+	mu      sync.Mutex
+	pending []*outboxEntry
+	wake    chan struct{}
+}
+
+// outboxEntry is a queued message, also the content of its spool file
+type outboxEntry struct {
+	ID           string    `json:"id"`
+	Message      Message   `json:"message"`
+	Attempts     int       `json:"attempts"`
+	Next_attempt time.Time `json:"next_attempt"`
+}
+
+func NewOutbox(m Mailer, size int) *Outbox {
+	return &Outbox{
+		mailer:      m,
+		size:        size,
+		MaxAttempts: 5,
+		Backoff:     2 * time.Second,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Start loads the messages left in SpoolDir, launches the delivery worker and returns the outbox for convenience
+func (o *Outbox) Start() *Outbox {
+	if o.SpoolDir != "" {
+		o.loadSpool()
+	}
+	go o.run()
+	return o
+}
+
+// Send only queues the message, delivery errors are logged by the worker
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	id, err := randomID()
+	if err != nil {
+		return err
+	}
+	entry := &outboxEntry{ID: id, Message: msg, Next_attempt: time.Now()}
+
+	o.mu.Lock()
+	if len(o.pending) >= o.size {
+		o.mu.Unlock()
+		return ErrOutboxFull
+	}
+	if err := o.spool(entry); err != nil {
+		o.mu.Unlock()
+		return err
+	}
+	o.pending = append(o.pending, entry)
+	o.mu.Unlock()
+
+	o.notify()
+	return nil
+}
+
+// Mailer returns the underlying mailer, e.g. to read a MemoryMailer in tests
+func (o *Outbox) Mailer() Mailer {
+	return o.mailer
+}
+
+// Pending is the number of messages not delivered yet
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.pending)
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) run() {
+	for {
+		wait := o.deliverDue()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-o.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// deliverDue makes one attempt for every message that is due and returns how long until the next one is
+func (o *Outbox) deliverDue() time.Duration {
+	now := time.Now()
+
+	o.mu.Lock()
+	var due []*outboxEntry
+	for _, entry := range o.pending {
+		if !entry.Next_attempt.After(now) {
+			due = append(due, entry)
+		}
+	}
+	o.mu.Unlock()
+
+	for _, entry := range due {
+		o.deliver(entry)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	wait := time.Hour
+	for _, entry := range o.pending {
+		if until := time.Until(entry.Next_attempt); until < wait {
+			wait = until
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+func (o *Outbox) deliver(entry *outboxEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err := o.mailer.Send(ctx, entry.Message)
+	cancel()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry.Attempts++
+	if err == nil {
+		o.remove(entry)
+		return
+	}
+	if entry.Attempts >= o.MaxAttempts {
+		log.Printf("giving up on mail to %s after %d attempts: %v", entry.Message.To, entry.Attempts, err)
+		o.remove(entry)
+		return
+	}
+
+	delay := o.Backoff << (entry.Attempts - 1)
+	entry.Next_attempt = time.Now().Add(delay)
+	log.Printf("mail to %s failed (attempt %d), retrying in %s: %v", entry.Message.To, entry.Attempts, delay, err)
+	if err := o.spool(entry); err != nil {
+		log.Println("could not update the mail spool:", err)
+	}
+}
+
+// remove drops a delivered or abandoned message, o.mu is held
+func (o *Outbox) remove(entry *outboxEntry) {
+	for i, pending := range o.pending {
+		if pending == entry {
+			o.pending = append(o.pending[:i], o.pending[i+1:]...)
+			break
+		}
+	}
+	if o.SpoolDir != "" {
+		if err := os.Remove(o.spoolPath(entry.ID)); err != nil && !os.IsNotExist(err) {
+			log.Println("could not remove a spooled mail:", err)
+		}
+	}
+}
+
+func (o *Outbox) spoolPath(id string) string {
+	return filepath.Join(o.SpoolDir, id+".json")
+}
+
+// spool writes the entry to SpoolDir, through a temporary file so a crash never leaves half a message
+func (o *Outbox) spool(entry *outboxEntry) error {
+	if o.SpoolDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(o.SpoolDir, 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp := o.spoolPath(entry.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.spoolPath(entry.ID))
+}
+
+func (o *Outbox) loadSpool() {
+	files, err := os.ReadDir(o.SpoolDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("could not read the mail spool:", err)
+		}
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(o.SpoolDir, file.Name()))
+		if err != nil {
+			log.Println("could not read a spooled mail:", err)
+			continue
+		}
+		var entry outboxEntry
+		if err := json.Unmarshal(data, &entry); err != nil || entry.ID == "" {
+			log.Println("skipping an unreadable spooled mail:", file.Name())
+			continue
+		}
+		o.pending = append(o.pending, &entry)
+	}
+}
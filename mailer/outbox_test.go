@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyMailer fails for the recipients in failing, and records what it delivered
+type flakyMailer struct {
+	MemoryMailer
+	mu       sync.Mutex
+	failing  map[string]bool
+	attempts map[string]int
+}
+
+func (m *flakyMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	m.attempts[msg.To]++
+	fail := m.failing[msg.To]
+	m.mu.Unlock()
+
+	if fail {
+		return errors.New("mail server unavailable")
+	}
+	return m.MemoryMailer.Send(ctx, msg)
+}
+
+func (m *flakyMailer) attemptsFor(to string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.attempts[to]
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOutboxFailingMessageDoesNotBlockOthers(t *testing.T) {
+	m := &flakyMailer{failing: map[string]bool{"down@example.com": true}, attempts: map[string]int{}}
+	outbox := NewOutbox(m, 10)
+	outbox.Backoff = time.Hour // the failing message is not retried during the test
+	outbox.Start()
+
+	outbox.Send(context.Background(), Message{To: "down@example.com"})
+	outbox.Send(context.Background(), Message{To: "up@example.com"})
+
+	waitFor(t, "the second message", func() bool { return len(m.Messages()) == 1 })
+	if got := m.Messages()[0].To; got != "up@example.com" {
+		t.Fatalf("delivered %s", got)
+	}
+	if outbox.Pending() != 1 {
+		t.Fatalf("pending = %d, want the failing message only", outbox.Pending())
+	}
+}
+
+func TestOutboxRetriesThenGivesUp(t *testing.T) {
+	m := &flakyMailer{failing: map[string]bool{"down@example.com": true}, attempts: map[string]int{}}
+	outbox := NewOutbox(m, 10)
+	outbox.Backoff = time.Millisecond
+	outbox.MaxAttempts = 3
+	outbox.Start()
+
+	outbox.Send(context.Background(), Message{To: "down@example.com"})
+
+	waitFor(t, "the outbox to give up", func() bool { return outbox.Pending() == 0 })
+	if got := m.attemptsFor("down@example.com"); got != 3 {
+		t.Fatalf("attempts = %d, want 3", got)
+	}
+}
+
+func TestOutboxFull(t *testing.T) {
+	outbox := NewOutbox(&MemoryMailer{}, 1) // not started, nothing leaves the queue
+	if err := outbox.Send(context.Background(), Message{To: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Send(context.Background(), Message{To: "b@example.com"}); err != ErrOutboxFull {
+		t.Fatalf("err = %v, want ErrOutboxFull", err)
+	}
+}
+
+func TestOutboxSpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// queued but never delivered, as if the process stopped
+	first := NewOutbox(&MemoryMailer{}, 10)
+	first.SpoolDir = dir
+	if err := first.Send(context.Background(), Message{To: "jane@example.com", Subject: "Verify"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &MemoryMailer{}
+	second := NewOutbox(m, 10)
+	second.SpoolDir = dir
+	second.Start()
+
+	waitFor(t, "the spooled message", func() bool { return len(m.Messages()) == 1 })
+	if got := m.Messages()[0]; got.To != "jane@example.com" || got.Subject != "Verify" {
+		t.Fatalf("delivered %+v", got)
+	}
+	waitFor(t, "the spool file to be removed", func() bool {
+		files, _ := os.ReadDir(dir)
+		return second.Pending() == 0 && len(files) == 0
+	})
+}
@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+)
+
+// SMTPMailer delivers through any SMTP relay. Auth is skipped when Username is empty,
+// which is what local fake SMTP servers (MailHog, smtp4dev ...) expect.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if m.Host == "" {
+		return errors.New("SMTP_HOST is not configured")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	body, err := msg.Bytes(m.From)
+	if err != nil {
+		return err
+	}
+
+	// SendMail upgrades to TLS using STARTTLS whenever the server supports it
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{msg.To}, body)
+}
@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts one message without authentication or STARTTLS, like MailHog does, and hands it to received
+func fakeSMTP(t *testing.T, received chan<- string) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 fake ESMTP")
+
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 queued")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestSMTPMailerSendsToServer(t *testing.T) {
+	received := make(chan string, 1)
+	host, port, _ := net.SplitHostPort(fakeSMTP(t, received))
+
+	m := &SMTPMailer{Host: host, Port: port, From: "no-reply@example.com"}
+	err := m.Send(context.Background(), Message{To: "jane@example.com", Subject: "Hello", Text: "plain body", HTML: "<p>html body</p>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := <-received
+	for _, want := range []string{"To: jane@example.com", "Subject: Hello", "plain body", "<p>html body</p>", "multipart/alternative"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("message does not contain %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestSMTPMailerWithoutHost(t *testing.T) {
+	if err := (&SMTPMailer{}).Send(context.Background(), Message{To: "jane@example.com"}); err == nil {
+		t.Fatal("expected an error without SMTP_HOST")
+	}
+}
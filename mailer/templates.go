@@ -0,0 +1,80 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Every template lives in templates/<name>.<locale>.tmpl and defines three blocks:
+// "subject", "text" and "html". The text blocks are rendered with text/template and the
+// html block with html/template, so values are escaped properly in the HTML part.
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+const DefaultLocale = "en"
+
+// Render builds a message from a template, falling back to DefaultLocale when the locale is not translated
+func Render(name string, locale string, to string, data any) (Message, error) {
+	file, err := templateFile(name, locale)
+	if err != nil {
+		return Message{}, err
+	}
+
+	textTmpl, err := texttemplate.ParseFS(templateFS, file)
+	if err != nil {
+		return Message{}, err
+	}
+	htmlTmpl, err := htmltemplate.ParseFS(templateFS, file)
+	if err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{To: to}
+	var buf bytes.Buffer
+
+	if err := textTmpl.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return Message{}, err
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err := textTmpl.ExecuteTemplate(&buf, "text", data); err != nil {
+		return Message{}, err
+	}
+	msg.Text = strings.TrimSpace(buf.String()) + "\n"
+
+	buf.Reset()
+	if err := htmlTmpl.ExecuteTemplate(&buf, "html", data); err != nil {
+		return Message{}, err
+	}
+	msg.HTML = strings.TrimSpace(buf.String())
+
+	return msg, nil
+}
+
+func templateFile(name string, locale string) (string, error) {
+	file := "templates/" + name + "." + locale + ".tmpl"
+	if _, err := templateFS.Open(file); err == nil {
+		return file, nil
+	}
+
+	file = "templates/" + name + "." + DefaultLocale + ".tmpl"
+	_, err := templateFS.Open(file)
+	return file, err
+}
+
+// LocaleFromHeader returns the primary language of an Accept-Language header, e.g. "es-ES,es;q=0.9" => "es"
+func LocaleFromHeader(header string) string {
+	lang := strings.TrimSpace(strings.Split(header, ",")[0])
+	lang = strings.Split(lang, ";")[0]
+	lang = strings.ToLower(strings.Split(lang, "-")[0])
+
+	if lang == "" || lang == "*" {
+		return DefaultLocale
+	}
+	return lang
+}
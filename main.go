@@ -3,9 +3,13 @@ package main
 import (
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"github.com/someshnayak29/golang-jwt-project/middleware"
 	routes "github.com/someshnayak29/golang-jwt-project/routes"
 )
 
@@ -24,8 +28,26 @@ func main() {
 		port = "8000"
 	}
 
+	// kill -HUP <pid> reloads the ABAC policy files without a restart
+	helper.PolicyEngine()
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := helper.PolicyEngine().Reload(); err != nil {
+				log.Println("abac policies not reloaded:", err)
+			} else {
+				log.Println("abac policies reloaded")
+			}
+		}
+	}()
+
+	// events waiting in the webhook outbox are sent in the background, see helpers.DispatchWebhooks
+	helper.StartWebhookDispatcher()
+
 	router := gin.New()
 	router.Use(gin.Logger())
+	router.Use(middleware.RequestID())
 
 	routes.AuthRoutes(router) // additional routes and depicts modularity in comparison to GET routes defind below
 	routes.UserRoutes(router)
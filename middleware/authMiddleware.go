@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	helper "github.com/someshnayak29/golang-jwt-project/helpers"
@@ -26,6 +28,49 @@ func Authenticate() gin.HandlerFunc {
 			return
 		}
 
+		// refresh tokens and MFA challenges are signed with the same key, but they are not access tokens
+		if claims.Scope != helper.ScopeFull && claims.Scope != helper.ScopeUnverified {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token can not be used to access this resource"})
+			c.Abort()
+			return
+		}
+
+		// the account may have been disabled or logged out by an admin since the token was issued
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		state, stateErr := helper.LoadAccountState(ctx, claims.Uid)
+		if stateErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the account"})
+			c.Abort()
+			return
+		}
+		if !state.Found || state.Token_version != claims.Token_version {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked, kindly login again", "code": "token_revoked"})
+			c.Abort()
+			return
+		}
+		if state.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled", "code": "account_disabled"})
+			c.Abort()
+			return
+		}
+
+		// the session may have been revoked from another device, tokens issued before sessions existed have none
+		if claims.Session_id != "" {
+			active, sessionErr := helper.SessionActive(ctx, claims.Session_id)
+			if sessionErr != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the session"})
+				c.Abort()
+				return
+			}
+			if !active {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "session has been revoked, kindly login again", "code": "session_revoked"})
+				c.Abort()
+				return
+			}
+		}
+
 		// Now we will set logged users details in context
 
 		c.Set("email", claims.Email)
@@ -33,6 +78,17 @@ func Authenticate() gin.HandlerFunc {
 		c.Set("last_name", claims.Last_name)
 		c.Set("uid", claims.Uid)
 		c.Set("user_type", claims.User_type)
+
+		// tokens issued before roles existed only carry user_type
+		roles := claims.Roles
+		if len(roles) == 0 && claims.User_type != "" {
+			roles = []string{claims.User_type}
+		}
+		c.Set("roles", roles)
+		c.Set("region", claims.Region)
+		c.Set("tenant_id", helper.NormalizeTenant(claims.Tenant_id)) // tokens issued before tenants existed belong to the default tenant
+		c.Set("scope", claims.Scope)
+		c.Set("sid", claims.Session_id)
 		c.Next() // Next used only inside middleware. It executes the pending handlers in the chain inside the calling handler.
 	}
 }
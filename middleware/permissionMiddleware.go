@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission must run after Authenticate, every listed permission has to be granted by one of the user's roles.
+// It is a shortcut for Authorize("perm:a and perm:b ...").
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	terms := make([]string, len(permissions))
+	for i, permission := range permissions {
+		terms[i] = "perm:" + permission
+	}
+	return Authorize(strings.Join(terms, " and "))
+}
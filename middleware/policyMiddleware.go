@@ -0,0 +1,303 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/abac"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Route policies are small boolean expressions declared next to the route, e.g.
+//
+//	self or role:ADMIN
+//	perm:users:read and not role:SUSPENDED
+//
+// terms:
+//	self            the :user_id of the url is the logged in user (self:<param> for another url param)
+//	role:<NAME>     the user holds the role
+//	perm:<name>     one of the user's roles or groups grants the permission
+//	abac:<action>   the ABAC rules (see package abac) allow the action, the resource is the user of :user_id
+//	denied:<action> an ABAC deny rule matches the action, for "perm:x and not denied:x" where RBAC grants
+//	                and ABAC can only take away, e.g. read-only outside business hours
+//	authenticated   any valid token, including restricted (unverified email) ones
+// operators, loosest first: or, and, not, and parentheses.
+// Restricted tokens can only satisfy self and authenticated.
+
+type policyNode interface {
+	eval(r *policyRequest) (bool, error)
+}
+
+type orNode struct{ left, right policyNode }
+type andNode struct{ left, right policyNode }
+type notNode struct{ node policyNode }
+type selfNode struct{ param string }
+type roleNode struct{ role string }
+type permNode struct{ permission string }
+type abacNode struct{ action string }
+type deniedNode struct{ action string }
+type authenticatedNode struct{}
+
+// policyRequest evaluates one request, the permissions are only resolved if a perm: term needs them
+type policyRequest struct {
+	c           *gin.Context
+	permissions []string
+	resolved    bool
+	resource    abac.Attributes
+	denials     []string // reasons given by the ABAC engine, returned with the 403
+}
+
+func (r *policyRequest) full() bool {
+	return r.c.GetString("scope") == helper.ScopeFull
+}
+
+func (n orNode) eval(r *policyRequest) (bool, error) {
+	if ok, err := n.left.eval(r); ok || err != nil {
+		return ok, err
+	}
+	return n.right.eval(r)
+}
+
+func (n andNode) eval(r *policyRequest) (bool, error) {
+	if ok, err := n.left.eval(r); !ok || err != nil {
+		return false, err
+	}
+	return n.right.eval(r)
+}
+
+func (n notNode) eval(r *policyRequest) (bool, error) {
+	ok, err := n.node.eval(r)
+	return !ok && err == nil, err
+}
+
+func (n selfNode) eval(r *policyRequest) (bool, error) {
+	uid := r.c.GetString("uid")
+	return uid != "" && r.c.Param(n.param) == uid, nil
+}
+
+func (n roleNode) eval(r *policyRequest) (bool, error) {
+	return r.full() && helper.CheckUserType(r.c, n.role) == nil, nil
+}
+
+func (n permNode) eval(r *policyRequest) (bool, error) {
+	if !r.full() {
+		return false, nil
+	}
+
+	if !r.resolved {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		permissions, err := helper.EffectivePermissions(ctx, r.c.GetString("uid"), r.c.GetString("tenant_id"), r.c.GetStringSlice("roles"))
+		if err != nil {
+			return false, err
+		}
+		r.permissions = permissions
+		r.resolved = true
+	}
+	return helper.PermissionGranted(r.permissions, n.permission), nil
+}
+
+// evaluateABAC asks the ABAC engine about the action, the resource is loaded once per request
+func (r *policyRequest) evaluateABAC(action string) (abac.Decision, error) {
+	if r.resource == nil {
+		r.resource = abac.Attributes{}
+		if userId := r.c.Param("user_id"); userId != "" {
+			var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+			defer cancel()
+
+			resource, err := helper.LoadResourceAttributes(ctx, helper.ScopedUserFilter(r.c, bson.M{"user_id": userId}))
+			if err != nil {
+				return abac.Decision{}, err
+			}
+			r.resource = resource
+		}
+	}
+
+	return helper.PolicyEngine().Evaluate(abac.Request{
+		Action:   action,
+		Subject:  helper.SubjectAttributes(r.c),
+		Resource: r.resource,
+		Env:      helper.EnvironmentAttributes(r.c, time.Now()),
+	}), nil
+}
+
+func (n abacNode) eval(r *policyRequest) (bool, error) {
+	if !r.full() {
+		return false, nil
+	}
+
+	decision, err := r.evaluateABAC(n.action)
+	if err != nil {
+		return false, err
+	}
+	if !decision.Allowed {
+		r.denials = append(r.denials, decision.Reason)
+	}
+	return decision.Allowed, nil
+}
+
+func (n deniedNode) eval(r *policyRequest) (bool, error) {
+	decision, err := r.evaluateABAC(n.action)
+	if err != nil {
+		return false, err
+	}
+	if decision.Denied {
+		r.denials = append(r.denials, decision.Reason)
+	}
+	return decision.Denied, nil
+}
+
+func (authenticatedNode) eval(r *policyRequest) (bool, error) {
+	return r.c.GetString("uid") != "", nil
+}
+
+// policyParser is a recursive descent parser over whitespace and parenthesis separated tokens
+type policyParser struct {
+	tokens []string
+	pos    int
+}
+
+func tokenizePolicy(policy string) []string {
+	policy = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(policy)
+	return strings.Fields(policy)
+}
+
+func (p *policyParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *policyParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *policyParser) parseOr() (policyNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *policyParser) parseAnd() (policyNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *policyParser) parseNot() (policyNode, error) {
+	if strings.EqualFold(p.peek(), "not") {
+		p.next()
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	}
+	return p.parseTerm()
+}
+
+func (p *policyParser) parseTerm() (policyNode, error) {
+	token := p.next()
+
+	switch {
+	case token == "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return node, nil
+	case token == "self":
+		return selfNode{param: "user_id"}, nil
+	case strings.HasPrefix(token, "self:") && len(token) > len("self:"):
+		return selfNode{param: strings.TrimPrefix(token, "self:")}, nil
+	case strings.HasPrefix(token, "role:") && len(token) > len("role:"):
+		return roleNode{role: strings.TrimPrefix(token, "role:")}, nil
+	case strings.HasPrefix(token, "perm:") && len(token) > len("perm:"):
+		return permNode{permission: strings.TrimPrefix(token, "perm:")}, nil
+	case strings.HasPrefix(token, "abac:") && len(token) > len("abac:"):
+		return abacNode{action: strings.TrimPrefix(token, "abac:")}, nil
+	case strings.HasPrefix(token, "denied:") && len(token) > len("denied:"):
+		return deniedNode{action: strings.TrimPrefix(token, "denied:")}, nil
+	case token == "authenticated":
+		return authenticatedNode{}, nil
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of policy")
+	}
+	return nil, fmt.Errorf("unknown term %q", token)
+}
+
+// ParsePolicy compiles a route policy, see the grammar above
+func ParsePolicy(policy string) (policyNode, error) {
+	parser := &policyParser{tokens: tokenizePolicy(policy)}
+
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("policy %q: %w", policy, err)
+	}
+	if parser.pos != len(parser.tokens) {
+		return nil, fmt.Errorf("policy %q: unexpected %q", policy, parser.peek())
+	}
+	return node, nil
+}
+
+// Authorize must run after Authenticate. The policy is compiled when the route is registered,
+// so a typo stops the server at startup instead of locking everyone out (or in) at runtime.
+func Authorize(policy string) gin.HandlerFunc {
+	node, err := ParsePolicy(policy)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(c *gin.Context) {
+
+		request := &policyRequest{c: c}
+		allowed, err := node.eval(request)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking permissions"})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			response := gin.H{"error": "unauthorized to access this resource", "policy": policy}
+			if len(request.denials) > 0 {
+				response["reasons"] = request.denials
+			}
+			c.JSON(http.StatusForbidden, response)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/abac"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+)
+
+func TestParsePolicy(t *testing.T) {
+	cases := map[string]policyNode{
+		"self":               selfNode{param: "user_id"},
+		"self:group_id":      selfNode{param: "group_id"},
+		"role:ADMIN":         roleNode{role: "ADMIN"},
+		"perm:users:*":       permNode{permission: "users:*"},
+		"abac:users:read":    abacNode{action: "users:read"},
+		"denied:users:write": deniedNode{action: "users:write"},
+		"authenticated":      authenticatedNode{},
+
+		// and binds tighter than or, not tighter than and
+		"self or perm:users:write and not denied:users:write": orNode{
+			selfNode{"user_id"},
+			andNode{permNode{"users:write"}, notNode{deniedNode{"users:write"}}},
+		},
+		"role:A and role:B or role:C":     orNode{andNode{roleNode{"A"}, roleNode{"B"}}, roleNode{"C"}},
+		"role:A or role:B or role:C":      orNode{orNode{roleNode{"A"}, roleNode{"B"}}, roleNode{"C"}},
+		"role:A and role:B and role:C":    andNode{andNode{roleNode{"A"}, roleNode{"B"}}, roleNode{"C"}},
+		"not role:A or role:B":            orNode{notNode{roleNode{"A"}}, roleNode{"B"}},
+		"not not role:A":                  notNode{notNode{roleNode{"A"}}},
+		"(self or role:A) and role:B":     andNode{orNode{selfNode{"user_id"}, roleNode{"A"}}, roleNode{"B"}},
+		"role:A and (role:B or role:C)":   andNode{roleNode{"A"}, orNode{roleNode{"B"}, roleNode{"C"}}},
+		"not(role:A)":                     notNode{roleNode{"A"}},
+		"((role:A))":                      roleNode{"A"},
+		"role:A OR role:B AND NOT role:C": orNode{roleNode{"A"}, andNode{roleNode{"B"}, notNode{roleNode{"C"}}}},
+	}
+	for policy, want := range cases {
+		got, err := ParsePolicy(policy)
+		if err != nil {
+			t.Errorf("%q: %v", policy, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q parsed as %#v, want %#v", policy, got, want)
+		}
+	}
+}
+
+var malformedPolicies = []string{
+	"",
+	"   ",
+	"admin",
+	"role:",
+	"perm:",
+	"self:",
+	"abac:",
+	"denied:",
+	"role:A and",
+	"or role:A",
+	"role:A or or role:B",
+	"role:A role:B",
+	"not",
+	"(role:A",
+	"role:A)",
+	"()",
+	"role:A && role:B",
+	"Self",
+}
+
+func TestParsePolicyRejects(t *testing.T) {
+	for _, policy := range malformedPolicies {
+		if node, err := ParsePolicy(policy); err == nil {
+			t.Errorf("%q parsed as %#v", policy, node)
+		}
+	}
+}
+
+func TestAuthorizePanicsOnMalformedPolicies(t *testing.T) {
+	for _, policy := range malformedPolicies {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Authorize(%q) did not panic", policy)
+				}
+			}()
+			Authorize(policy)
+		}()
+	}
+}
+
+// useTestPolicies points the ABAC engine to rules written for the test
+func useTestPolicies(t *testing.T, src string) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "test.policy"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	engine := helper.PolicyEngine()
+	previous := engine.Dir
+	engine.Dir = dir
+	if err := engine.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		engine.Dir = previous
+		engine.Reload()
+	})
+}
+
+type testCaller struct {
+	uid         string
+	scope       string
+	roles       []string
+	permissions []string
+	region      string
+	param       string // :user_id of the url
+}
+
+// newPolicyRequest builds the request of a caller, permissions and the resource are already resolved
+// so nothing is read from the database
+func newPolicyRequest(caller testCaller) *policyRequest {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("uid", caller.uid)
+	c.Set("scope", caller.scope)
+	c.Set("roles", caller.roles)
+	c.Set("region", caller.region)
+	c.Params = gin.Params{{Key: "user_id", Value: caller.param}}
+
+	return &policyRequest{c: c, permissions: caller.permissions, resolved: true, resource: abac.Attributes{"region": "eu"}}
+}
+
+func TestPolicyEval(t *testing.T) {
+	useTestPolicies(t, `
+allow users:read if subject.region == resource.region
+deny users:write if subject.region == "us"
+`)
+
+	full := helper.ScopeFull
+	admin := testCaller{uid: "admin", scope: full, roles: []string{"ADMIN"}, permissions: []string{"users:*"}, param: "u1"}
+	usAdmin := testCaller{uid: "admin", scope: full, roles: []string{"ADMIN"}, permissions: []string{"users:*"}, region: "us", param: "u1"}
+	owner := testCaller{uid: "u1", scope: full, roles: []string{"USER"}, param: "u1"}
+	restrictedOwner := testCaller{uid: "u1", scope: "restricted", roles: []string{"ADMIN"}, permissions: []string{"*"}, param: "u1"}
+	other := testCaller{uid: "u2", scope: full, roles: []string{"USER"}, region: "eu", param: "u1"}
+	anonymous := testCaller{param: "u1"}
+
+	cases := []struct {
+		policy string
+		caller testCaller
+		want   bool
+	}{
+		{"self", owner, true},
+		{"self", other, false},
+		{"self", anonymous, false},
+		{"self", restrictedOwner, true},
+		{"role:ADMIN", admin, true},
+		{"role:ADMIN", owner, false},
+		{"role:ADMIN", restrictedOwner, false}, // restricted tokens only get self and authenticated
+		{"perm:users:write", admin, true},
+		{"perm:users:write", owner, false},
+		{"perm:users:write", restrictedOwner, false},
+		{"authenticated", restrictedOwner, true},
+		{"authenticated", anonymous, false},
+		{"abac:users:read", other, true},
+		{"abac:users:read", usAdmin, false},
+		{"abac:users:write", admin, false}, // no rule allows it
+		{"denied:users:write", usAdmin, true},
+		{"denied:users:write", admin, false},
+		{"denied:users:read", usAdmin, false},
+
+		// the form of the write routes: RBAC grants, ABAC deny rules can only take away
+		{"perm:users:write and not denied:users:write", admin, true},
+		{"perm:users:write and not denied:users:write", usAdmin, false},
+		{"perm:users:write and not denied:users:write", owner, false},
+		{"self or perm:users:write and not denied:users:write", owner, true},
+		{"self or perm:users:write and not denied:users:write", admin, true},
+		{"self or perm:users:write and not denied:users:write", usAdmin, false},
+		{"self or perm:users:write and not denied:users:write", other, false},
+		{"(self or perm:users:write) and not denied:users:write", owner, true},
+		{"not role:ADMIN", owner, true},
+		{"not role:ADMIN", admin, false},
+	}
+	for _, tc := range cases {
+		node, err := ParsePolicy(tc.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := node.eval(newPolicyRequest(tc.caller))
+		if err != nil || got != tc.want {
+			t.Errorf("%q for %+v: %v, %v, want %v", tc.policy, tc.caller, got, err, tc.want)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	useTestPolicies(t, `deny users:write if subject.region == "us"`)
+
+	// no :user_id in the path, or the resource of the ABAC rules would be loaded from the database
+	serve := func(policy string, caller testCaller) (int, gin.H) {
+		router := gin.New()
+		router.GET("/members/:member_id", func(c *gin.Context) {
+			c.Set("uid", caller.uid)
+			c.Set("scope", caller.scope)
+			c.Set("roles", caller.roles)
+			c.Set("region", caller.region)
+		}, Authorize(policy), func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		})
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/members/u1", nil))
+		var body gin.H
+		json.Unmarshal(recorder.Body.Bytes(), &body)
+		return recorder.Code, body
+	}
+
+	if code, _ := serve("self:member_id or role:ADMIN", testCaller{uid: "u1", scope: helper.ScopeFull}); code != http.StatusOK {
+		t.Errorf("owner got %d", code)
+	}
+
+	code, body := serve("self:member_id or role:ADMIN", testCaller{uid: "u2", scope: helper.ScopeFull, roles: []string{"USER"}})
+	if code != http.StatusForbidden || body["policy"] != "self:member_id or role:ADMIN" {
+		t.Errorf("other user got %d %v", code, body)
+	}
+
+	// the reason of the deny rule is given back
+	code, body = serve("role:ADMIN and not denied:users:write", testCaller{uid: "a", scope: helper.ScopeFull, roles: []string{"ADMIN"}, region: "us"})
+	if reasons, _ := body["reasons"].([]interface{}); code != http.StatusForbidden || len(reasons) != 1 {
+		t.Errorf("denied admin got %d %v", code, body)
+	}
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/someshnayak29/golang-jwt-project/database"
+	"github.com/someshnayak29/golang-jwt-project/ratelimit"
+)
+
+// RateLimitBackend is chosen with RATE_LIMIT_BACKEND, "mongo" shares the buckets between replicas, anything else keeps them in memory.
+// It can also be replaced directly, e.g. in tests.
+var RateLimitBackend ratelimit.Backend
+
+var rateLimitOnce sync.Once
+
+func rateLimitBackend() ratelimit.Backend {
+	rateLimitOnce.Do(func() {
+		if RateLimitBackend != nil {
+			return
+		}
+		if os.Getenv("RATE_LIMIT_BACKEND") == "mongo" {
+			backend := ratelimit.NewMongoBackend(database.OpenCollection(database.Client, "rate_limits"))
+			database.EnsureIndexes(database.OpenCollection(database.Client, "rate_limits"), backend.Indexes()...)
+			RateLimitBackend = backend
+		} else {
+			RateLimitBackend = ratelimit.NewMemoryBackend()
+		}
+	})
+	return RateLimitBackend
+}
+
+// limit for a route can be overridden with RATE_LIMIT_<ROUTE>, e.g. RATE_LIMIT_LOGIN=10/1m
+func routeLimit(route string, def ratelimit.Limit) ratelimit.Limit {
+	name := "RATE_LIMIT_" + strings.ToUpper(strings.NewReplacer("-", "_", "/", "_").Replace(route))
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	limit, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		log.Printf("ignoring %s: %v", name, err)
+		return def
+	}
+	return limit
+}
+
+// RateLimit throttles a route per client ip and, when the JSON body carries one, per email.
+// The ip bucket stops floods from one machine, the email bucket stops distributed attacks on one account.
+func RateLimit(route string, def ratelimit.Limit) gin.HandlerFunc {
+	limit := routeLimit(route, def)
+
+	return func(c *gin.Context) {
+
+		keys := []string{route + ":ip:" + c.ClientIP()}
+		if email := emailFromBody(c); email != "" {
+			keys = append(keys, route+":email:"+email)
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// every key takes a token and the most restrictive answer is the one reported
+		var worst *ratelimit.Result
+		for _, key := range keys {
+			res, err := rateLimitBackend().Take(ctx, key, limit)
+			if err != nil {
+				// the limiter must not take the login down with it, so failures let the request through
+				log.Println("rate limiter unavailable:", err)
+				c.Next()
+				return
+			}
+			if worst == nil || (!res.Allowed && worst.Allowed) || (res.Allowed == worst.Allowed && res.Remaining < worst.Remaining) {
+				r := res
+				worst = &r
+			}
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(worst.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(worst.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(worst.Reset)))
+		c.Header("RateLimit-Policy", strconv.Itoa(limit.Burst)+";w="+strconv.Itoa(ceilSeconds(limit.Period)))
+
+		if !worst.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(worst.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests, kindly try again later", "code": "rate_limited"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// emailFromBody peeks at the JSON body and puts it back so the handler can still bind it
+func emailFromBody(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	// only the first MB is looked at, the handler still gets the whole body: what was read, then the rest
+	original := c.Request.Body
+	body, err := io.ReadAll(io.LimitReader(original, 1<<20))
+	c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(body), original), original}
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(payload.Email))
+}
+
+// readCloser puts a body back together, reading from Reader and closing the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
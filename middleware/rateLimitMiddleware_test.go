@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEmailFromBodyKeepsTheBody(t *testing.T) {
+	small := `{"email":" Ada@Example.com ","password":"secret"}`
+	large := `{"email":"ada@example.com","padding":"` + strings.Repeat("x", 2<<20) + `"}`
+	cases := []struct {
+		body  string
+		email string
+	}{
+		{small, "ada@example.com"},
+		{large, ""}, // past the first MB it is not json anymore, the handler decides what to do with it
+		{`not json`, ""},
+		{``, ""},
+	}
+	for _, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/users/login", strings.NewReader(tc.body))
+
+		if email := emailFromBody(c); email != tc.email {
+			t.Errorf("email %q, want %q", email, tc.email)
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil || !bytes.Equal(body, []byte(tc.body)) {
+			t.Errorf("handler got %d bytes of a %d bytes body (%v)", len(body), len(tc.body), err)
+		}
+		if err := c.Request.Body.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
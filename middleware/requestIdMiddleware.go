@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+)
+
+// an X-Request-ID sent by a proxy is kept when it looks like an id, anything else is replaced
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID gives every request an id, sent back in X-Request-ID and stored in the audit log
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader("X-Request-ID")
+		if !requestIdPattern.MatchString(requestId) {
+			requestId, _ = helper.RandomToken(12)
+		}
+
+		c.Set("request_id", requestId)
+		c.Header("X-Request-ID", requestId)
+		c.Next()
+	}
+}
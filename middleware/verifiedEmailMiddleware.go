@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	helper "github.com/someshnayak29/golang-jwt-project/helpers"
+)
+
+// RequireVerifiedEmail must run after Authenticate, it rejects tokens issued to users who have not verified their email yet
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if c.GetString("scope") != helper.ScopeFull {
+			c.JSON(http.StatusForbidden, gin.H{"error": "email is not verified, kindly verify it and login again", "code": "email_not_verified"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEntry records one privileged action, who did what to whom.
+// Entries are hash-chained: Hash covers the entry and Prev_hash, the Hash of the entry Seq-1 (see package audit).
+
+type AuditEntry struct {
+	ID         primitive.ObjectID     `bson:"_id"`
+	Seq        int64                  `json:"seq"`       // position in the chain, entries written before the chain existed have none
+	Action     string                 `json:"action"`    // e.g. user.disable
+	Actor_id   string                 `json:"actor_id"`  // user_id of the admin
+	Target_id  string                 `json:"target_id"` // user_id (or other id) the action was done on
+	Tenant_id  string                 `json:"tenant_id"`
+	Ip         string                 `json:"ip"`
+	Request_id string                 `json:"request_id"` // X-Request-ID of the request, see middleware.RequestID
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Changes    map[string]AuditChange `json:"changes,omitempty"` // field => value before and after the action
+	Created_at time.Time              `json:"created_at"`
+	Prev_hash  string                 `json:"prev_hash"`
+	Hash       string                 `json:"hash"`
+}
+
+// AuditChange is the value of one field before and after an action, nil when the field did not exist
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
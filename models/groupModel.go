@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Group is a team inside an organization, its members inherit its permissions on top of their roles
+
+type Group struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Group_id    *string            `json:"group_id"`
+	Tenant_id   *string            `json:"tenant_id"`
+	Name        *string            `json:"name" validate:"required,min=2,max=100"`
+	Description string             `json:"description" validate:"max=200"`
+	Permissions []string           `json:"permissions" validate:"dive,required"`
+	Members     []string           `json:"members"` // user_id of each member
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+}
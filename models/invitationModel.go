@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invitation is sent by an admin, the invitee becomes a user of Tenant_id with Roles when accepting it
+
+type Invitation struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Invitation_id *string            `json:"invitation_id"`
+	Tenant_id     *string            `json:"tenant_id"`
+	Email         *string            `json:"email"`
+	Roles         []string           `json:"roles"`
+	Invited_by    *string            `json:"invited_by"` // user_id of the admin
+	Status        string             `json:"status"`     // pending, accepted or revoked
+	User_id       *string            `json:"user_id"`    // the account created on acceptance
+	Expires_at    time.Time          `json:"expires_at"`
+	Created_at    time.Time          `json:"created_at"`
+	Updated_at    time.Time          `json:"updated_at"`
+}
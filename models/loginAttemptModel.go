@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginAttempt counts consecutive failed logins for one key, either "account:<email>" or "ip:<client ip>".
+// It lives in mongo and not in memory so that every replica sees the same counters.
+
+type LoginAttempt struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	Key             string             `json:"key"`
+	Failures        int                `json:"failures"`
+	Last_failure_at time.Time          `json:"last_failure_at"`
+	Next_attempt_at time.Time          `json:"next_attempt_at"`
+	Locked_until    time.Time          `json:"locked_until"`
+}
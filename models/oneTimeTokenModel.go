@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OneTimeToken is a single-use secret (password reset link etc.) issued to a user.
+// Only the sha256 hash of the token is stored, the raw value is only ever sent to the user.
+
+type OneTimeToken struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Purpose    string             `json:"purpose"`
+	User_id    string             `json:"user_id"`
+	Token_hash string             `json:"token_hash"`
+	Binding    string             `json:"binding"` // optional context the token is only valid in, checked by the caller
+	Expires_at time.Time          `json:"expires_at"`
+	Created_at time.Time          `json:"created_at"`
+}
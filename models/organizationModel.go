@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Organization is a tenant, every user belongs to exactly one through User.Tenant_id
+
+type Organization struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Name        *string            `json:"name" validate:"required,min=2,max=100"`
+	Tenant_id   *string            `json:"tenant_id" validate:"required,min=2,max=50,lowercase,alphanum"` // short id used in requests and tokens, e.g. "acme"
+	Open_signup bool               `json:"open_signup"`                                                   // anyone can self signup into it, otherwise users only join through invitations
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+}
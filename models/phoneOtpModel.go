@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PhoneOtp is the pending verification code for a user's phone, there is at most one per user
+
+type PhoneOtp struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	User_id    string             `json:"user_id"`
+	Phone      string             `json:"phone"`
+	Code_hash  string             `json:"code_hash"`
+	Attempts   int                `json:"attempts"`
+	Expires_at time.Time          `json:"expires_at"`
+	Created_at time.Time          `json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Role is a named set of permissions, users hold roles by name in User.Roles.
+// A role belongs to the organization Tenant_id, the built-in roles have none and are shared by all of them.
+
+type Role struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Name        string             `json:"name" validate:"required,min=2,max=50,uppercase"`
+	Description string             `json:"description" validate:"max=200"`
+	Permissions []string           `json:"permissions" validate:"dive,required"`
+	Tenant_id   *string            `json:"tenant_id,omitempty" validate:"omitempty,max=50"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+}
+
+// Permission is an entry of the permission catalog, e.g. "users:read"
+
+type Permission struct {
+	Name        string `bson:"_id" json:"name"`
+	Description string `json:"description"`
+}
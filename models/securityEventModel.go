@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SecurityEvent records something that happened to the security of an account: a login attempt, a refresh,
+// a password or MFA change, a lockout. Users can read their own events, unlike the audit log of admin actions.
+
+type SecurityEvent struct {
+	ID         primitive.ObjectID     `bson:"_id" json:"event_id"`
+	User_id    string                 `json:"user_id"`
+	Tenant_id  string                 `json:"tenant_id"`
+	Type       string                 `json:"type"`    // e.g. login, password.change
+	Outcome    string                 `json:"outcome"` // success, failure or blocked
+	Ip         string                 `json:"ip"`
+	User_agent string                 `json:"user_agent"`
+	Details    map[string]interface{} `json:"details,omitempty"` // e.g. method of a login, reason of a failure
+	Created_at time.Time              `json:"created_at"`
+	Expires_at time.Time              `json:"-"` // the event is pruned after it, see SECURITY_EVENT_RETENTION_DAYS
+}
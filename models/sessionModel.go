@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is one login of a user on one device, the access tokens carry its Session_id as sid.
+// Every refresh rotates Refresh_jti, a refresh token of the family with an older jti means it was stolen.
+
+type Session struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Session_id     string             `json:"session_id"`
+	User_id        string             `json:"user_id"`
+	Tenant_id      string             `json:"tenant_id"`
+	Device         string             `json:"device"` // X-Device-Name header, or guessed from the user agent
+	User_agent     string             `json:"user_agent"`
+	Ip             string             `json:"ip"` // ip of the last login or refresh
+	Refresh_family string             `json:"-"`  // the same for every refresh token of the session
+	Refresh_jti    string             `json:"-"`  // id of the only refresh token of the family that is still valid
+	Created_at     time.Time          `json:"created_at"`
+	Last_used_at   time.Time          `json:"last_used_at"`
+	Expires_at     time.Time          `json:"expires_at"` // expiry of the current refresh token, the session is deleted after it
+	Revoked_at     *time.Time         `json:"revoked_at,omitempty"`
+	Current        bool               `bson:"-" json:"current"` // the session of the token used for the request
+}
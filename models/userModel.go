@@ -9,16 +9,28 @@ import (
 // validate no space should be used
 
 type User struct {
-	ID            primitive.ObjectID `bson:"_id"`
-	First_name    *string            `json:"first_name" validate:"required,min=2,max=100"`
-	Last_name     *string            `json:"last_name" validate:"required,min=2,max=100"`
-	Password      *string            `json:"password" validate:"required,min=6"`
-	Email         *string            `json:"email" validate:"email,required"`
-	Phone         *string            `json:"phone" validate:"required"`
-	Token         *string            `json:"token"`
-	User_type     *string            `json:"user_type" validate:"required,eq=ADMIN|eq=USER"`
-	Refresh_token *string            `json:"refresh_token"`
-	Created_at    time.Time          `json:"created_at"`
-	Updated_at    time.Time          `json:"updated_at"`
-	User_id       *string            `json:"user_id"`
+	ID              primitive.ObjectID `bson:"_id"`
+	First_name      *string            `json:"first_name" validate:"required,min=2,max=100"`
+	Last_name       *string            `json:"last_name" validate:"required,min=2,max=100"`
+	Password        *string            `json:"password" validate:"required"` // strength is checked by helpers.PasswordPolicy
+	Email           *string            `json:"email" validate:"email,required"`
+	Phone           *string            `json:"phone" validate:"required,e164"`           // normalized by helpers.NormalizePhone before validation
+	User_type       *string            `json:"user_type" validate:"required"`            // primary role, kept for older clients, always USER on self signup
+	Roles           []string           `json:"roles" validate:"omitempty,dive,required"` // names of documents in the roles collection
+	Created_at      time.Time          `json:"created_at"`
+	Updated_at      time.Time          `json:"updated_at"`
+	User_id         *string            `json:"user_id"`
+	Tenant_id       *string            `json:"tenant_id" validate:"omitempty,max=50"` // organization of the user, missing means helpers.DefaultTenant
+	Region          *string            `json:"region" validate:"omitempty,max=50"`    // used by ABAC policies, e.g. subject.region == resource.region
+	Email_verified  bool               `json:"email_verified"`
+	Phone_verified  bool               `json:"phone_verified"`
+	Mfa_enabled     bool               `json:"mfa_enabled"`
+	Disabled        bool               `json:"disabled"` // set by an admin, login and every token are refused
+	Disabled_reason *string            `json:"disabled_reason"`
+	Token_version   int                `json:"-"` // bumped to revoke every token issued before
+	// MFA secrets are never read from or written to JSON
+	Mfa_secret         *string  `json:"-"`
+	Mfa_pending_secret *string  `json:"-"` // secret waiting for the first code, before MFA is turned on
+	Mfa_recovery_codes []string `json:"-"` // HashToken of each unused recovery code
+	Mfa_last_step      int64    `json:"-"` // last TOTP time step accepted, so a code can't be replayed
 }
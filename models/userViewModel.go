@@ -0,0 +1,104 @@
+package models
+
+import "time"
+
+// Responses never encode User itself, it carries the password hash and the stored tokens.
+// Each view lists its fields explicitly, a field added to User is not sent until it is added here.
+
+// UserSelfView is what users see of their own account
+type UserSelfView struct {
+	User_id        *string   `json:"user_id"`
+	First_name     *string   `json:"first_name"`
+	Last_name      *string   `json:"last_name"`
+	Email          *string   `json:"email"`
+	Phone          *string   `json:"phone"`
+	User_type      *string   `json:"user_type"`
+	Roles          []string  `json:"roles"`
+	Tenant_id      *string   `json:"tenant_id"`
+	Region         *string   `json:"region"`
+	Email_verified bool      `json:"email_verified"`
+	Phone_verified bool      `json:"phone_verified"`
+	Mfa_enabled    bool      `json:"mfa_enabled"`
+	Created_at     time.Time `json:"created_at"`
+	Updated_at     time.Time `json:"updated_at"`
+}
+
+// UserAdminView is what an admin sees of another account
+type UserAdminView struct {
+	UserSelfView
+	Disabled        bool    `json:"disabled"`
+	Disabled_reason *string `json:"disabled_reason"`
+}
+
+// UserListItem is one row of GET /users
+type UserListItem struct {
+	User_id        *string   `json:"user_id"`
+	First_name     *string   `json:"first_name"`
+	Last_name      *string   `json:"last_name"`
+	Email          *string   `json:"email"`
+	User_type      *string   `json:"user_type"`
+	Roles          []string  `json:"roles"`
+	Tenant_id      *string   `json:"tenant_id"`
+	Email_verified bool      `json:"email_verified"`
+	Disabled       bool      `json:"disabled"`
+	Created_at     time.Time `json:"created_at"`
+}
+
+// LoginResponse is the answer to every successful login, the tokens are only ever sent to their owner here
+type LoginResponse struct {
+	UserSelfView
+	Token         string `json:"token"`
+	Refresh_token string `json:"refresh_token"`
+	Session_id    string `json:"session_id"`
+}
+
+func NewUserSelfView(user User) UserSelfView {
+	return UserSelfView{
+		User_id:        user.User_id,
+		First_name:     user.First_name,
+		Last_name:      user.Last_name,
+		Email:          user.Email,
+		Phone:          user.Phone,
+		User_type:      user.User_type,
+		Roles:          user.Roles,
+		Tenant_id:      user.Tenant_id,
+		Region:         user.Region,
+		Email_verified: user.Email_verified,
+		Phone_verified: user.Phone_verified,
+		Mfa_enabled:    user.Mfa_enabled,
+		Created_at:     user.Created_at,
+		Updated_at:     user.Updated_at,
+	}
+}
+
+func NewUserAdminView(user User) UserAdminView {
+	return UserAdminView{
+		UserSelfView:    NewUserSelfView(user),
+		Disabled:        user.Disabled,
+		Disabled_reason: user.Disabled_reason,
+	}
+}
+
+func NewUserListItem(user User) UserListItem {
+	return UserListItem{
+		User_id:        user.User_id,
+		First_name:     user.First_name,
+		Last_name:      user.Last_name,
+		Email:          user.Email,
+		User_type:      user.User_type,
+		Roles:          user.Roles,
+		Tenant_id:      user.Tenant_id,
+		Email_verified: user.Email_verified,
+		Disabled:       user.Disabled,
+		Created_at:     user.Created_at,
+	}
+}
+
+func NewLoginResponse(user User, token string, refreshToken string, sessionId string) LoginResponse {
+	return LoginResponse{
+		UserSelfView:  NewUserSelfView(user),
+		Token:         token,
+		Refresh_token: refreshToken,
+		Session_id:    sessionId,
+	}
+}
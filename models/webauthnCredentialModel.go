@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebauthnCredential is a passkey or security key registered by a user, linked through user_id
+
+type WebauthnCredential struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	User_id        string             `json:"user_id"`
+	Credential_id  string             `json:"credential_id"` // base64url, as sent by browsers
+	Public_key     []byte             `json:"-"`             // COSE encoded
+	Sign_count     uint32             `json:"sign_count"`
+	Name           string             `json:"name"`
+	Clone_detected bool               `json:"clone_detected"` // set when the counter went backwards, the credential can't be used anymore
+	Created_at     time.Time          `json:"created_at"`
+	Last_used_at   time.Time          `json:"last_used_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook is a subscription of another system (billing, CRM ...) to the user events of one organization
+
+type Webhook struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Webhook_id  string             `json:"webhook_id"`
+	Tenant_id   string             `json:"tenant_id"`
+	Url         string             `json:"url"`
+	Events      []string           `json:"events"` // event types, or "*" for all of them
+	Description string             `json:"description"`
+	Secret      string             `json:"-"` // signs the payloads, only shown once when the webhook is created
+	Created_by  string             `json:"created_by"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+}
+
+// WebhookDelivery is one event waiting in the outbox for one webhook, or already delivered.
+// Payload is kept as the exact JSON sent, every attempt signs the same bytes.
+
+type WebhookDelivery struct {
+	ID               primitive.ObjectID `bson:"_id"`
+	Delivery_id      string             `json:"delivery_id"`
+	Webhook_id       string             `json:"webhook_id"`
+	Tenant_id        string             `json:"tenant_id"`
+	Event_id         string             `json:"event_id"`
+	Event_type       string             `json:"event_type"`
+	Payload          string             `json:"payload"`
+	Status           string             `json:"status"` // pending, delivered or dead
+	Attempts         int                `json:"attempts"`
+	Next_attempt_at  time.Time          `json:"next_attempt_at"`
+	Last_status_code int                `json:"last_status_code,omitempty"`
+	Last_error       string             `json:"last_error,omitempty"`
+	Created_at       time.Time          `json:"created_at"`
+	Delivered_at     *time.Time         `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// MemoryBackend keeps buckets in process memory, counters are not shared between replicas
+type MemoryBackend struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{buckets: map[string]*bucket{}, lastSweep: time.Now()}
+}
+
+func (m *MemoryBackend) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	}
+
+	// refill for the time passed since the last request, never above the burst size
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.rate())
+	b.updated = now
+	b.period = limit.Period
+
+	if b.tokens < 1 {
+		return result(false, b.tokens, limit), nil
+	}
+	b.tokens--
+	return result(true, b.tokens, limit), nil
+}
+
+// sweep drops buckets that have been full for a while, so the map does not grow forever
+func (m *MemoryBackend) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) > b.period {
+			delete(m.buckets, key)
+		}
+	}
+}
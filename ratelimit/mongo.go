@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoBackend keeps buckets in a collection so every replica shares the same limits.
+// The whole refill + take is a single pipeline update, so it is atomic without any locking.
+type MongoBackend struct {
+	collection *mongo.Collection
+}
+
+func NewMongoBackend(collection *mongo.Collection) *MongoBackend {
+	return &MongoBackend{collection: collection}
+}
+
+// Indexes that the collection needs, expired buckets are removed by mongo itself
+func (m *MongoBackend) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+}
+
+type mongoBucket struct {
+	Tokens  float64 `bson:"tokens"`
+	Allowed bool    `bson:"allowed"`
+}
+
+func (m *MongoBackend) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now().UTC()
+	burst := float64(limit.Burst)
+
+	// tokens = min(burst, tokens + elapsed seconds * rate), a missing bucket starts full
+	refill := bson.M{"$min": bson.A{burst, bson.M{"$add": bson.A{
+		bson.M{"$ifNull": bson.A{"$tokens", burst}},
+		bson.M{"$multiply": bson.A{
+			bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}}, 1000}},
+			limit.rate(),
+		}},
+	}}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refill, "updated_at": now, "expires_at": now.Add(limit.Period)}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{"tokens": bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}}}}},
+	}
+
+	upsert := true
+	after := options.After
+
+	var b mongoBucket
+	err := m.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline,
+		&options.FindOneAndUpdateOptions{Upsert: &upsert, ReturnDocument: &after},
+	).Decode(&b)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result(b.Allowed, b.Tokens, limit), nil
+}
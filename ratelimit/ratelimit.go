@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket: it holds at most Burst tokens and refills completely over Period.
+// e.g. {Burst: 5, Period: time.Minute} => 5 requests at once, then one every 12 seconds.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// per second refill rate of the bucket
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// ParseLimit reads limits written as "<burst>/<period>", e.g. "5/1m" or "100/1h"
+func ParseLimit(s string) (Limit, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 2 {
+		return Limit{}, errors.New("rate limit must look like <burst>/<period>, e.g. 5/1m")
+	}
+
+	burst, err := strconv.Atoi(parts[0])
+	if err != nil || burst < 1 {
+		return Limit{}, errors.New("rate limit burst must be a positive number")
+	}
+
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Limit{}, errors.New("rate limit period must be a positive duration")
+	}
+	return Limit{Burst: burst, Period: period}, nil
+}
+
+// Result of taking one token out of a bucket
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // time until one token is available again, zero when allowed
+	Reset      time.Duration // time until the bucket is full again
+}
+
+// Backend stores the buckets, MemoryBackend for a single instance and MongoBackend when running several replicas
+type Backend interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// result computes the response fields from the tokens left after taking (or failing to take) one
+func result(allowed bool, tokens float64, limit Limit) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(limit.Burst) - tokens) / limit.rate() * float64(time.Second)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / limit.rate() * float64(time.Second))
+	}
+	return res
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	valid := map[string]Limit{
+		"5/1m":     {Burst: 5, Period: time.Minute},
+		" 100/1h ": {Burst: 100, Period: time.Hour},
+		"1/500ms":  {Burst: 1, Period: 500 * time.Millisecond},
+		"10/1h30m": {Burst: 10, Period: 90 * time.Minute},
+	}
+	for raw, want := range valid {
+		if got, err := ParseLimit(raw); err != nil || got != want {
+			t.Errorf("ParseLimit(%q) = %v, %v, want %v", raw, got, err, want)
+		}
+	}
+
+	for _, raw := range []string{"", "5", "5/", "/1m", "0/1m", "-1/1m", "five/1m", "5/0s", "5/-1m", "5/1m/2", "5/minute"} {
+		if got, err := ParseLimit(raw); err == nil {
+			t.Errorf("ParseLimit(%q) = %v, want an error", raw, got)
+		}
+	}
+}
+
+func TestResult(t *testing.T) {
+	limit := Limit{Burst: 5, Period: time.Minute} // one token every 12 seconds
+
+	res := result(true, 3.5, limit)
+	if !res.Allowed || res.Limit != 5 || res.Remaining != 3 || res.RetryAfter != 0 || res.Reset != 18*time.Second {
+		t.Errorf("allowed: %+v", res)
+	}
+
+	res = result(false, 0.25, limit)
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != 9*time.Second || res.Reset != 57*time.Second {
+		t.Errorf("refused: %+v", res)
+	}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	limit := Limit{Burst: 3, Period: 300 * time.Millisecond} // one token every 100ms
+
+	for i := 0; i < 3; i++ {
+		res, err := backend.Take(ctx, "ip:1", limit)
+		if err != nil || !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d of the burst: %+v, %v", i+1, res, err)
+		}
+	}
+
+	res, _ := backend.Take(ctx, "ip:1", limit)
+	if res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > 100*time.Millisecond {
+		t.Fatalf("request over the burst: %+v", res)
+	}
+
+	// every key has its own bucket
+	if res, _ := backend.Take(ctx, "ip:2", limit); !res.Allowed {
+		t.Fatalf("another key was limited: %+v", res)
+	}
+
+	// one token is back after a third of the period, not the whole burst
+	time.Sleep(120 * time.Millisecond)
+	if res, _ := backend.Take(ctx, "ip:1", limit); !res.Allowed {
+		t.Fatalf("bucket did not refill: %+v", res)
+	}
+	if res, _ := backend.Take(ctx, "ip:1", limit); res.Allowed {
+		t.Fatalf("bucket refilled more than one token: %+v", res)
+	}
+
+	// a full period refills the bucket up to the burst only
+	time.Sleep(time.Second)
+	for i := 0; i < 3; i++ {
+		if res, _ := backend.Take(ctx, "ip:1", limit); !res.Allowed {
+			t.Fatalf("request %d after a full refill: %+v", i+1, res)
+		}
+	}
+	if res, _ := backend.Take(ctx, "ip:1", limit); res.Allowed {
+		t.Fatalf("bucket grew above its burst: %+v", res)
+	}
+}
+
+func TestMemoryBackendSweep(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.Take(context.Background(), "short", Limit{Burst: 1, Period: time.Second})
+	backend.Take(context.Background(), "long", Limit{Burst: 1, Period: time.Hour})
+
+	now := time.Now()
+	backend.sweep(now.Add(30 * time.Second))
+	if len(backend.buckets) != 2 {
+		t.Fatal("swept less than a minute after the last sweep")
+	}
+
+	backend.sweep(now.Add(2 * time.Minute))
+	if _, ok := backend.buckets["short"]; ok {
+		t.Fatal("a bucket idle for longer than its period was kept")
+	}
+	if _, ok := backend.buckets["long"]; !ok {
+		t.Fatal("a bucket still refilling was dropped")
+	}
+}
@@ -1,13 +1,30 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	controller "github.com/someshnayak29/golang-jwt-project/controllers"
+	"github.com/someshnayak29/golang-jwt-project/middleware"
+	"github.com/someshnayak29/golang-jwt-project/ratelimit"
 )
 
 func AuthRoutes(incomingRoutes *gin.Engine) {
 
 	// these are public routes and accessible by everyone, therefore no middleware needed to check token validacy
-	incomingRoutes.POST("users/signup", controller.Signup()) // same as usual routes =>  endpt., function()
-	incomingRoutes.POST("users/login", controller.Login())
+	// but they are rate limited, as every signup and login hashes a password, which is expensive
+	incomingRoutes.POST("users/signup", middleware.RateLimit("signup", ratelimit.Limit{Burst: 5, Period: time.Minute}), controller.Signup()) // same as usual routes =>  endpt., function()
+	incomingRoutes.POST("users/login", middleware.RateLimit("login", ratelimit.Limit{Burst: 10, Period: time.Minute}), controller.Login())
+	incomingRoutes.POST("users/token/refresh", middleware.RateLimit("token_refresh", ratelimit.Limit{Burst: 30, Period: time.Minute}), controller.RefreshToken())
+	incomingRoutes.POST("users/login/mfa", middleware.RateLimit("login_mfa", ratelimit.Limit{Burst: 10, Period: time.Minute}), controller.LoginMfa())
+	incomingRoutes.POST("users/login/webauthn/begin", middleware.RateLimit("login_webauthn", ratelimit.Limit{Burst: 10, Period: time.Minute}), controller.BeginPasskeyLogin())
+	incomingRoutes.POST("users/login/webauthn/finish", middleware.RateLimit("login_webauthn", ratelimit.Limit{Burst: 10, Period: time.Minute}), controller.FinishPasskeyLogin())
+	incomingRoutes.POST("users/login/magic", middleware.RateLimit("login_magic", ratelimit.Limit{Burst: 3, Period: 15 * time.Minute}), controller.RequestMagicLink())
+	incomingRoutes.GET("users/login/magic/callback", middleware.RateLimit("login_magic_callback", ratelimit.Limit{Burst: 10, Period: time.Minute}), controller.MagicLinkCallback())
+	incomingRoutes.POST("users/password/forgot", middleware.RateLimit("password_forgot", ratelimit.Limit{Burst: 5, Period: 15 * time.Minute}), controller.ForgotPassword())
+	incomingRoutes.POST("users/password/reset", middleware.RateLimit("password_reset", ratelimit.Limit{Burst: 10, Period: 15 * time.Minute}), controller.ResetPassword())
+	incomingRoutes.GET("users/verify-email", middleware.RateLimit("verify_email", ratelimit.Limit{Burst: 20, Period: 15 * time.Minute}), controller.VerifyEmail())
+	incomingRoutes.POST("users/verify-email", middleware.RateLimit("verify_email", ratelimit.Limit{Burst: 20, Period: 15 * time.Minute}), controller.VerifyEmail())
+	incomingRoutes.POST("users/invitations/accept", middleware.RateLimit("invitation_accept", ratelimit.Limit{Burst: 5, Period: 15 * time.Minute}), controller.AcceptInvitation())
+	incomingRoutes.POST("users/verify-email/resend", middleware.RateLimit("verify_email_resend", ratelimit.Limit{Burst: 5, Period: 15 * time.Minute}), controller.ResendVerification())
 }
@@ -11,7 +11,68 @@ func UserRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.Use(middleware.Authenticate())
 	/* we are using middleware because they are protected routes, earlier while login signup we didnt had token, bt after
 	logging in we have token, therefore we have used middleware, user should not be allowed to use userRoutes without token*/
-	incomingRoutes.GET("/users", controller.GetUsers())
-	incomingRoutes.GET("/users/:user_id", controller.GetUser())
+
+	// every route declares who may call it, the handlers themselves contain no authorization logic (see middleware.Authorize)
+	// users who have not verified their email can still see their own profile
+	incomingRoutes.GET("/users/:user_id", middleware.Authorize("self or perm:users:read or abac:users:read"), controller.GetUser())
+	incomingRoutes.POST("/users/phone/otp", middleware.Authorize("authenticated"), controller.SendPhoneOtp())
+	incomingRoutes.POST("/users/phone/verify", middleware.Authorize("authenticated"), controller.VerifyPhone())
+	incomingRoutes.POST("/users/password/change", middleware.Authorize("authenticated"), controller.ChangePassword())
+	// a user who is not verified yet can still log out a stolen device
+	incomingRoutes.GET("/users/:user_id/sessions", middleware.Authorize("self or perm:users:read"), controller.ListSessions())
+	incomingRoutes.DELETE("/users/:user_id/sessions", middleware.Authorize("self or perm:users:write and not denied:users:write"), controller.RevokeOtherSessions())
+	incomingRoutes.DELETE("/users/:user_id/sessions/:session_id", middleware.Authorize("self or perm:users:write and not denied:users:write"), controller.RevokeSession())
+	incomingRoutes.GET("/users/:user_id/security-events", middleware.Authorize("self or perm:users:read"), controller.ListSecurityEvents())
+
+	incomingRoutes.Use(middleware.RequireVerifiedEmail())
+	incomingRoutes.GET("/users", middleware.Authorize("perm:users:read"), controller.GetUsers())
+	incomingRoutes.POST("/users/mfa/enroll", middleware.Authorize("authenticated"), controller.EnrollMfa())
+	incomingRoutes.POST("/users/mfa/confirm", middleware.Authorize("authenticated"), controller.ConfirmMfa())
+	incomingRoutes.POST("/users/webauthn/register/begin", middleware.Authorize("authenticated"), controller.BeginPasskeyRegistration())
+	incomingRoutes.POST("/users/webauthn/register/finish", middleware.Authorize("authenticated"), controller.FinishPasskeyRegistration())
+	incomingRoutes.GET("/users/webauthn/credentials", middleware.Authorize("authenticated"), controller.ListPasskeys())
+	incomingRoutes.DELETE("/users/webauthn/credentials/:credential_id", middleware.Authorize("authenticated"), controller.DeletePasskey())
+	incomingRoutes.POST("/users/:user_id/unlock", middleware.Authorize("perm:users:write and not denied:users:write"), controller.UnlockUser())
+	incomingRoutes.PUT("/users/:user_id/roles", middleware.Authorize("perm:roles:assign and not denied:roles:assign"), controller.SetUserRoles())
+
+	incomingRoutes.GET("/invitations", middleware.Authorize("perm:users:write and not denied:users:write"), controller.ListInvitations())
+	incomingRoutes.POST("/invitations", middleware.Authorize("perm:users:write and not denied:users:write"), controller.CreateInvitation())
+	incomingRoutes.DELETE("/invitations/:invitation_id", middleware.Authorize("perm:users:write and not denied:users:write"), controller.RevokeInvitation())
+
+	incomingRoutes.GET("/roles", middleware.Authorize("perm:roles:read"), controller.ListRoles())
+	incomingRoutes.POST("/roles", middleware.Authorize("perm:roles:write and not denied:roles:write"), controller.SaveRole())
+	incomingRoutes.GET("/permissions", middleware.Authorize("perm:roles:read"), controller.ListPermissions())
+
+	incomingRoutes.GET("/users/:user_id/permissions", middleware.Authorize("self or perm:users:read"), controller.GetUserPermissions())
+	incomingRoutes.GET("/groups", middleware.Authorize("perm:groups:read"), controller.ListGroups())
+	incomingRoutes.POST("/groups", middleware.Authorize("perm:groups:write and not denied:groups:write"), controller.CreateGroup())
+	incomingRoutes.GET("/groups/:group_id", middleware.Authorize("perm:groups:read"), controller.GetGroup())
+	incomingRoutes.PATCH("/groups/:group_id", middleware.Authorize("perm:groups:write and not denied:groups:write"), controller.UpdateGroup())
+	incomingRoutes.DELETE("/groups/:group_id", middleware.Authorize("perm:groups:write and not denied:groups:write"), controller.DeleteGroup())
+	incomingRoutes.POST("/groups/:group_id/members", middleware.Authorize("perm:groups:write and not denied:groups:write"), controller.AddGroupMembers())
+	incomingRoutes.DELETE("/groups/:group_id/members/:user_id", middleware.Authorize("perm:groups:write and not denied:groups:write"), controller.RemoveGroupMember())
+
+	incomingRoutes.POST("/admin/users", middleware.Authorize("perm:users:write and not denied:users:write"), controller.AdminCreateUser())
+	incomingRoutes.POST("/admin/users/:user_id/disable", middleware.Authorize("perm:users:write and not denied:users:write"), controller.DisableUser())
+	incomingRoutes.POST("/admin/users/:user_id/enable", middleware.Authorize("perm:users:write and not denied:users:write"), controller.EnableUser())
+	incomingRoutes.DELETE("/admin/users/:user_id", middleware.Authorize("perm:users:write and not denied:users:write"), controller.DeleteUser())
+	incomingRoutes.PUT("/admin/users/:user_id/roles", middleware.Authorize("perm:roles:assign and not denied:roles:assign"), controller.SetUserRoles())
+	incomingRoutes.POST("/admin/users/:user_id/mfa/reset", middleware.Authorize("perm:users:write and not denied:users:write"), controller.ResetUserMfa())
+	incomingRoutes.POST("/admin/users/:user_id/logout", middleware.Authorize("perm:users:write and not denied:users:write"), controller.ForceLogout())
+	incomingRoutes.POST("/admin/users/:user_id/unlock", middleware.Authorize("perm:users:write and not denied:users:write"), controller.UnlockUser())
+	incomingRoutes.GET("/admin/audit-log", middleware.Authorize("perm:audit:read"), controller.ListAuditLog())
+
+	incomingRoutes.GET("/webhooks", middleware.Authorize("perm:webhooks:read"), controller.ListWebhooks())
+	incomingRoutes.POST("/webhooks", middleware.Authorize("perm:webhooks:write and not denied:webhooks:write"), controller.CreateWebhook())
+	incomingRoutes.DELETE("/webhooks/:webhook_id", middleware.Authorize("perm:webhooks:write and not denied:webhooks:write"), controller.DeleteWebhook())
+	incomingRoutes.GET("/webhooks/:webhook_id/deliveries", middleware.Authorize("perm:webhooks:read"), controller.ListWebhookDeliveries())
+	incomingRoutes.POST("/webhooks/:webhook_id/deliveries/:delivery_id/redeliver", middleware.Authorize("perm:webhooks:write and not denied:webhooks:write"), controller.RedeliverWebhookDelivery())
+
+	incomingRoutes.GET("/organizations", middleware.Authorize("role:SUPER_ADMIN"), controller.ListOrganizations())
+	incomingRoutes.POST("/organizations", middleware.Authorize("role:SUPER_ADMIN"), controller.CreateOrganization())
+
+	incomingRoutes.GET("/policies", middleware.Authorize("perm:policies:read"), controller.ListPolicies())
+	incomingRoutes.POST("/policies/reload", middleware.Authorize("perm:policies:write"), controller.ReloadPolicies())
+	incomingRoutes.POST("/policies/explain", middleware.Authorize("perm:policies:read"), controller.ExplainPolicy())
 
 }
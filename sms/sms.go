@@ -0,0 +1,69 @@
+package sms
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+)
+
+// SMSSender is implemented by every way we know of delivering text messages.
+// Only local implementations ship here, a provider (Twilio, SNS ...) only has to implement Send.
+type SMSSender interface {
+	Send(ctx context.Context, to string, body string) error
+}
+
+// ConsoleSender prints the message, useful while developing locally
+type ConsoleSender struct{}
+
+func (ConsoleSender) Send(ctx context.Context, to string, body string) error {
+	log.Printf("sms to=%s: %s", to, body)
+	return nil
+}
+
+// SentSMS is a message recorded by MemorySender
+type SentSMS struct {
+	To   string
+	Body string
+}
+
+// MemorySender keeps sent messages in memory so tests can read the OTP back
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []SentSMS
+}
+
+func (s *MemorySender) Send(ctx context.Context, to string, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, SentSMS{To: to, Body: body})
+	return nil
+}
+
+// Messages returns a copy of everything sent so far
+func (s *MemorySender) Messages() []SentSMS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]SentSMS(nil), s.messages...)
+}
+
+// Default is the sender used by Send. When left nil it is picked using SMS_DRIVER (console or memory) on first use.
+var Default SMSSender
+
+var defaultOnce sync.Once
+
+func Send(ctx context.Context, to string, body string) error {
+	defaultOnce.Do(func() {
+		if Default != nil {
+			return
+		}
+		if os.Getenv("SMS_DRIVER") == "memory" {
+			Default = &MemorySender{}
+		} else {
+			Default = ConsoleSender{}
+		}
+	})
+	return Default.Send(ctx, to, body)
+}
@@ -0,0 +1,202 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+// Only the small subset of CBOR (RFC 8949) used by WebAuthn is supported: integers, byte and text strings,
+// arrays, maps and simple values, always with definite lengths as CTAP2 requires.
+
+var ErrCBOR = errors.New("malformed CBOR")
+
+// decodeCBOR decodes one item and returns it with the number of bytes it used.
+// Integers come back as int64, maps as map[any]any with int64 or string keys.
+func decodeCBOR(data []byte) (any, int, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (any, int, error) {
+	if len(data) == 0 || depth > 16 {
+		return nil, 0, ErrCBOR
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	// simple values and floats
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, 1, nil
+		case 21:
+			return true, 1, nil
+		case 22, 23:
+			return nil, 1, nil
+		}
+		return nil, 0, ErrCBOR
+	}
+
+	arg, n, err := readArgument(data, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, 0, ErrCBOR
+		}
+		return int64(arg), n, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, 0, ErrCBOR
+		}
+		return -1 - int64(arg), n, nil
+	case 2, 3:
+		if arg > uint64(len(data)-n) {
+			return nil, 0, ErrCBOR
+		}
+		end := n + int(arg)
+		if major == 2 {
+			return append([]byte(nil), data[n:end]...), end, nil
+		}
+		return string(data[n:end]), end, nil
+	case 4:
+		if arg > uint64(len(data)) {
+			return nil, 0, ErrCBOR
+		}
+		items := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, used, err := decodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			n += used
+		}
+		return items, n, nil
+	case 5:
+		if arg > uint64(len(data)) {
+			return nil, 0, ErrCBOR
+		}
+		m := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, used, err := decodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += used
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, ErrCBOR
+			}
+
+			value, used, err := decodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += used
+			m[key] = value
+		}
+		return m, n, nil
+	}
+	return nil, 0, ErrCBOR
+}
+
+// readArgument returns the length/value encoded in the initial byte and the bytes following it
+func readArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24 && len(data) >= 2:
+		return uint64(data[1]), 2, nil
+	case info == 25 && len(data) >= 3:
+		return uint64(binary.BigEndian.Uint16(data[1:3])), 3, nil
+	case info == 26 && len(data) >= 5:
+		return uint64(binary.BigEndian.Uint32(data[1:5])), 5, nil
+	case info == 27 && len(data) >= 9:
+		return binary.BigEndian.Uint64(data[1:9]), 9, nil
+	}
+	return 0, 0, ErrCBOR
+}
+
+// encodeCBOR is the reverse of decodeCBOR, only used by the software authenticator.
+// Map keys are written in the canonical order (shorter encodings first) like a real authenticator does.
+func encodeCBOR(value any) []byte {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	case int:
+		return encodeInt(int64(v))
+	case int64:
+		return encodeInt(v)
+	case []byte:
+		return append(encodeHead(2, uint64(len(v))), v...)
+	case string:
+		return append(encodeHead(3, uint64(len(v))), v...)
+	case []any:
+		out := encodeHead(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case map[any]any:
+		type pair struct{ key, value []byte }
+		pairs := make([]pair, 0, len(v))
+		for key, item := range v {
+			pairs = append(pairs, pair{encodeCBOR(key), encodeCBOR(item)})
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			if len(pairs[i].key) != len(pairs[j].key) {
+				return len(pairs[i].key) < len(pairs[j].key)
+			}
+			return string(pairs[i].key) < string(pairs[j].key)
+		})
+
+		out := encodeHead(5, uint64(len(v)))
+		for _, p := range pairs {
+			out = append(out, p.key...)
+			out = append(out, p.value...)
+		}
+		return out
+	}
+	panic("webauthn: unsupported CBOR type")
+}
+
+func encodeInt(v int64) []byte {
+	if v < 0 {
+		return encodeHead(1, uint64(-1-v))
+	}
+	return encodeHead(0, uint64(v))
+}
+
+func encodeHead(major byte, arg uint64) []byte {
+	m := major << 5
+	switch {
+	case arg < 24:
+		return []byte{m | byte(arg)}
+	case arg <= math.MaxUint8:
+		return []byte{m | 24, byte(arg)}
+	case arg <= math.MaxUint16:
+		b := []byte{m | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(arg))
+		return b
+	case arg <= math.MaxUint32:
+		b := []byte{m | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(arg))
+		return b
+	}
+	b := make([]byte, 9)
+	b[0] = m | 27
+	binary.BigEndian.PutUint64(b[1:], arg)
+	return b
+}
@@ -0,0 +1,100 @@
+package webauthn
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCBORRoundTrip(t *testing.T) {
+	value := map[any]any{
+		int64(1):  int64(2),
+		int64(-7): []byte{1, 2, 3},
+		"fmt":     "none",
+		"list":    []any{int64(0), int64(-1), int64(1 << 40), true, false, nil},
+		"nested":  map[any]any{"a": "b"},
+	}
+
+	encoded := encodeCBOR(value)
+	decoded, used, err := decodeCBOR(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != len(encoded) {
+		t.Fatalf("used %d of %d bytes", used, len(encoded))
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Fatalf("decoded %#v", decoded)
+	}
+}
+
+func TestCBORMalformed(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x81}, 32) // arrays nested deeper than allowed
+	deep = append(deep, 0x00)
+
+	tests := map[string][]byte{
+		"empty":                  {},
+		"truncated argument":     {0x19, 0x01},
+		"byte string too long":   {0x45, 0x01, 0x02},
+		"huge byte string":       {0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"huge array":             {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"huge map":               {0xbb, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00},
+		"indefinite length":      {0x5f, 0x41, 0x00, 0xff},
+		"integer overflow":       {0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"negative overflow":      {0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"byte string as map key": {0xa1, 0x41, 0x00, 0x00},
+		"array missing items":    {0x83, 0x01},
+		"tag":                    {0xc1, 0x00},
+		"float":                  {0xfb, 0, 0, 0, 0, 0, 0, 0, 0},
+		"too deep":               deep,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(data); err != ErrCBOR {
+				t.Fatalf("err = %v, want ErrCBOR", err)
+			}
+		})
+	}
+}
+
+func TestCOSEKeyRejected(t *testing.T) {
+	tests := map[string]map[any]any{
+		"unknown algorithm": {int64(coseAlg): int64(-999)},
+		"point not on curve": {
+			int64(coseAlg): int64(AlgES256), int64(coseCrv): int64(1),
+			int64(coseX): make([]byte, 32), int64(coseY): make([]byte, 32),
+		},
+		"short coordinates": {
+			int64(coseAlg): int64(AlgES256), int64(coseCrv): int64(1),
+			int64(coseX): []byte{1}, int64(coseY): []byte{1},
+		},
+		"small rsa modulus": {int64(coseAlg): int64(AlgRS256), int64(-1): make([]byte, 64), int64(-2): []byte{1, 0, 1}},
+	}
+	for name, key := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := checkPublicKey(encodeCBOR(key)); err != ErrUnsupportedKey {
+				t.Fatalf("err = %v, want ErrUnsupportedKey", err)
+			}
+		})
+	}
+
+	if err := checkPublicKey([]byte{0x41}); err == nil {
+		t.Fatal("malformed key accepted")
+	}
+}
+
+// FuzzDecodeCBOR only checks that attacker controlled input never panics and never claims more bytes than it got
+func FuzzDecodeCBOR(f *testing.F) {
+	authenticator, _ := NewSoftAuthenticator(testRP)
+	object, _ := DecodeBase64URL(authenticator.Register("challenge").Response.AttestationObject)
+	f.Add(object)
+	f.Add([]byte{0xa1, 0x01, 0x02})
+	f.Add([]byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, used, err := decodeCBOR(data)
+		if err == nil && (used <= 0 || used > len(data)) {
+			t.Fatalf("used %d of %d bytes", used, len(data))
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithm identifiers we accept, in order of preference
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+var ErrUnsupportedKey = errors.New("unsupported credential public key")
+
+// COSE key map labels for EC2 and OKP keys (RFC 9053), RSA keys use -1 and -2 for n and e
+const (
+	coseAlg = 3
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+)
+
+// verifySignature checks sig over data with a COSE encoded public key, as stored in Credential.PublicKey
+func verifySignature(coseKey []byte, data []byte, sig []byte) error {
+	decoded, _, err := decodeCBOR(coseKey)
+	if err != nil {
+		return err
+	}
+	key, ok := decoded.(map[any]any)
+	if !ok {
+		return ErrUnsupportedKey
+	}
+
+	alg, _ := key[int64(coseAlg)].(int64)
+	switch alg {
+	case AlgES256:
+		x, _ := key[int64(coseX)].([]byte)
+		y, _ := key[int64(coseY)].([]byte)
+		if crv, _ := key[int64(coseCrv)].(int64); crv != 1 || len(x) != 32 || len(y) != 32 {
+			return ErrUnsupportedKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return ErrUnsupportedKey
+		}
+
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return ErrBadSignature
+		}
+		return nil
+
+	case AlgEdDSA:
+		x, _ := key[int64(coseX)].([]byte)
+		if crv, _ := key[int64(coseCrv)].(int64); crv != 6 || len(x) != ed25519.PublicKeySize {
+			return ErrUnsupportedKey
+		}
+		if !ed25519.Verify(ed25519.PublicKey(x), data, sig) {
+			return ErrBadSignature
+		}
+		return nil
+
+	case AlgRS256:
+		// RSA keys use -1 for the modulus and -2 for the exponent
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return ErrUnsupportedKey
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}
+
+		digest := sha256.Sum256(data)
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrBadSignature
+		}
+		return nil
+	}
+	return ErrUnsupportedKey
+}
+
+// checkPublicKey makes sure a key can be used before it is stored at registration
+func checkPublicKey(coseKey []byte) error {
+	err := verifySignature(coseKey, nil, nil)
+	if err == ErrBadSignature {
+		return nil
+	}
+	return err
+}
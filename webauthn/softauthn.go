@@ -0,0 +1,119 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// SoftAuthenticator is an in-memory ES256 authenticator, it lets tests and local scripts run the real
+// ceremonies without a browser or a security key
+type SoftAuthenticator struct {
+	RP           RelyingParty
+	CredentialID []byte
+	Key          *ecdsa.PrivateKey
+	SignCount    uint32
+	UserHandle   []byte
+	// UserVerified simulates a PIN or biometric check on the authenticator
+	UserVerified bool
+}
+
+func NewSoftAuthenticator(rp RelyingParty) (*SoftAuthenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &SoftAuthenticator{RP: rp, CredentialID: id, Key: key, UserVerified: true}, nil
+}
+
+func (a *SoftAuthenticator) clientData(ceremony string, challenge string) []byte {
+	data, _ := json.Marshal(clientData{Type: ceremony, Challenge: challenge, Origin: a.RP.Origin})
+	return data
+}
+
+func (a *SoftAuthenticator) authData(attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RP.ID))
+
+	flags := byte(flagUserPresent)
+	if a.UserVerified {
+		flags |= flagUserVerified
+	}
+	if attested != nil {
+		flags |= flagAttestedData
+	}
+
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+	return append(data, attested...)
+}
+
+func (a *SoftAuthenticator) publicKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.Key.PublicKey.X.FillBytes(x)
+	a.Key.PublicKey.Y.FillBytes(y)
+
+	return encodeCBOR(map[any]any{
+		int64(1):       int64(2), // kty: EC2
+		int64(coseAlg): int64(AlgES256),
+		int64(coseCrv): int64(1), // P-256
+		int64(coseX):   x,
+		int64(coseY):   y,
+	})
+}
+
+// Register answers a registration challenge (options.publicKey.challenge) like navigator.credentials.create()
+func (a *SoftAuthenticator) Register(challenge string) RegistrationResponse {
+	attested := make([]byte, 16) // aaguid, all zero for "none" attestation
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.CredentialID)))
+	attested = append(attested, a.CredentialID...)
+	attested = append(attested, a.publicKey()...)
+
+	object := encodeCBOR(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": a.authData(attested),
+	})
+
+	var response RegistrationResponse
+	response.ID = EncodeBase64URL(a.CredentialID)
+	response.RawID = response.ID
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = EncodeBase64URL(a.clientData("webauthn.create", challenge))
+	response.Response.AttestationObject = EncodeBase64URL(object)
+	return response
+}
+
+// Assert answers a login challenge like navigator.credentials.get(), increasing the signature counter
+func (a *SoftAuthenticator) Assert(challenge string) (AssertionResponse, error) {
+	a.SignCount++
+
+	authData := a.authData(nil)
+	clientDataJSON := a.clientData("webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.Key, digest[:])
+	if err != nil {
+		return AssertionResponse{}, err
+	}
+
+	var response AssertionResponse
+	response.ID = EncodeBase64URL(a.CredentialID)
+	response.RawID = response.ID
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = EncodeBase64URL(clientDataJSON)
+	response.Response.AuthenticatorData = EncodeBase64URL(authData)
+	response.Response.Signature = EncodeBase64URL(signature)
+	response.Response.UserHandle = EncodeBase64URL(a.UserHandle)
+	return response, nil
+}
@@ -0,0 +1,264 @@
+// Package webauthn implements the server side of the WebAuthn registration and assertion ceremonies
+// (https://www.w3.org/TR/webauthn-2/) with the standard library only.
+// Attestation statements are not verified, we ask authenticators for "none" attestation: we only need to
+// know that the same key is used again, not who made the authenticator.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrBadClientData     = errors.New("client data is invalid")
+	ErrChallengeMismatch = errors.New("challenge does not match")
+	ErrOriginMismatch    = errors.New("origin does not match")
+	ErrRPIDMismatch      = errors.New("relying party id does not match")
+	ErrUserNotPresent    = errors.New("user presence was not confirmed")
+	ErrUserNotVerified   = errors.New("user verification is required")
+	ErrBadAuthData       = errors.New("authenticator data is invalid")
+	ErrBadSignature      = errors.New("signature is invalid")
+	ErrCloneDetected     = errors.New("signature counter went backwards, the authenticator may have been cloned")
+)
+
+// authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// RelyingParty is this service, ID is the domain (e.g. "example.com") and Origin the exact web origin (e.g. "https://example.com")
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// Credential is what has to be stored after registration to verify later logins
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE encoded
+	SignCount uint32
+}
+
+// RegistrationResponse is the JSON form of the PublicKeyCredential returned by navigator.credentials.create(),
+// binary fields are base64url encoded
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential returned by navigator.credentials.get()
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// DecodeBase64URL accepts base64url with or without padding, browsers and libraries differ
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func EncodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ChallengeOf returns the challenge the browser signed, so the server can look up the ceremony it belongs to
+func ChallengeOf(clientDataJSON string) (string, error) {
+	raw, err := DecodeBase64URL(clientDataJSON)
+	if err != nil {
+		return "", ErrBadClientData
+	}
+
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return "", ErrBadClientData
+	}
+	return data.Challenge, nil
+}
+
+func (rp RelyingParty) checkClientData(clientDataJSON []byte, ceremony string, challenge string) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return ErrBadClientData
+	}
+
+	if data.Type != ceremony {
+		return ErrBadClientData
+	}
+	if data.Challenge != strings.TrimRight(challenge, "=") {
+		return ErrChallengeMismatch
+	}
+	if data.Origin != rp.Origin {
+		return ErrOriginMismatch
+	}
+	return nil
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	var ad authenticatorData
+
+	// rpIdHash (32) | flags (1) | signCount (4) | attested credential data | extensions
+	if len(data) < 37 {
+		return ad, ErrBadAuthData
+	}
+	ad.rpIDHash = data[:32]
+	ad.flags = data[32]
+	ad.signCount = binary.BigEndian.Uint32(data[33:37])
+
+	if ad.flags&flagAttestedData == 0 {
+		return ad, nil
+	}
+
+	// aaguid (16) | credentialIdLength (2) | credentialId | credentialPublicKey (COSE)
+	rest := data[37:]
+	if len(rest) < 18 {
+		return ad, ErrBadAuthData
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLength {
+		return ad, ErrBadAuthData
+	}
+	ad.credentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	_, used, err := decodeCBOR(rest)
+	if err != nil {
+		return ad, ErrBadAuthData
+	}
+	ad.publicKey = rest[:used]
+	return ad, nil
+}
+
+func (rp RelyingParty) checkAuthenticatorData(ad authenticatorData, requireUserVerification bool) error {
+	expected := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, expected[:]) {
+		return ErrRPIDMismatch
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if requireUserVerification && ad.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+// VerifyRegistration finishes a registration ceremony started with the given challenge and returns the new credential
+func (rp RelyingParty) VerifyRegistration(challenge string, response RegistrationResponse) (Credential, error) {
+	clientDataJSON, err := DecodeBase64URL(response.Response.ClientDataJSON)
+	if err != nil {
+		return Credential{}, ErrBadClientData
+	}
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return Credential{}, err
+	}
+
+	attestation, err := DecodeBase64URL(response.Response.AttestationObject)
+	if err != nil {
+		return Credential{}, ErrBadAuthData
+	}
+	decoded, _, err := decodeCBOR(attestation)
+	if err != nil {
+		return Credential{}, ErrBadAuthData
+	}
+	object, ok := decoded.(map[any]any)
+	if !ok {
+		return Credential{}, ErrBadAuthData
+	}
+	rawAuthData, ok := object["authData"].([]byte)
+	if !ok {
+		return Credential{}, ErrBadAuthData
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if err := rp.checkAuthenticatorData(ad, false); err != nil {
+		return Credential{}, err
+	}
+	if ad.credentialID == nil {
+		return Credential{}, ErrBadAuthData
+	}
+	if err := checkPublicKey(ad.publicKey); err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{ID: ad.credentialID, PublicKey: ad.publicKey, SignCount: ad.signCount}, nil
+}
+
+// VerifyAssertion finishes a login ceremony for a stored credential and returns the new signature counter to store.
+// ErrCloneDetected means the signature was valid but the counter did not increase, the credential should be disabled.
+func (rp RelyingParty) VerifyAssertion(challenge string, credential Credential, response AssertionResponse, requireUserVerification bool) (uint32, error) {
+	clientDataJSON, err := DecodeBase64URL(response.Response.ClientDataJSON)
+	if err != nil {
+		return 0, ErrBadClientData
+	}
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	rawAuthData, err := DecodeBase64URL(response.Response.AuthenticatorData)
+	if err != nil {
+		return 0, ErrBadAuthData
+	}
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.checkAuthenticatorData(ad, requireUserVerification); err != nil {
+		return 0, err
+	}
+
+	signature, err := DecodeBase64URL(response.Response.Signature)
+	if err != nil {
+		return 0, ErrBadSignature
+	}
+
+	// the authenticator signs authenticatorData || sha256(clientDataJSON)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if err := verifySignature(credential.PublicKey, signed, signature); err != nil {
+		return 0, err
+	}
+
+	// authenticators without a counter always send 0, otherwise it must grow on every use
+	if (ad.signCount != 0 || credential.SignCount != 0) && ad.signCount <= credential.SignCount {
+		return ad.signCount, ErrCloneDetected
+	}
+	return ad.signCount, nil
+}
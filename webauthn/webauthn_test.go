@@ -0,0 +1,179 @@
+package webauthn
+
+import (
+	"errors"
+	"testing"
+)
+
+var testRP = RelyingParty{ID: "example.com", Name: "Example", Origin: "https://example.com"}
+
+// register runs a registration ceremony with a new software authenticator
+func register(t *testing.T) (*SoftAuthenticator, Credential) {
+	t.Helper()
+
+	authenticator, err := NewSoftAuthenticator(testRP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := testRP.VerifyRegistration("register-challenge", authenticator.Register("register-challenge"))
+	if err != nil {
+		t.Fatal("registration failed:", err)
+	}
+	return authenticator, credential
+}
+
+func TestRegistrationAndLogin(t *testing.T) {
+	authenticator, credential := register(t)
+
+	if string(credential.ID) != string(authenticator.CredentialID) {
+		t.Fatal("credential id does not match the authenticator")
+	}
+
+	for i := 1; i <= 3; i++ {
+		response, err := authenticator.Assert("login-challenge")
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := testRP.VerifyAssertion("login-challenge", credential, response, true)
+		if err != nil {
+			t.Fatalf("login %d failed: %v", i, err)
+		}
+		if count != uint32(i) {
+			t.Fatalf("sign count = %d, want %d", count, i)
+		}
+		credential.SignCount = count
+	}
+}
+
+func TestCloneDetection(t *testing.T) {
+	authenticator, credential := register(t)
+
+	response, _ := authenticator.Assert("first")
+	count, err := testRP.VerifyAssertion("first", credential, response, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential.SignCount = count
+
+	// a copy of the key that was never used since the registration
+	clone := *authenticator
+	clone.SignCount = 0
+	response, _ = clone.Assert("second")
+	if _, err := testRP.VerifyAssertion("second", credential, response, true); !errors.Is(err, ErrCloneDetected) {
+		t.Fatalf("err = %v, want ErrCloneDetected", err)
+	}
+
+	// replaying the same counter is refused too
+	response, _ = clone.Assert("third")
+	credential.SignCount = 2
+	if _, err := testRP.VerifyAssertion("third", credential, response, true); !errors.Is(err, ErrCloneDetected) {
+		t.Fatalf("err = %v, want ErrCloneDetected", err)
+	}
+}
+
+func TestAuthenticatorWithoutCounter(t *testing.T) {
+	authenticator, credential := register(t)
+
+	// authenticators without a counter always send 0, which is not a clone
+	for i := 0; i < 2; i++ {
+		authenticator.SignCount = ^uint32(0) // Assert wraps it around to 0
+		response, _ := authenticator.Assert("challenge")
+		if _, err := testRP.VerifyAssertion("challenge", credential, response, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	authenticator, err := NewSoftAuthenticator(testRP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		rp   RelyingParty
+		resp RegistrationResponse
+		want error
+	}{
+		{"other challenge", testRP, authenticator.Register("something else"), ErrChallengeMismatch},
+		{"other origin", RelyingParty{ID: testRP.ID, Origin: "https://evil.example"}, authenticator.Register("challenge"), ErrOriginMismatch},
+		{"other rp id", RelyingParty{ID: "evil.example", Origin: testRP.Origin}, authenticator.Register("challenge"), ErrRPIDMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.rp.VerifyRegistration("challenge", tt.resp); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// a login response can't be used to register
+	assertion, _ := authenticator.Assert("challenge")
+	var response RegistrationResponse
+	response.Response.ClientDataJSON = assertion.Response.ClientDataJSON
+	response.Response.AttestationObject = assertion.Response.AuthenticatorData
+	if _, err := testRP.VerifyRegistration("challenge", response); err == nil {
+		t.Fatal("an assertion was accepted as a registration")
+	}
+}
+
+func TestAssertionRejected(t *testing.T) {
+	authenticator, credential := register(t)
+	other, _ := register(t)
+
+	t.Run("other challenge", func(t *testing.T) {
+		response, _ := authenticator.Assert("something else")
+		if _, err := testRP.VerifyAssertion("challenge", credential, response, true); !errors.Is(err, ErrChallengeMismatch) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("user not verified", func(t *testing.T) {
+		authenticator.UserVerified = false
+		defer func() { authenticator.UserVerified = true }()
+
+		response, _ := authenticator.Assert("challenge")
+		if _, err := testRP.VerifyAssertion("challenge", credential, response, true); !errors.Is(err, ErrUserNotVerified) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		response, _ := other.Assert("challenge")
+		if _, err := testRP.VerifyAssertion("challenge", credential, response, true); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("tampered authenticator data", func(t *testing.T) {
+		response, _ := authenticator.Assert("challenge")
+		authData, _ := DecodeBase64URL(response.Response.AuthenticatorData)
+		authData[36]++ // the counter is signed
+		response.Response.AuthenticatorData = EncodeBase64URL(authData)
+		if _, err := testRP.VerifyAssertion("challenge", credential, response, true); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("truncated authenticator data", func(t *testing.T) {
+		response, _ := authenticator.Assert("challenge")
+		response.Response.AuthenticatorData = EncodeBase64URL([]byte{1, 2, 3})
+		if _, err := testRP.VerifyAssertion("challenge", credential, response, true); !errors.Is(err, ErrBadAuthData) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+}
+
+func TestTruncatedAttestationNeverPanics(t *testing.T) {
+	authenticator, _ := NewSoftAuthenticator(testRP)
+	response := authenticator.Register("challenge")
+	object, _ := DecodeBase64URL(response.Response.AttestationObject)
+
+	for i := 0; i < len(object); i++ {
+		response.Response.AttestationObject = EncodeBase64URL(object[:i])
+		if _, err := testRP.VerifyRegistration("challenge", response); err == nil {
+			t.Fatalf("attestation truncated to %d bytes was accepted", i)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package webhook signs and delivers webhook payloads, and lets receivers check the signature.
+//
+// Every delivery is a POST of the JSON event with these headers:
+//
+//	X-Webhook-Event:     user.created
+//	X-Webhook-Delivery:  id of the delivery, the same on every retry
+//	X-Webhook-Signature: t=<unix time>,v1=<hex hmac-sha256 of "<unix time>.<body>" with the secret of the subscription>
+//
+// A receiver should recompute the signature with Verify and refuse old timestamps, which stops replays.
+// Any 2xx answer counts as delivered, anything else (a redirect too) is retried with Backoff.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+var (
+	ErrBadSignature   = errors.New("webhook signature does not match")
+	ErrTooOld         = errors.New("webhook timestamp is outside the tolerance")
+	ErrPrivateAddress = errors.New("webhook url is not a public address")
+)
+
+// Sign returns the value of the signature header for a body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, signature(secret, timestamp, body))
+}
+
+func signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header against the body, for receivers (and tests using an httptest server)
+func Verify(secret string, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return ErrBadSignature
+	}
+
+	sent := time.Unix(timestamp, 0)
+	if now.Sub(sent) > tolerance || sent.Sub(now) > tolerance {
+		return ErrTooOld
+	}
+
+	// several v1 values are accepted, so a secret can be rotated while receivers still know the old one
+	expected := signature(secret, timestamp, body)
+	for _, candidate := range signatures {
+		if hmac.Equal([]byte(expected), []byte(candidate)) {
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
+
+// Backoff is the delay before retrying after the given number of failed attempts: base, 2*base, 4*base ... up to max
+func Backoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	if attempts < 1 {
+		return base
+	}
+	delay := base << uint(attempts-1)
+	if delay > max || delay <= 0 {
+		return max
+	}
+	return delay
+}
+
+// Request is one delivery attempt
+type Request struct {
+	URL        string
+	Secret     string
+	Event      string
+	DeliveryID string
+	Body       []byte
+}
+
+// Sender posts deliveries, Client can be replaced e.g. by the client of an httptest.NewTLSServer
+type Sender struct {
+	Client *http.Client
+}
+
+// NewSender returns a sender that only connects to public addresses, unless allowPrivate is set (e.g. for a
+// receiver running locally), and never follows redirects. The address is checked when dialing, after the name
+// was resolved, so a name resolving to an internal service is refused as well as an ip in the url.
+func NewSender(timeout time.Duration, allowPrivate bool) *Sender {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = publicOnly
+	}
+	return &Sender{Client: &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil, // a proxy would connect for us, past the address check
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 4,
+		},
+		// a redirect is a failed delivery, following it would post the event to a url that was never checked
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// publicOnly is the Control of the dialer, it sees the resolved address right before connecting
+func publicOnly(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !PublicAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// special purpose ranges the netip methods don't cover
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // this network
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier grade nat
+	netip.MustParsePrefix("192.0.0.0/24"),   // protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, and the broadcast address
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local nat64
+	netip.MustParsePrefix("2001:db8::/32"),  // documentation
+}
+
+// PublicAddress tells whether webhooks may be sent to ip: not loopback, private, link-local (which holds the
+// cloud metadata services), multicast or unspecified
+func PublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Deliver signs and posts the body, it returns the status code of the receiver (0 when none was received)
+// and an error unless the receiver answered 2xx
+func (s *Sender) Deliver(ctx context.Context, r Request) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(r.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "golang-jwt-project-webhooks")
+	req.Header.Set(HeaderEvent, r.Event)
+	req.Header.Set(HeaderDelivery, r.DeliveryID)
+	req.Header.Set(HeaderSignature, Sign(r.Secret, time.Now().Unix(), r.Body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
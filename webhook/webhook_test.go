@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"type":"user.created"}`)
+	now := time.Now()
+	header := Sign("whsec_test", now.Unix(), body)
+
+	if err := Verify("whsec_test", header, body, 5*time.Minute, now); err != nil {
+		t.Fatalf("valid signature refused: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+		want   error
+	}{
+		{"other secret", "whsec_other", header, body, now, ErrBadSignature},
+		{"changed body", "whsec_test", header, []byte(`{"type":"user.deleted"}`), now, ErrBadSignature},
+		{"replayed later", "whsec_test", header, body, now.Add(6 * time.Minute), ErrTooOld},
+		{"from the future", "whsec_test", header, body, now.Add(-6 * time.Minute), ErrTooOld},
+		{"no timestamp", "whsec_test", strings.Split(header, ",")[1], body, now, ErrBadSignature},
+		{"no signature", "whsec_test", strings.Split(header, ",")[0], body, now, ErrBadSignature},
+		{"garbage", "whsec_test", "garbage", body, now, ErrBadSignature},
+	}
+	for _, tc := range cases {
+		if err := Verify(tc.secret, tc.header, tc.body, 5*time.Minute, tc.now); err != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestVerifyDuringSecretRotation(t *testing.T) {
+	body := []byte(`{}`)
+	now := time.Now()
+	old := Sign("whsec_old", now.Unix(), body)
+	current := Sign("whsec_new", now.Unix(), body)
+	header := old + ",v1=" + strings.SplitN(current, "v1=", 2)[1]
+
+	for _, secret := range []string{"whsec_old", "whsec_new"} {
+		if err := Verify(secret, header, body, time.Minute, now); err != nil {
+			t.Errorf("%s refused: %v", secret, err)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, 4*time.Hour + 16*time.Minute},
+		{11, 6 * time.Hour},
+		{80, 6 * time.Hour}, // the shift overflows
+	}
+	for _, tc := range cases {
+		if got := Backoff(tc.attempts, 30*time.Second, 6*time.Hour); got != tc.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusNoContent)
+	var received atomic.Int32
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify("whsec_test", r.Header.Get(HeaderSignature), body, time.Minute, time.Now()); err != nil {
+			t.Errorf("receiver could not verify the delivery: %v", err)
+		}
+		if r.Header.Get(HeaderEvent) != "user.login" || r.Header.Get(HeaderDelivery) != "delivery-1" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		received.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	sender := &Sender{Client: srv.Client()}
+	request := Request{URL: srv.URL, Secret: "whsec_test", Event: "user.login", DeliveryID: "delivery-1", Body: []byte(`{"type":"user.login"}`)}
+
+	code, err := sender.Deliver(context.Background(), request)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("got %d, %v", code, err)
+	}
+
+	status.Store(http.StatusInternalServerError)
+	code, err = sender.Deliver(context.Background(), request)
+	if err == nil || code != http.StatusInternalServerError {
+		t.Fatalf("a 500 counted as delivered: %d, %v", code, err)
+	}
+	if received.Load() != 2 {
+		t.Fatalf("receiver got %d deliveries, want 2", received.Load())
+	}
+}
+
+func TestSenderRefusesPrivateAddresses(t *testing.T) {
+	var received atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer srv.Close()
+
+	urls := []string{srv.URL, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)}
+	for _, url := range urls {
+		code, err := NewSender(time.Second, false).Deliver(context.Background(), Request{URL: url, Body: []byte(`{}`)})
+		if !errors.Is(err, ErrPrivateAddress) || code != 0 {
+			t.Errorf("%s: got %d, %v, want ErrPrivateAddress", url, code, err)
+		}
+	}
+	if received.Load() != 0 {
+		t.Fatal("a delivery reached a loopback receiver")
+	}
+}
+
+func TestSenderDoesNotFollowRedirects(t *testing.T) {
+	var followed atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed.Add(1)
+	}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	// private addresses are allowed here only because both servers listen on loopback
+	code, err := NewSender(time.Second, true).Deliver(context.Background(), Request{URL: redirect.URL, Body: []byte(`{}`)})
+	if err == nil || code != http.StatusTemporaryRedirect {
+		t.Fatalf("got %d, %v, want a failed delivery with the redirect status", code, err)
+	}
+	if followed.Load() != 0 {
+		t.Fatal("the redirect was followed")
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	cases := map[string]bool{
+		"93.184.216.34":        true,
+		"2606:2800:220:1::1":   true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false, // cloud metadata
+		"fe80::1":              false,
+		"fd00::1":              false,
+		"0.0.0.0":              false,
+		"::":                   false,
+		"100.64.0.1":           false,
+		"224.0.0.1":            false,
+		"255.255.255.255":      false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:169.254.1.1":   false,
+		"::ffff:93.184.216.34": true,
+	}
+	for address, want := range cases {
+		if got := PublicAddress(netip.MustParseAddr(address)); got != want {
+			t.Errorf("PublicAddress(%s) = %v, want %v", address, got, want)
+		}
+	}
+}